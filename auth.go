@@ -0,0 +1,287 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Principal is the authenticated caller behind a request.
+type Principal struct {
+	Subject   string   // stable identity: "token:<name>" or "oauth:<sub>"
+	Namespace string   // the caller's own namespace when namespaces are per caller
+	Scopes    []string // OAuth scopes granted to the access token
+	Scoped    bool     // whether Scopes limits what the caller may do; static tokens are unscoped
+
+	// API key permissions; nil means unrestricted
+	Tools      []string
+	Categories []string
+}
+
+// hasScope reports whether the caller was granted scope. Unscoped callers,
+// and requests with auth disabled (nil principal), may do anything.
+func (p *Principal) hasScope(scope string) bool {
+	if p == nil || !p.Scoped || scope == "" {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	errNoToken      = errors.New("missing bearer token")
+	errInvalidToken = errors.New("invalid bearer token")
+)
+
+// Authenticator resolves the caller of an HTTP request.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// ── Static bearer tokens ──────────────────────────────────────────────────────
+
+// staticTokenAuth accepts any of a fixed set of bearer tokens. Tokens are
+// held as SHA-256 digests so lookups don't leak timing about the secret.
+type staticTokenAuth struct {
+	callers map[[sha256.Size]byte]Principal // digest → caller
+}
+
+func newStaticTokenAuth(tokens []TokenConfig) (*staticTokenAuth, error) {
+	a := &staticTokenAuth{callers: map[[sha256.Size]byte]Principal{}}
+	for i, tc := range tokens {
+		name := tc.Name
+		if name == "" {
+			name = fmt.Sprintf("token-%d", i+1)
+		}
+		secret, err := tc.resolve()
+		if err != nil {
+			return nil, fmt.Errorf("auth token %q: %w", name, err)
+		}
+		if secret == "" {
+			return nil, fmt.Errorf("auth token %q: empty token", name)
+		}
+		ns := tc.Namespace
+		if ns == "" {
+			ns = name
+		}
+		if !validNamespace(ns) {
+			return nil, fmt.Errorf("auth token %q: invalid namespace %q", name, ns)
+		}
+		if strings.HasPrefix(ns, oauthNamespacePrefix) {
+			return nil, fmt.Errorf("auth token %q: namespace %q is reserved for OAuth callers", name, ns)
+		}
+		tools, err := tc.allowedTools()
+		if err != nil {
+			return nil, fmt.Errorf("auth token %q: %w", name, err)
+		}
+		for _, c := range tc.Categories {
+			if !isValidCategory(c) {
+				return nil, fmt.Errorf("auth token %q: unknown category %q", name, c)
+			}
+		}
+		a.callers[sha256.Sum256([]byte(secret))] = Principal{
+			Subject:    "token:" + name,
+			Namespace:  ns,
+			Tools:      tools,
+			Categories: tc.Categories,
+		}
+	}
+	return a, nil
+}
+
+func (a *staticTokenAuth) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, errNoToken
+	}
+	p, ok := a.callers[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, errInvalidToken
+	}
+	return &p, nil
+}
+
+// allowedTools resolves the key's tool list, or nil if it may call any tool.
+func (tc TokenConfig) allowedTools() ([]string, error) {
+	readOnly := readOnlyTools()
+	if tc.Tools == nil {
+		if tc.ReadOnly {
+			var tools []string
+			for _, name := range readOnly {
+				if !isAdminTool(name) {
+					tools = append(tools, name)
+				}
+			}
+			return tools, nil
+		}
+		return nil, nil
+	}
+	for _, name := range tc.Tools {
+		known := false
+		for _, t := range GetTools() {
+			known = known || t.Name == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown tool %q", name)
+		}
+		if tc.ReadOnly && !(&Principal{Tools: readOnly}).allowsTool(name) {
+			return nil, fmt.Errorf("tool %q is not read-only", name)
+		}
+	}
+	return tc.Tools, nil
+}
+
+// resolve reads the token from whichever source is configured.
+func (tc TokenConfig) resolve() (string, error) {
+	switch {
+	case tc.TokenFile != "":
+		data, err := os.ReadFile(tc.TokenFile)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	case tc.TokenEnv != "":
+		v, ok := os.LookupEnv(tc.TokenEnv)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s not set", tc.TokenEnv)
+		}
+		return strings.TrimSpace(v), nil
+	default:
+		return tc.Token, nil
+	}
+}
+
+// ── HTTP helpers ──────────────────────────────────────────────────────────────
+
+// chainAuth tries each authenticator in turn and accepts the first match.
+type chainAuth []Authenticator
+
+func (c chainAuth) Authenticate(r *http.Request) (*Principal, error) {
+	err := errNoToken
+	for _, a := range c {
+		var p *Principal
+		if p, err = a.Authenticate(r); err == nil {
+			return p, nil
+		}
+	}
+	return nil, err
+}
+
+// NewAuthenticator builds the authenticator described by config — static
+// tokens, OAuth JWTs, or both — or returns nil when no credentials are
+// configured and the endpoint is open.
+func NewAuthenticator(cfg AuthConfig, oauth OAuthConfig) (Authenticator, error) {
+	var chain chainAuth
+	if len(cfg.Tokens) > 0 {
+		a, err := newStaticTokenAuth(cfg.Tokens)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, a)
+	}
+	if oauth.enabled() {
+		a, err := newJWTAuth(oauth)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, a)
+	}
+	if len(chain) == 0 {
+		return nil, nil
+	}
+	return chain, nil
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(h, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticate resolves the caller, writing a 401 with a WWW-Authenticate
+// challenge and returning false if the request isn't authorized.
+// With auth disabled every request passes with a nil principal.
+func (s *Server) authenticate(w http.ResponseWriter, r *http.Request) (*Principal, bool) {
+	if s.auth == nil {
+		return nil, true
+	}
+	p, err := s.auth.Authenticate(r)
+	if err == nil {
+		return p, true
+	}
+
+	challenge := s.challenge()
+	if !errors.Is(err, errNoToken) {
+		challenge += fmt.Sprintf(`, error="invalid_token", error_description=%q`, err.Error())
+		log.Printf("auth rejected from %s: %v", r.RemoteAddr, err)
+	}
+	w.Header().Set("WWW-Authenticate", challenge)
+	http.Error(w, "unauthorized", http.StatusUnauthorized)
+	return nil, false
+}
+
+// challenge is the base WWW-Authenticate value. In OAuth mode it points
+// clients at the protected resource metadata so they can discover the
+// authorization server.
+func (s *Server) challenge() string {
+	c := fmt.Sprintf(`Bearer realm=%q`, s.authRealm)
+	if s.oauth.enabled() {
+		c += fmt.Sprintf(`, resource_metadata=%q`, protectedResourceMetadataURL(s.oauth.Resource))
+	}
+	return c
+}
+
+// insufficientScope answers 403 with a challenge naming the missing scope,
+// letting OAuth clients step up authorization.
+func (s *Server) insufficientScope(w http.ResponseWriter, scope string) {
+	w.Header().Set("WWW-Authenticate", s.challenge()+fmt.Sprintf(`, error="insufficient_scope", scope=%q`, scope))
+	http.Error(w, "insufficient scope: requires "+scope, http.StatusForbidden)
+}
+
+// scopeFor returns the OAuth scope a request needs, or "" if none.
+// Tools map through requiredScope; reading resources and prompts (which
+// embed lookup results) needs the read scope.
+func (s *Server) scopeFor(req *Request) string {
+	if !s.oauth.enabled() {
+		return ""
+	}
+	switch req.Method {
+	case "tools/call":
+		var p struct {
+			Name string `json:"name"`
+		}
+		json.Unmarshal(req.Params, &p)
+		for _, t := range GetTools() {
+			if t.Name == p.Name {
+				return s.requiredScope(t)
+			}
+		}
+		return ""
+	case "resources/list", "resources/read", "resources/subscribe", "prompts/get":
+		return s.oauth.ReadScope
+	default:
+		return ""
+	}
+}
+
+// sameCaller reports whether a request's principal may use a session
+// opened by another principal.
+func sameCaller(sess *Session, p *Principal) bool {
+	owner := sess.principal()
+	if owner == nil || p == nil {
+		return owner == nil && p == nil
+	}
+	return owner.Subject == p.Subject
+}
@@ -1,10 +1,16 @@
 package main
 
-import "time"
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
 
 // Learning is the core data type shared across backends.
 type Learning struct {
 	ID         string    `json:"id"`
+	Namespace  string    `json:"namespace"`
 	Category   string    `json:"category"`
 	Content    string    `json:"content"`
 	Tags       string    `json:"tags"`
@@ -12,43 +18,281 @@ type Learning struct {
 	UseCount   int       `json:"use_count"`
 	CreatedAt  time.Time `json:"created_at"`
 	UpdatedAt  time.Time `json:"updated_at"`
+
+	// SupersededBy is the ID of the learning this one was merged into.
+	// Superseded learnings are kept, but only Get and Each return them.
+	SupersededBy string `json:"superseded_by,omitempty"`
+
+	// DeletedAt is when the learning was moved to the trash. Trashed
+	// learnings are only returned by Trash and Each.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	Source Source `json:"source,omitzero"` // who last wrote the learning
+
+	Match *Match `json:"match,omitempty"` // set by Search
+
+	// Revisions are the learning's earlier versions, carried only by JSONL
+	// exports and imports; backends neither fill nor store them.
+	Revisions []*Revision `json:"revisions,omitempty"`
+}
+
+// Source records where a learning came from: the MCP client and session
+// that stored or last updated it, the conversation it was learned in and the
+// authenticated caller. Learnings stored before sources were recorded, or
+// outside a session, have none.
+type Source struct {
+	Client        string `json:"client,omitempty"`         // clientInfo name sent in initialize
+	ClientVersion string `json:"client_version,omitempty"` // clientInfo version sent in initialize
+	Session       string `json:"session,omitempty"`        // MCP session ID
+	Conversation  string `json:"conversation,omitempty"`   // conversation URL or ID, if the client gave one
+	Author        string `json:"author,omitempty"`         // caller identity, e.g. "token:laptop"
+}
+
+// Matches reports whether source names this learning's client, session,
+// conversation or author. The empty source matches every learning.
+func (s Source) Matches(source string) bool {
+	return source == "" || source == s.Client || source == s.Session || source == s.Conversation || source == s.Author
+}
+
+// String describes the source for the model, e.g.
+// "claude-code/1.2.3, session a1b2c3d4, conversation …, by token:laptop".
+func (s Source) String() string {
+	var parts []string
+	if s.Client != "" {
+		client := s.Client
+		if s.ClientVersion != "" {
+			client += "/" + s.ClientVersion
+		}
+		parts = append(parts, client)
+	}
+	if s.Session != "" {
+		short := s.Session
+		if len(short) > 8 {
+			short = short[:8]
+		}
+		parts = append(parts, "session "+short)
+	}
+	if s.Conversation != "" {
+		parts = append(parts, "conversation "+s.Conversation)
+	}
+	if s.Author != "" {
+		parts = append(parts, "by "+s.Author)
+	}
+	return strings.Join(parts, ", ")
 }
 
-// Backend is the storage interface. Both SQLite and ChromaDB implement this.
+// Revision is one version of a learning's content, tags and confidence.
+// Revisions are numbered from 1, oldest first.
+type Revision struct {
+	Number     int       `json:"revision"`
+	Content    string    `json:"content"`
+	Tags       string    `json:"tags"`
+	Confidence float64   `json:"confidence"`
+	UpdatedAt  time.Time `json:"updated_at"`        // when this version was stored
+	Current    bool      `json:"current,omitempty"` // the learning as it is now
+}
+
+// defaultNamespace holds learnings of callers with no namespace of their
+// own, and everything stored before namespaces existed.
+const defaultNamespace = "default"
+
+// Backend is the storage interface. SQLite, ChromaDB, PostgreSQL and the
+// in-memory backend implement this.
+// Every method is scoped to a namespace: learnings in one namespace are
+// invisible to operations on any other, including by ID.
 type Backend interface {
-	// Add stores a new learning and returns it with its assigned ID.
-	Add(category, content, tags string, confidence float64) (*Learning, error)
+	// Add stores a new learning from source and returns it with its
+	// assigned ID.
+	Add(namespace, category, content, tags string, confidence float64, source Source) (*Learning, error)
+
+	// Search returns learnings relevant to the query, optionally filtered by
+	// category. Superseded and deleted learnings are left out.
+	Search(namespace, query, category string, limit int) ([]*Learning, error)
 
-	// Search returns learnings relevant to the query, optionally filtered by category.
-	Search(query, category string, limit int) ([]*Learning, error)
+	// List returns all learnings, optionally filtered by category and by
+	// source (see Source.Matches), newest first. Superseded and deleted
+	// learnings are left out.
+	List(namespace, category, source string, limit int) ([]*Learning, error)
 
-	// List returns all learnings, optionally filtered by category, newest first.
-	List(category string, limit int) ([]*Learning, error)
+	// Get returns a single learning by ID, superseded or not. Deleted
+	// learnings are not found.
+	Get(namespace, id string) (*Learning, error)
 
-	// Update replaces the content/tags/confidence of an existing learning.
-	Update(id, content, tags string, confidence float64) error
+	// Update replaces the content/tags/confidence of an existing learning
+	// and records source as its source, moving it to the front of List. It
+	// fails if there is no such learning. Backends that are Historians keep
+	// the version it replaced.
+	Update(namespace, id, content, tags string, confidence float64, source Source) error
 
-	// Delete removes a learning by ID.
-	Delete(id string) error
+	// Delete removes a learning by ID. It fails if there is no such learning.
+	// Backends that are Trashers move it to the trash, revisions and all;
+	// others remove it with its revisions.
+	Delete(namespace, id string) error
 
 	// IncrementUseCount records that a learning was surfaced to the AI.
-	IncrementUseCount(id string)
+	IncrementUseCount(namespace, id string)
 
-	// Stats returns a count of learnings per category.
-	Stats() (map[string]int, error)
+	// Stats returns a count of learnings per category, superseded and
+	// deleted ones aside.
+	Stats(namespace string) (map[string]int, error)
 
 	// Close releases any resources held by the backend.
 	Close() error
 }
 
+// Reembedder is implemented by backends that store embeddings, so they can
+// be brought in line with the configured embedder after a model change.
+type Reembedder interface {
+	// Embedder returns the configured embedder, or nil.
+	Embedder() Embedder
+
+	// EmbeddingModels counts learnings across all namespaces by the name of
+	// the embedder that made their embedding; "" counts those without one.
+	EmbeddingModels() (map[string]int, error)
+
+	// Reembed embeds up to batch learnings whose embedding is missing or
+	// from another embedder, and returns how many it embedded; 0 means done.
+	Reembed(batch int) (int, error)
+}
+
+// Porter is implemented by backends whose learnings can be copied wholesale,
+// as the migrate command does, keeping their IDs, timestamps and use counts.
+type Porter interface {
+	// Namespaces returns every namespace that holds learnings.
+	Namespaces() ([]string, error)
+
+	// Each calls fn with every learning in the namespace, roughly in the
+	// order they were added, stopping at the first error.
+	Each(namespace string, fn func(*Learning) error) error
+
+	// Put stores l exactly as given, replacing any learning with its ID in
+	// its namespace, and returns what was stored. A learning without an ID,
+	// or with one this backend can't use, is given a new ID. Replacing the
+	// same learning (the same creation time, to the second) records the
+	// version replaced as a revision, as Update does, unless it changed
+	// nothing; replacing a different one drops that one's revisions.
+	Put(l *Learning) (*Learning, error)
+
+	// PutRevisions replaces the revisions of the learning with this ID by
+	// revs, numbered as given, so a copied learning keeps its history. It
+	// fails if there is no such learning.
+	PutRevisions(namespace, id string, revs []*Revision) error
+}
+
+// Historian is implemented by backends that keep the versions of a learning
+// Update replaced, so a bad edit can be undone.
+type Historian interface {
+	// Revisions returns the learning's earlier versions, oldest first and
+	// numbered from 1; the current version is not among them. Update
+	// records one unless it changed nothing. A learning with no history,
+	// or none at all, has no revisions.
+	Revisions(namespace, id string) ([]*Revision, error)
+}
+
+// Trasher is implemented by backends whose Delete moves learnings to a
+// trash, from which they can be restored until they are purged.
+type Trasher interface {
+	// Trash returns the namespace's deleted learnings, optionally filtered
+	// by category, most recently deleted first.
+	Trash(namespace, category string, limit int) ([]*Learning, error)
+
+	// Restore takes a learning out of the trash as it was when deleted. It
+	// fails if the learning isn't in the trash.
+	Restore(namespace, id string) error
+
+	// Purge removes the namespace's learnings deleted before cutoff for
+	// good, with their revisions, and returns how many it removed.
+	Purge(namespace string, cutoff time.Time) (int, error)
+}
+
+// trasherOf returns b's Trasher methods, for wrappers that pass them through.
+func trasherOf(b Backend) (Trasher, error) {
+	t, ok := b.(Trasher)
+	if !ok {
+		return nil, fmt.Errorf("this backend doesn't keep deleted learnings")
+	}
+	return t, nil
+}
+
+// historianOf returns b's Historian method, for wrappers that pass it through.
+func historianOf(b Backend) (Historian, error) {
+	h, ok := b.(Historian)
+	if !ok {
+		return nil, fmt.Errorf("this backend doesn't keep revision history")
+	}
+	return h, nil
+}
+
+// revisionsOf returns the learning's revisions, or none if b keeps no
+// history.
+func revisionsOf(b any, namespace, id string) ([]*Revision, error) {
+	h, ok := b.(Historian)
+	if !ok {
+		return nil, nil
+	}
+	return h.Revisions(namespace, id)
+}
+
+// porterOf returns b's Porter methods, for wrappers that pass them through.
+func porterOf(b Backend) (Porter, error) {
+	p, ok := b.(Porter)
+	if !ok {
+		return nil, fmt.Errorf("this backend can't export or import learnings")
+	}
+	return p, nil
+}
+
+// portPageSize is how many learnings Each reads per query.
+const portPageSize = 500
+
 // NewBackend constructs the appropriate backend from config.
 func NewBackend(cfg *Config) (Backend, error) {
+	embedder, err := newEmbedder(cfg.embeddingConfig())
+	if err != nil {
+		return nil, fmt.Errorf("embedding: %w", err)
+	}
+	b, err := openBackend(cfg, embedder)
+	if err != nil {
+		return nil, err
+	}
+	if r, ok := b.(Reembedder); ok && embedder != nil {
+		warnStaleEmbeddings(r)
+	}
+	return b, nil
+}
+
+func openBackend(cfg *Config, embedder Embedder) (Backend, error) {
 	switch cfg.Backend.Type {
 	case "sqlite", "":
-		return NewSQLiteBackend(cfg.SQLite.Path)
+		return NewSQLiteBackend(cfg.SQLite, embedder)
 	case "chroma":
-		return NewChromaBackend(cfg.Chroma)
+		return NewChromaBackend(cfg.Chroma, embedder)
+	case "postgres":
+		return NewPostgresBackend(cfg.Postgres, embedder)
+	case "memory":
+		return NewMemoryBackend(cfg.Memory)
 	default:
 		return nil, nil
 	}
 }
+
+// affectedOne turns the result of a SQL UPDATE or DELETE by ID into the
+// not-found error Backend promises when no row matched.
+func affectedOne(res sql.Result, err error, id string) error {
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return fmt.Errorf("not found: %s", id)
+	}
+	return nil
+}
+
+// sameSecond reports whether two creation times agree to the second, the
+// coarsest any backend stores them: learnings with the same ID that agree
+// are the same learning.
+func sameSecond(a, b time.Time) bool {
+	return a.Unix() == b.Unix()
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -9,20 +11,28 @@ import (
 	"net/http"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
+// ChromaBackend keeps each namespace in its own collection: the configured
+// collection holds the default namespace, others get a suffixed one.
 type ChromaBackend struct {
-	cfg          ChromaConfig
-	httpClient   *http.Client
-	collectionID string // UUID returned by Chroma after create/get
+	cfg        ChromaConfig
+	httpClient *http.Client
+	embedder   Embedder // nil: chroma embeds with its default model
+
+	mu          sync.Mutex
+	collections map[string]string // namespace → collection UUID returned by Chroma after create/get
 }
 
 // ── Chroma v2 API types ───────────────────────────────────────────────────────
 
 type chromaCollection struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Dimension *int           `json:"dimension"` // fixed by the first embedding stored
+	Metadata  map[string]any `json:"metadata"`  // "namespace": the namespace it holds
 }
 
 type chromaAddRequest struct {
@@ -33,11 +43,11 @@ type chromaAddRequest struct {
 }
 
 type chromaQueryRequest struct {
-	QueryTexts      []string        `json:"query_texts,omitempty"`
-	QueryEmbeddings [][]float64     `json:"query_embeddings,omitempty"`
-	NResults        int             `json:"n_results"`
-	Where           map[string]any  `json:"where,omitempty"`
-	Include         []string        `json:"include,omitempty"`
+	QueryTexts      []string       `json:"query_texts,omitempty"`
+	QueryEmbeddings [][]float64    `json:"query_embeddings,omitempty"`
+	NResults        int            `json:"n_results"`
+	Where           map[string]any `json:"where,omitempty"`
+	Include         []string       `json:"include,omitempty"`
 }
 
 type chromaQueryResponse struct {
@@ -51,6 +61,7 @@ type chromaGetRequest struct {
 	IDs     []string       `json:"ids,omitempty"`
 	Where   map[string]any `json:"where,omitempty"`
 	Limit   int            `json:"limit,omitempty"`
+	Offset  int            `json:"offset,omitempty"`
 	Include []string       `json:"include,omitempty"`
 }
 
@@ -61,38 +72,31 @@ type chromaGetResponse struct {
 }
 
 type chromaUpdateRequest struct {
-	IDs       []string         `json:"ids"`
-	Documents []string         `json:"documents"`
-	Metadatas []map[string]any `json:"metadatas"`
+	IDs        []string         `json:"ids"`
+	Documents  []string         `json:"documents,omitempty"`
+	Metadatas  []map[string]any `json:"metadatas"`
+	Embeddings [][]float64      `json:"embeddings,omitempty"`
 }
 
 type chromaDeleteRequest struct {
 	IDs []string `json:"ids"`
 }
 
-// ── Ollama embedding types ────────────────────────────────────────────────────
-
-type ollamaEmbedRequest struct {
-	Model  string `json:"model"`
-	Prompt string `json:"prompt"`
-}
-
-type ollamaEmbedResponse struct {
-	Embedding []float64 `json:"embedding"`
-}
-
 // ── Constructor ───────────────────────────────────────────────────────────────
 
-func NewChromaBackend(cfg ChromaConfig) (*ChromaBackend, error) {
+func NewChromaBackend(cfg ChromaConfig, embedder Embedder) (*ChromaBackend, error) {
 	b := &ChromaBackend{
-		cfg:        cfg,
-		httpClient: &http.Client{Timeout: 30 * time.Second},
+		cfg:         cfg,
+		httpClient:  &http.Client{Timeout: 30 * time.Second},
+		embedder:    embedder,
+		collections: map[string]string{},
 	}
-	if err := b.ensureCollection(); err != nil {
+	id, err := b.collectionID(defaultNamespace)
+	if err != nil {
 		return nil, fmt.Errorf("chroma: ensure collection: %w", err)
 	}
 	log.Printf("chroma backend: %s (tenant=%s db=%s collection=%s id=%s)",
-		cfg.URL, cfg.Tenant, cfg.Database, cfg.Collection, b.collectionID)
+		cfg.URL, cfg.Tenant, cfg.Database, cfg.Collection, id)
 	return b, nil
 }
 
@@ -103,86 +107,123 @@ func (b *ChromaBackend) basePath() string {
 	return fmt.Sprintf("/api/v2/tenants/%s/databases/%s", b.cfg.Tenant, b.cfg.Database)
 }
 
-// colPath returns the base path + /collections/{collection_id} + suffix
-func (b *ChromaBackend) colPath(suffix string) string {
-	return fmt.Sprintf("%s/collections/%s%s", b.basePath(), b.collectionID, suffix)
+// colPath returns the base path + /collections/{collection_id} + suffix for
+// the namespace's collection, creating the collection on first use.
+func (b *ChromaBackend) colPath(namespace, suffix string) (string, error) {
+	id, err := b.collectionID(namespace)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s/collections/%s%s", b.basePath(), id, suffix), nil
 }
 
 // ── Collection management ─────────────────────────────────────────────────────
 
-func (b *ChromaBackend) ensureCollection() error {
+// collectionName maps a namespace to a valid Chroma collection name. Names
+// Chroma would reject (or that could collide) are replaced by a hash.
+func (b *ChromaBackend) collectionName(namespace string) string {
+	if namespace == defaultNamespace {
+		return b.cfg.Collection
+	}
+	safe := namespace != "" && len(namespace) <= 32 // older Chroma caps names at 63 characters
+	for _, r := range namespace {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+			safe = false
+			break
+		}
+	}
+	if !safe {
+		sum := sha256.Sum256([]byte(namespace))
+		return b.cfg.Collection + ".ns." + hex.EncodeToString(sum[:8])
+	}
+	return b.cfg.Collection + ".ns-" + namespace
+}
+
+func (b *ChromaBackend) collectionID(namespace string) (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if id, ok := b.collections[namespace]; ok {
+		return id, nil
+	}
+	id, err := b.ensureCollection(b.collectionName(namespace), map[string]any{"namespace": namespace})
+	if err != nil {
+		return "", err
+	}
+	b.collections[namespace] = id
+	return id, nil
+}
+
+func (b *ChromaBackend) ensureCollection(name string, metadata map[string]any) (string, error) {
 	// List collections and find by name
 	data, err := b.get(b.basePath() + "/collections")
 	if err == nil {
 		var cols []chromaCollection
 		if json.Unmarshal(data, &cols) == nil {
 			for _, c := range cols {
-				if c.Name == b.cfg.Collection {
-					b.collectionID = c.ID
-					return nil
+				if c.Name == name {
+					return c.ID, nil
 				}
 			}
 		}
 	}
 
 	// Create it
-	body, _ := json.Marshal(map[string]any{
-		"name":          b.cfg.Collection,
+	req := map[string]any{
+		"name":          name,
 		"get_or_create": true,
-	})
+	}
+	if len(metadata) > 0 {
+		req["metadata"] = metadata
+	}
+	body, _ := json.Marshal(req)
 	resp, err := b.post(b.basePath()+"/collections", body)
 	if err != nil {
-		return err
+		return "", err
 	}
 	var col chromaCollection
 	if err := json.Unmarshal(resp, &col); err != nil {
-		return fmt.Errorf("parse create collection response: %w", err)
+		return "", fmt.Errorf("parse create collection response: %w", err)
 	}
-	b.collectionID = col.ID
-	return nil
+	return col.ID, nil
 }
 
 // ── Backend interface ─────────────────────────────────────────────────────────
 
-func (b *ChromaBackend) Add(category, content, tags string, confidence float64) (*Learning, error) {
+func (b *ChromaBackend) Add(namespace, category, content, tags string, confidence float64, source Source) (*Learning, error) {
 	now := time.Now()
-	id := fmt.Sprintf("%d", now.UnixNano())
+	l := &Learning{
+		ID: fmt.Sprintf("%d", now.UnixNano()), Namespace: namespace, Category: category, Content: content,
+		Tags: tags, Confidence: confidence, CreatedAt: now, UpdatedAt: now, Source: source,
+	}
 
 	req := chromaAddRequest{
-		IDs:       []string{id},
+		IDs:       []string{l.ID},
 		Documents: []string{content},
-		Metadatas: []map[string]any{{
-			"category":   category,
-			"tags":       tags,
-			"confidence": confidence,
-			"use_count":  0,
-			"created_at": now.Format(time.RFC3339),
-			"updated_at": now.Format(time.RFC3339),
-		}},
+		Metadatas: []map[string]any{chromaMetadata(l)},
 	}
 
-	if b.cfg.EmbeddingModel != "" {
+	if b.embedder != nil {
 		emb, err := b.embed(content)
 		if err != nil {
 			log.Printf("embedding failed (storing without): %v", err)
 		} else {
 			req.Embeddings = [][]float64{emb}
+			b.recordEmbedder(req.Metadatas[0], emb)
 		}
 	}
 
+	path, err := b.colPath(namespace, "/add")
+	if err != nil {
+		return nil, err
+	}
 	body, _ := json.Marshal(req)
-	if _, err := b.post(b.colPath("/add"), body); err != nil {
+	if _, err := b.post(path, body); err != nil {
 		return nil, err
 	}
-
-	return &Learning{
-		ID: id, Category: category, Content: content,
-		Tags: tags, Confidence: confidence,
-		CreatedAt: now, UpdatedAt: now,
-	}, nil
+	return l, nil
 }
 
-func (b *ChromaBackend) Search(query, category string, limit int) ([]*Learning, error) {
+func (b *ChromaBackend) Search(namespace, query, category string, limit int) ([]*Learning, error) {
 	if limit <= 0 {
 		limit = 10
 	}
@@ -192,7 +233,7 @@ func (b *ChromaBackend) Search(query, category string, limit int) ([]*Learning,
 		Include:  []string{"documents", "metadatas", "distances"},
 	}
 
-	if b.cfg.EmbeddingModel != "" {
+	if b.embedder != nil {
 		emb, err := b.embed(query)
 		if err != nil {
 			log.Printf("query embedding failed, falling back to text: %v", err)
@@ -204,12 +245,14 @@ func (b *ChromaBackend) Search(query, category string, limit int) ([]*Learning,
 		req.QueryTexts = []string{query}
 	}
 
-	if category != "" {
-		req.Where = map[string]any{"category": map[string]any{"$eq": category}}
-	}
+	req.Where = chromaVisible(category)
 
+	path, err := b.colPath(namespace, "/query")
+	if err != nil {
+		return nil, err
+	}
 	body, _ := json.Marshal(req)
-	data, err := b.post(b.colPath("/query"), body)
+	data, err := b.post(path, body)
 	if err != nil {
 		return nil, err
 	}
@@ -222,24 +265,32 @@ func (b *ChromaBackend) Search(query, category string, limit int) ([]*Learning,
 		return nil, nil
 	}
 
-	return chromaResultsToLearnings(resp.IDs[0], resp.Documents[0], resp.Metadatas[0]), nil
+	// Chroma only ranks by vector; record that as the results' Match
+	learnings := chromaResultsToLearnings(namespace, resp.IDs[0], resp.Documents[0], resp.Metadatas[0])
+	return fuseRRF(nil, learnings, defaultRRFK, limit), nil
 }
 
-func (b *ChromaBackend) List(category string, limit int) ([]*Learning, error) {
+func (b *ChromaBackend) List(namespace, category, source string, limit int) ([]*Learning, error) {
 	if limit <= 0 {
 		limit = 50
 	}
 
+	// Chroma returns documents in insertion order, so the newest can only
+	// be found by fetching them all
 	req := chromaGetRequest{
-		Limit:   limit,
 		Include: []string{"documents", "metadatas"},
+		Where:   chromaVisible(category),
 	}
-	if category != "" {
-		req.Where = map[string]any{"category": map[string]any{"$eq": category}}
+	if source != "" {
+		req.Where = map[string]any{"$and": []any{req.Where, chromaFromSource(source)}}
 	}
 
+	path, err := b.colPath(namespace, "/get")
+	if err != nil {
+		return nil, err
+	}
 	body, _ := json.Marshal(req)
-	data, err := b.post(b.colPath("/get"), body)
+	data, err := b.post(path, body)
 	if err != nil {
 		return nil, err
 	}
@@ -249,74 +300,90 @@ func (b *ChromaBackend) List(category string, limit int) ([]*Learning, error) {
 		return nil, err
 	}
 
-	learnings := chromaGetToLearnings(resp)
+	learnings := chromaGetToLearnings(namespace, resp)
 	sortByUpdated(learnings)
+	if len(learnings) > limit {
+		learnings = learnings[:limit]
+	}
 	return learnings, nil
 }
 
-func (b *ChromaBackend) Update(id, content, tags string, confidence float64) error {
+func (b *ChromaBackend) Get(namespace, id string) (*Learning, error) {
+	return b.getByID(namespace, id)
+}
+
+func (b *ChromaBackend) Update(namespace, id, content, tags string, confidence float64, source Source) error {
 	now := time.Now()
 
-	existing, _ := b.getByID(id)
-	useCount := 0
-	category := "general"
-	createdAt := now.Format(time.RFC3339)
-	if existing != nil {
-		useCount = existing.UseCount
-		category = existing.Category
-		createdAt = existing.CreatedAt.Format(time.RFC3339)
+	// Chroma's update ignores unknown IDs, so look the learning up first;
+	// that also carries over the fields update would otherwise drop
+	existing, err := b.getByID(namespace, id)
+	if err != nil {
+		return err
 	}
+	previous := copyLearning(existing)
 
+	existing.Content, existing.Tags, existing.Confidence, existing.UpdatedAt = content, tags, confidence, now
+	existing.Source = source
 	req := chromaUpdateRequest{
 		IDs:       []string{id},
 		Documents: []string{content},
-		Metadatas: []map[string]any{{
-			"category":   category,
-			"tags":       tags,
-			"confidence": confidence,
-			"use_count":  useCount,
-			"created_at": createdAt,
-			"updated_at": now.Format(time.RFC3339),
-		}},
+		Metadatas: []map[string]any{chromaMetadata(existing)},
+	}
+	if b.embedder != nil {
+		emb, err := b.embed(content)
+		if err != nil {
+			log.Printf("embedding failed for learning %s (keeping the old one): %v", id, err)
+		} else {
+			req.Embeddings = [][]float64{emb}
+			b.recordEmbedder(req.Metadatas[0], emb)
+		}
+	}
+
+	if previous.Content != content || previous.Tags != tags || previous.Confidence != confidence {
+		if err := b.addRevision(namespace, previous, req.Embeddings); err != nil {
+			return fmt.Errorf("saving revision: %w", err)
+		}
 	}
 
+	path, err := b.colPath(namespace, "/update")
+	if err != nil {
+		return err
+	}
 	body, _ := json.Marshal(req)
-	_, err := b.post(b.colPath("/update"), body)
+	_, err = b.post(path, body)
 	return err
 }
 
-func (b *ChromaBackend) Delete(id string) error {
-	req := chromaDeleteRequest{IDs: []string{id}}
-	body, _ := json.Marshal(req)
-	_, err := b.post(b.colPath("/delete"), body)
-	return err
+// Delete moves the learning to the trash by flagging it in its metadata;
+// Purge removes it for good.
+func (b *ChromaBackend) Delete(namespace, id string) error {
+	existing, err := b.getByID(namespace, id)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	existing.DeletedAt = &now
+	return b.saveMetadata(namespace, existing)
 }
 
-func (b *ChromaBackend) IncrementUseCount(id string) {
-	existing, err := b.getByID(id)
-	if err != nil || existing == nil {
+func (b *ChromaBackend) IncrementUseCount(namespace, id string) {
+	existing, err := b.getByID(namespace, id)
+	if err != nil {
 		return
 	}
-	req := chromaUpdateRequest{
-		IDs:       []string{id},
-		Documents: []string{existing.Content},
-		Metadatas: []map[string]any{{
-			"category":   existing.Category,
-			"tags":       existing.Tags,
-			"confidence": existing.Confidence,
-			"use_count":  existing.UseCount + 1,
-			"created_at": existing.CreatedAt.Format(time.RFC3339),
-			"updated_at": existing.UpdatedAt.Format(time.RFC3339),
-		}},
-	}
-	body, _ := json.Marshal(req)
-	b.post(b.colPath("/update"), body)
+	existing.UseCount++
+	b.saveMetadata(namespace, existing)
 }
 
-func (b *ChromaBackend) Stats() (map[string]int, error) {
-	req := chromaGetRequest{Include: []string{"metadatas"}}
+func (b *ChromaBackend) Stats(namespace string) (map[string]int, error) {
+	path, err := b.colPath(namespace, "/get")
+	if err != nil {
+		return nil, err
+	}
+	req := chromaGetRequest{Include: []string{"metadatas"}, Where: chromaVisible("")}
 	body, _ := json.Marshal(req)
-	data, err := b.post(b.colPath("/get"), body)
+	data, err := b.post(path, body)
 	if err != nil {
 		return nil, err
 	}
@@ -337,15 +404,593 @@ func (b *ChromaBackend) Stats() (map[string]int, error) {
 
 func (b *ChromaBackend) Close() error { return nil }
 
+// ── Trash ─────────────────────────────────────────────────────────────────────
+
+func (b *ChromaBackend) Trash(namespace, category string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	resp, err := b.trashDocs(namespace, category)
+	if err != nil {
+		return nil, err
+	}
+	learnings := chromaGetToLearnings(namespace, resp)
+	sort.Slice(learnings, func(i, j int) bool { return learnings[i].DeletedAt.After(*learnings[j].DeletedAt) })
+	if len(learnings) > limit {
+		learnings = learnings[:limit]
+	}
+	return learnings, nil
+}
+
+func (b *ChromaBackend) Restore(namespace, id string) error {
+	l, err := b.fetch(namespace, id)
+	if err != nil {
+		return err
+	}
+	if l.DeletedAt == nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	l.DeletedAt = nil
+	return b.saveMetadata(namespace, l)
+}
+
+func (b *ChromaBackend) Purge(namespace string, cutoff time.Time) (int, error) {
+	resp, err := b.trashDocs(namespace, "")
+	if err != nil {
+		return 0, err
+	}
+	var ids []any
+	for _, l := range chromaGetToLearnings(namespace, resp) {
+		if l.DeletedAt.Before(cutoff) {
+			ids = append(ids, l.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// Take the purged learnings' revisions with them
+	path, err := b.colPath(namespace, "/get")
+	if err != nil {
+		return 0, err
+	}
+	body, _ := json.Marshal(chromaGetRequest{Where: map[string]any{"revision_of": map[string]any{"$in": ids}}})
+	data, err := b.post(path, body)
+	if err != nil {
+		return 0, err
+	}
+	var revisions chromaGetResponse
+	if err := json.Unmarshal(data, &revisions); err != nil {
+		return 0, err
+	}
+	req := chromaDeleteRequest{IDs: revisions.IDs}
+	for _, id := range ids {
+		req.IDs = append(req.IDs, id.(string))
+	}
+	if path, err = b.colPath(namespace, "/delete"); err != nil {
+		return 0, err
+	}
+	body, _ = json.Marshal(req)
+	if _, err := b.post(path, body); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// trashDocs returns the namespace's deleted learnings, those outside
+// category aside unless it is "". Revisions are never flagged deleted, even
+// those of a deleted learning.
+func (b *ChromaBackend) trashDocs(namespace, category string) (chromaGetResponse, error) {
+	var resp chromaGetResponse
+	path, err := b.colPath(namespace, "/get")
+	if err != nil {
+		return resp, err
+	}
+	req := chromaGetRequest{
+		Where:   map[string]any{"deleted": map[string]any{"$eq": true}},
+		Include: []string{"documents", "metadatas"},
+	}
+	if category != "" {
+		req.Where = map[string]any{"$and": []any{
+			req.Where,
+			map[string]any{"category": map[string]any{"$eq": category}},
+		}}
+	}
+	body, _ := json.Marshal(req)
+	data, err := b.post(path, body)
+	if err != nil {
+		return resp, err
+	}
+	err = json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// ── Revisions ─────────────────────────────────────────────────────────────────
+
+// Each revision is a hidden document in its learning's collection, with the
+// learning's ID and the revision number in its metadata.
+
+func (b *ChromaBackend) Revisions(namespace, id string) ([]*Revision, error) {
+	resp, err := b.revisionDocs(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	var revisions []*Revision
+	for i := range resp.IDs {
+		meta := resp.Metadatas[i]
+		l := metaToLearning(namespace, resp.IDs[i], resp.Documents[i], meta)
+		n, _ := meta["revision"].(float64)
+		revisions = append(revisions, &Revision{
+			Number: int(n), Content: l.Content, Tags: l.Tags, Confidence: l.Confidence, UpdatedAt: l.UpdatedAt,
+		})
+	}
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Number < revisions[j].Number })
+	return revisions, nil
+}
+
+func (b *ChromaBackend) revisionDocs(namespace, id string) (chromaGetResponse, error) {
+	var resp chromaGetResponse
+	path, err := b.colPath(namespace, "/get")
+	if err != nil {
+		return resp, err
+	}
+	req := chromaGetRequest{
+		Where:   map[string]any{"revision_of": map[string]any{"$eq": id}},
+		Include: []string{"documents", "metadatas"},
+	}
+	body, _ := json.Marshal(req)
+	data, err := b.post(path, body)
+	if err != nil {
+		return resp, err
+	}
+	err = json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+// addRevision stores l as its next revision. The collection needs an
+// embedding of its dimension for every document, so the revision reuses
+// the embedding of the update replacing it; being hidden, it is never
+// ranked by it.
+func (b *ChromaBackend) addRevision(namespace string, l *Learning, embeddings [][]float64) error {
+	existing, err := b.revisionDocs(namespace, l.ID)
+	if err != nil {
+		return err
+	}
+	return b.putRevision(namespace, l, len(existing.IDs)+1, embeddings)
+}
+
+// putRevision stores l as revision n of itself.
+func (b *ChromaBackend) putRevision(namespace string, l *Learning, n int, embeddings [][]float64) error {
+	meta := chromaMetadata(l)
+	meta["revision_of"] = l.ID
+	meta["revision"] = n
+	meta["hidden"] = true
+	req := chromaAddRequest{
+		IDs:        []string{fmt.Sprintf("%s.r%d", l.ID, n)},
+		Documents:  []string{l.Content},
+		Metadatas:  []map[string]any{meta},
+		Embeddings: embeddings,
+	}
+	if len(embeddings) > 0 {
+		b.recordEmbedder(meta, embeddings[0])
+	}
+	path, err := b.colPath(namespace, "/upsert")
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(req)
+	_, err = b.post(path, body)
+	return err
+}
+
+// deleteRevisions removes every revision of the learning with this ID.
+func (b *ChromaBackend) deleteRevisions(namespace, id string) error {
+	existing, err := b.revisionDocs(namespace, id)
+	if err != nil || len(existing.IDs) == 0 {
+		return err
+	}
+	path, err := b.colPath(namespace, "/delete")
+	if err != nil {
+		return err
+	}
+	body, _ := json.Marshal(chromaDeleteRequest{IDs: existing.IDs})
+	_, err = b.post(path, body)
+	return err
+}
+
+func (b *ChromaBackend) PutRevisions(namespace, id string, revs []*Revision) error {
+	l, err := b.fetch(namespace, id)
+	if err != nil {
+		return err
+	}
+	if err := b.deleteRevisions(namespace, id); err != nil {
+		return err
+	}
+	var embeddings [][]float64
+	if b.embedder != nil && len(revs) > 0 {
+		emb, err := b.embed(l.Content)
+		if err != nil {
+			return fmt.Errorf("embedding learning %s: %w", id, err)
+		}
+		embeddings = [][]float64{emb}
+	}
+	for _, r := range revs {
+		rev := copyLearning(l)
+		rev.Content, rev.Tags, rev.Confidence, rev.UpdatedAt = r.Content, r.Tags, r.Confidence, r.UpdatedAt
+		if err := b.putRevision(namespace, rev, r.Number, embeddings); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ── Re-embedding ──────────────────────────────────────────────────────────────
+
+const (
+	chromaPageSize      = 100
+	chromaRebuildSuffix = ".reembed" // collection a rebuild copies into
+)
+
+// ownCollections lists the collections holding this backend's namespaces.
+// A rebuild interrupted between dropping a collection and renaming its copy
+// is finished here.
+func (b *ChromaBackend) ownCollections() ([]chromaCollection, error) {
+	data, err := b.get(b.basePath() + "/collections")
+	if err != nil {
+		return nil, err
+	}
+	var all []chromaCollection
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("parse collections: %w", err)
+	}
+	own := func(name string) bool {
+		return name == b.cfg.Collection || strings.HasPrefix(name, b.cfg.Collection+".ns")
+	}
+	names := map[string]bool{}
+	for _, c := range all {
+		names[c.Name] = true
+	}
+	var cols []chromaCollection
+	for _, c := range all {
+		base, rebuilding := strings.CutSuffix(c.Name, chromaRebuildSuffix)
+		switch {
+		case rebuilding && own(base) && !names[base]:
+			if err := b.renameCollection(c.ID, base); err != nil {
+				return nil, err
+			}
+			c.Name = base
+			cols = append(cols, c)
+		case !rebuilding && own(c.Name):
+			cols = append(cols, c)
+		}
+	}
+	return cols, nil
+}
+
+func (b *ChromaBackend) renameCollection(id, name string) error {
+	body, _ := json.Marshal(map[string]any{"new_name": name})
+	if _, err := b.send(http.MethodPut, b.basePath()+"/collections/"+id, body); err != nil {
+		return err
+	}
+	b.mu.Lock()
+	b.collections = map[string]string{}
+	b.mu.Unlock()
+	return nil
+}
+
+// page returns up to chromaPageSize documents of a collection from offset.
+func (b *ChromaBackend) page(collectionID string, offset int) (chromaGetResponse, error) {
+	var resp chromaGetResponse
+	req := chromaGetRequest{Limit: chromaPageSize, Offset: offset, Include: []string{"documents", "metadatas"}}
+	body, _ := json.Marshal(req)
+	data, err := b.post(b.basePath()+"/collections/"+collectionID+"/get", body)
+	if err != nil {
+		return resp, err
+	}
+	err = json.Unmarshal(data, &resp)
+	return resp, err
+}
+
+func (b *ChromaBackend) Embedder() Embedder { return b.embedder }
+
+// EmbeddingModels counts learnings in every namespace by the embedder that
+// made their embedding; "" counts those without a recorded one. Revisions
+// are left out, as Reembed leaves them be; learnings in the trash count,
+// as in the SQL backends, so a restored one comes back embedded.
+func (b *ChromaBackend) EmbeddingModels() (map[string]int, error) {
+	cols, err := b.ownCollections()
+	if err != nil {
+		return nil, err
+	}
+	models := map[string]int{}
+	for _, c := range cols {
+		for offset := 0; ; offset += chromaPageSize {
+			page, err := b.page(c.ID, offset)
+			if err != nil {
+				return nil, err
+			}
+			for _, meta := range page.Metadatas {
+				if meta["revision_of"] != nil {
+					continue
+				}
+				model, _ := meta["embedding_model"].(string)
+				models[model]++
+			}
+			if len(page.IDs) < chromaPageSize {
+				break
+			}
+		}
+	}
+	return models, nil
+}
+
+// Reembed embeds the next batch of documents whose embedding is missing or
+// came from another embedder, one collection at a time.
+func (b *ChromaBackend) Reembed(batch int) (int, error) {
+	if b.embedder == nil {
+		return 0, fmt.Errorf("no embedder configured")
+	}
+	dims := b.embedder.Dimensions()
+	if dims == 0 {
+		probe, err := b.embed("dimension probe")
+		if err != nil {
+			return 0, err
+		}
+		dims = len(probe)
+	}
+	cols, err := b.ownCollections()
+	if err != nil {
+		return 0, err
+	}
+	for _, c := range cols {
+		var n int
+		if c.Dimension != nil && *c.Dimension != dims {
+			n, err = b.rebuildCollection(c, batch)
+		} else {
+			n, err = b.reembedCollection(c, batch)
+		}
+		if err != nil || n > 0 {
+			return n, err
+		}
+	}
+	return 0, nil
+}
+
+// reembedCollection re-embeds the next batch of a collection's stale
+// learnings in place. Revisions keep the embedding they were stored with:
+// it only fills the collection's slot and is never ranked.
+func (b *ChromaBackend) reembedCollection(c chromaCollection, batch int) (int, error) {
+	var req chromaUpdateRequest
+	var texts []string
+	for offset := 0; len(req.IDs) < batch; offset += chromaPageSize {
+		page, err := b.page(c.ID, offset)
+		if err != nil {
+			return 0, err
+		}
+		for i, id := range page.IDs {
+			meta := page.Metadatas[i]
+			if meta["revision_of"] == nil && meta["embedding_model"] != b.embedder.Name() && len(req.IDs) < batch {
+				req.IDs = append(req.IDs, id)
+				req.Metadatas = append(req.Metadatas, meta)
+				texts = append(texts, page.Documents[i])
+			}
+		}
+		if len(page.IDs) < chromaPageSize {
+			break
+		}
+	}
+	if len(req.IDs) == 0 {
+		return 0, nil
+	}
+	vectors, err := b.embedder.Embed(texts)
+	if err != nil {
+		return 0, err
+	}
+	req.Embeddings = vectors
+	for i, meta := range req.Metadatas {
+		b.recordEmbedder(meta, vectors[i])
+	}
+	body, _ := json.Marshal(req)
+	if _, err := b.post(b.basePath()+"/collections/"+c.ID+"/update", body); err != nil {
+		return 0, err
+	}
+	return len(req.IDs), nil
+}
+
+// rebuildCollection handles a dimension change, which Chroma can't apply in
+// place: each call copies the next batch of documents, re-embedded, into a
+// fresh collection, and once all are copied the copy replaces the original.
+func (b *ChromaBackend) rebuildCollection(c chromaCollection, batch int) (int, error) {
+	copyID, err := b.ensureCollection(c.Name+chromaRebuildSuffix, c.Metadata)
+	if err != nil {
+		return 0, err
+	}
+	var req chromaAddRequest
+	for offset := 0; len(req.IDs) < batch; offset += chromaPageSize {
+		page, err := b.page(c.ID, offset)
+		if err != nil {
+			return 0, err
+		}
+		copied := map[string]bool{}
+		if len(page.IDs) > 0 {
+			body, _ := json.Marshal(chromaGetRequest{IDs: page.IDs, Include: []string{"metadatas"}})
+			data, err := b.post(b.basePath()+"/collections/"+copyID+"/get", body)
+			if err != nil {
+				return 0, err
+			}
+			var have chromaGetResponse
+			if err := json.Unmarshal(data, &have); err != nil {
+				return 0, err
+			}
+			for _, id := range have.IDs {
+				copied[id] = true
+			}
+		}
+		for i, id := range page.IDs {
+			if !copied[id] && len(req.IDs) < batch {
+				req.IDs = append(req.IDs, id)
+				req.Documents = append(req.Documents, page.Documents[i])
+				req.Metadatas = append(req.Metadatas, page.Metadatas[i])
+			}
+		}
+		if len(page.IDs) < chromaPageSize {
+			break
+		}
+	}
+
+	if len(req.IDs) > 0 {
+		vectors, err := b.embedder.Embed(req.Documents)
+		if err != nil {
+			return 0, err
+		}
+		req.Embeddings = vectors
+		for i, meta := range req.Metadatas {
+			b.recordEmbedder(meta, vectors[i])
+		}
+		body, _ := json.Marshal(req)
+		if _, err := b.post(b.basePath()+"/collections/"+copyID+"/add", body); err != nil {
+			return 0, err
+		}
+		return len(req.IDs), nil
+	}
+
+	if _, err := b.send(http.MethodDelete, b.basePath()+"/collections/"+c.Name, nil); err != nil {
+		return 0, err
+	}
+	if err := b.renameCollection(copyID, c.Name); err != nil {
+		return 0, err
+	}
+	log.Printf("chroma: rebuilt collection %s with %s embeddings", c.Name, b.embedder.Name())
+	return 0, nil
+}
+
+// ── Bulk transfer ─────────────────────────────────────────────────────────────
+
+// Namespaces reads each collection's namespace from its metadata. Collections
+// created before that was recorded are named after their namespace, unless
+// the name had to be hashed; those are skipped with a warning.
+func (b *ChromaBackend) Namespaces() ([]string, error) {
+	cols, err := b.ownCollections()
+	if err != nil {
+		return nil, err
+	}
+	var namespaces []string
+	for _, c := range cols {
+		ns, ok := c.Metadata["namespace"].(string)
+		switch {
+		case ok:
+		case c.Name == b.cfg.Collection:
+			ns = defaultNamespace
+		case strings.HasPrefix(c.Name, b.cfg.Collection+".ns-"):
+			ns = strings.TrimPrefix(c.Name, b.cfg.Collection+".ns-")
+		default:
+			log.Printf("chroma: skipping collection %s: its namespace isn't recorded", c.Name)
+			continue
+		}
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func (b *ChromaBackend) Each(namespace string, fn func(*Learning) error) error {
+	id, err := b.collectionID(namespace)
+	if err != nil {
+		return err
+	}
+	for offset := 0; ; offset += chromaPageSize {
+		page, err := b.page(id, offset)
+		if err != nil {
+			return err
+		}
+		for i, l := range chromaGetToLearnings(namespace, page) {
+			if i < len(page.Metadatas) && page.Metadatas[i]["revision_of"] != nil {
+				continue
+			}
+			if err := fn(l); err != nil {
+				return err
+			}
+		}
+		if len(page.IDs) < chromaPageSize {
+			return nil
+		}
+	}
+}
+
+// Put keeps any ID: each namespace has a collection of its own.
+func (b *ChromaBackend) Put(l *Learning) (*Learning, error) {
+	stored := copyLearning(l)
+	if stored.ID == "" {
+		stored.ID = fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	var previous *Learning
+	if old, err := b.fetch(stored.Namespace, stored.ID); err == nil {
+		if !sameSecond(old.CreatedAt, stored.CreatedAt) {
+			// A different learning: its history goes with it
+			if err := b.deleteRevisions(stored.Namespace, stored.ID); err != nil {
+				return nil, err
+			}
+		} else if old.Content != stored.Content || old.Tags != stored.Tags || old.Confidence != stored.Confidence {
+			previous = old
+		}
+	}
+	req := chromaAddRequest{
+		IDs:       []string{stored.ID},
+		Documents: []string{stored.Content},
+		Metadatas: []map[string]any{chromaMetadata(stored)},
+	}
+	if b.embedder != nil {
+		emb, err := b.embed(stored.Content)
+		if err != nil {
+			log.Printf("embedding failed for learning %s (storing without): %v", stored.ID, err)
+		} else {
+			req.Embeddings = [][]float64{emb}
+			b.recordEmbedder(req.Metadatas[0], emb)
+		}
+	}
+	if previous != nil {
+		if err := b.addRevision(stored.Namespace, previous, req.Embeddings); err != nil {
+			return nil, fmt.Errorf("saving revision: %w", err)
+		}
+	}
+	path, err := b.colPath(stored.Namespace, "/upsert")
+	if err != nil {
+		return nil, err
+	}
+	body, _ := json.Marshal(req)
+	if _, err := b.post(path, body); err != nil {
+		return nil, err
+	}
+	return stored, nil
+}
+
 // ── Internal helpers ──────────────────────────────────────────────────────────
 
-func (b *ChromaBackend) getByID(id string) (*Learning, error) {
+// getByID returns a learning that isn't in the trash.
+func (b *ChromaBackend) getByID(namespace, id string) (*Learning, error) {
+	l, err := b.fetch(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	if l.DeletedAt != nil {
+		return nil, fmt.Errorf("not found: %s", id)
+	}
+	return l, nil
+}
+
+// fetch returns a learning whether or not it is in the trash, but never a
+// revision.
+func (b *ChromaBackend) fetch(namespace, id string) (*Learning, error) {
+	path, err := b.colPath(namespace, "/get")
+	if err != nil {
+		return nil, err
+	}
 	req := chromaGetRequest{
 		IDs:     []string{id},
 		Include: []string{"documents", "metadatas"},
 	}
 	body, _ := json.Marshal(req)
-	data, err := b.post(b.colPath("/get"), body)
+	data, err := b.post(path, body)
 	if err != nil {
 		return nil, err
 	}
@@ -353,26 +998,57 @@ func (b *ChromaBackend) getByID(id string) (*Learning, error) {
 	if err := json.Unmarshal(data, &resp); err != nil {
 		return nil, err
 	}
-	results := chromaGetToLearnings(resp)
-	if len(results) == 0 {
+	results := chromaGetToLearnings(namespace, resp)
+	if len(results) == 0 || len(resp.Metadatas) > 0 && resp.Metadatas[0]["revision_of"] != nil {
 		return nil, fmt.Errorf("not found: %s", id)
 	}
 	return results[0], nil
 }
 
-func (b *ChromaBackend) embed(text string) ([]float64, error) {
-	req := ollamaEmbedRequest{Model: b.cfg.EmbeddingModel, Prompt: text}
+// saveMetadata rewrites a learning's metadata, keeping its embedding.
+func (b *ChromaBackend) saveMetadata(namespace string, l *Learning) error {
+	path, err := b.colPath(namespace, "/update")
+	if err != nil {
+		return err
+	}
+	req := chromaUpdateRequest{
+		IDs:       []string{l.ID},
+		Documents: []string{l.Content},
+		Metadatas: []map[string]any{chromaMetadata(l)},
+	}
 	body, _ := json.Marshal(req)
-	resp, err := b.httpClient.Post(b.cfg.OllamaURL+"/api/embeddings", "application/json", bytes.NewReader(body))
+	_, err = b.post(path, body)
+	return err
+}
+
+func (b *ChromaBackend) embed(text string) ([]float64, error) {
+	return embedOne(b.embedder, text)
+}
+
+// recordEmbedder notes in a document's metadata which embedder made its
+// embedding, so a model change can be detected and repaired.
+func (b *ChromaBackend) recordEmbedder(meta map[string]any, emb []float64) {
+	meta["embedding_model"] = b.embedder.Name()
+	meta["embedding_dims"] = len(emb)
+}
+
+// send issues a request with any other method, e.g. PUT or DELETE.
+func (b *ChromaBackend) send(method, path string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, b.cfg.URL+path, bytes.NewReader(body))
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
-	var embedResp ollamaEmbedResponse
-	if err := json.NewDecoder(resp.Body).Decode(&embedResp); err != nil {
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := b.httpClient.Do(req)
+	if err != nil {
 		return nil, err
 	}
-	return embedResp.Embedding, nil
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("chroma %s %s → %d: %s", method, path, resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return data, nil
 }
 
 func (b *ChromaBackend) get(path string) ([]byte, error) {
@@ -403,15 +1079,68 @@ func (b *ChromaBackend) post(path string, body []byte) ([]byte, error) {
 
 // ── Conversion helpers ────────────────────────────────────────────────────────
 
-func chromaResultsToLearnings(ids, docs []string, metas []map[string]any) []*Learning {
+// chromaMetadata is the metadata a learning is stored with. Superseded and
+// deleted learnings are also flagged hidden, which chromaVisible filters on:
+// documents stored before the flag existed lack it, and "$ne": true matches
+// those too, where no filter could match both a missing and an empty
+// superseded_by.
+func chromaMetadata(l *Learning) map[string]any {
+	deletedAt := ""
+	if l.DeletedAt != nil {
+		deletedAt = l.DeletedAt.Format(time.RFC3339Nano)
+	}
+	return map[string]any{
+		"category":      l.Category,
+		"tags":          l.Tags,
+		"confidence":    l.Confidence,
+		"use_count":     l.UseCount,
+		"created_at":    l.CreatedAt.Format(time.RFC3339Nano),
+		"updated_at":    l.UpdatedAt.Format(time.RFC3339Nano),
+		"superseded_by": l.SupersededBy,
+		"deleted_at":    deletedAt,
+		"deleted":       l.DeletedAt != nil,
+		"hidden":        l.SupersededBy != "" || l.DeletedAt != nil,
+
+		"source_client":         l.Source.Client,
+		"source_client_version": l.Source.ClientVersion,
+		"source_session":        l.Source.Session,
+		"source_conversation":   l.Source.Conversation,
+		"source_author":         l.Source.Author,
+	}
+}
+
+// chromaVisible is the filter that leaves out superseded and deleted
+// learnings, and those outside category unless it is "".
+func chromaVisible(category string) map[string]any {
+	visible := map[string]any{"hidden": map[string]any{"$ne": true}}
+	if category == "" {
+		return visible
+	}
+	return map[string]any{"$and": []any{
+		visible,
+		map[string]any{"category": map[string]any{"$eq": category}},
+	}}
+}
+
+// chromaFromSource is the filter that keeps learnings source matches, as
+// Source.Matches does.
+func chromaFromSource(source string) map[string]any {
+	var matches []any
+	for _, key := range []string{"source_client", "source_session", "source_conversation", "source_author"} {
+		matches = append(matches, map[string]any{key: map[string]any{"$eq": source}})
+	}
+	return map[string]any{"$or": matches}
+}
+
+func chromaResultsToLearnings(namespace string, ids, docs []string, metas []map[string]any) []*Learning {
 	var out []*Learning
 	for i := range ids {
-		out = append(out, metaToLearning(ids[i], docs[i], metas[i]))
+		out = append(out, metaToLearning(namespace, ids[i], docs[i], metas[i]))
 	}
 	return out
 }
 
-func chromaGetToLearnings(resp chromaGetResponse) []*Learning {
+func chromaGetToLearnings(namespace string, resp chromaGetResponse) []*Learning {
 	var out []*Learning
 	for i := range resp.IDs {
 		doc := ""
@@ -422,13 +1151,13 @@ func chromaGetToLearnings(resp chromaGetResponse) []*Learning {
 		if i < len(resp.Metadatas) {
 			meta = resp.Metadatas[i]
 		}
-		out = append(out, metaToLearning(resp.IDs[i], doc, meta))
+		out = append(out, metaToLearning(namespace, resp.IDs[i], doc, meta))
 	}
 	return out
 }
 
-func metaToLearning(id, doc string, meta map[string]any) *Learning {
-	l := &Learning{ID: id, Content: doc}
+func metaToLearning(namespace, id, doc string, meta map[string]any) *Learning {
+	l := &Learning{ID: id, Namespace: namespace, Content: doc}
 	if v, ok := meta["category"].(string); ok {
 		l.Category = v
 	}
@@ -456,6 +1185,25 @@ func metaToLearning(id, doc string, meta map[string]any) *Learning {
 			l.UpdatedAt = t
 		}
 	}
+	if v, ok := meta["superseded_by"].(string); ok {
+		l.SupersededBy = v
+	}
+	if v, ok := meta["deleted_at"].(string); ok && v != "" {
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			l.DeletedAt = &t
+		}
+	}
+	for key, field := range map[string]*string{
+		"source_client":         &l.Source.Client,
+		"source_client_version": &l.Source.ClientVersion,
+		"source_session":        &l.Source.Session,
+		"source_conversation":   &l.Source.Conversation,
+		"source_author":         &l.Source.Author,
+	} {
+		if v, ok := meta[key].(string); ok {
+			*field = v
+		}
+	}
 	return l
 }
 
@@ -0,0 +1,419 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// MemoryBackend keeps learnings in process memory. It needs no setup, which
+// suits tests and ephemeral deployments; with a snapshot path it is written
+// to disk on Close and read back on start.
+type MemoryBackend struct {
+	cfg MemoryConfig
+
+	mu        sync.RWMutex
+	learnings map[memoryKey]*Learning
+	revisions map[memoryKey][]*Revision
+	nextID    int64
+}
+
+type memoryKey struct {
+	namespace, id string
+}
+
+// memorySnapshot is the on-disk form of a MemoryBackend. Revisions are
+// keyed by namespace, then learning ID.
+type memorySnapshot struct {
+	NextID    int64                             `json:"next_id"`
+	Learnings []*Learning                       `json:"learnings"`
+	Revisions map[string]map[string][]*Revision `json:"revisions,omitempty"`
+}
+
+func NewMemoryBackend(cfg MemoryConfig) (*MemoryBackend, error) {
+	m := &MemoryBackend{cfg: cfg, learnings: map[memoryKey]*Learning{}, revisions: map[memoryKey][]*Revision{}, nextID: 1}
+	if cfg.SnapshotPath == "" {
+		log.Printf("memory backend (nothing is persisted)")
+		return m, nil
+	}
+	data, err := os.ReadFile(cfg.SnapshotPath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("memory: read snapshot: %w", err)
+	default:
+		var snap memorySnapshot
+		if err := json.Unmarshal(data, &snap); err != nil {
+			return nil, fmt.Errorf("memory: parse snapshot %s: %w", cfg.SnapshotPath, err)
+		}
+		for _, l := range snap.Learnings {
+			m.learnings[memoryKey{l.Namespace, l.ID}] = l
+		}
+		for ns, byID := range snap.Revisions {
+			for id, revisions := range byID {
+				m.revisions[memoryKey{ns, id}] = revisions
+			}
+		}
+		m.nextID = max(snap.NextID, 1)
+	}
+	log.Printf("memory backend: %d learnings (snapshot: %s)", len(m.learnings), cfg.SnapshotPath)
+	return m, nil
+}
+
+// ── Backend interface ─────────────────────────────────────────────────────────
+
+func (m *MemoryBackend) Add(namespace, category, content, tags string, confidence float64, source Source) (*Learning, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	l := &Learning{
+		ID: strconv.FormatInt(m.nextID, 10), Namespace: namespace, Category: category, Content: content,
+		Tags: tags, Confidence: confidence, CreatedAt: now, UpdatedAt: now, Source: source,
+	}
+	m.nextID++
+	m.learnings[memoryKey{namespace, l.ID}] = l
+	return copyLearning(l), nil
+}
+
+// Search ranks learnings by how many distinct query words appear in their
+// content, tags or category, then by confidence. An empty query matches
+// everything.
+func (m *MemoryBackend) Search(namespace, query, category string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	words := memoryTokens(query)
+
+	m.mu.RLock()
+	var candidates []scoredLearning
+	for _, l := range m.learnings {
+		if l.Namespace != namespace || !memoryVisible(l) || (category != "" && l.Category != category) {
+			continue
+		}
+		score := 0
+		if len(words) > 0 {
+			have := memoryTokens(l.Content + " " + l.Tags + " " + l.Category)
+			for w := range words {
+				if have[w] {
+					score++
+				}
+			}
+			if score == 0 {
+				continue
+			}
+		}
+		candidates = append(candidates, scoredLearning{copyLearning(l), float64(score)})
+	}
+	m.mu.RUnlock()
+
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if a.learning.Confidence != b.learning.Confidence {
+			return a.learning.Confidence > b.learning.Confidence
+		}
+		return a.learning.UseCount > b.learning.UseCount
+	})
+	var results []*Learning
+	for _, c := range candidates {
+		results = append(results, c.learning)
+	}
+	return fuseRRF(results, nil, defaultRRFK, limit), nil
+}
+
+func (m *MemoryBackend) List(namespace, category, source string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	m.mu.RLock()
+	var results []*Learning
+	for _, l := range m.learnings {
+		if l.Namespace == namespace && memoryVisible(l) && (category == "" || l.Category == category) && l.Source.Matches(source) {
+			results = append(results, copyLearning(l))
+		}
+	}
+	m.mu.RUnlock()
+	sortByUpdated(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (m *MemoryBackend) Get(namespace, id string) (*Learning, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	l, ok := m.learnings[memoryKey{namespace, id}]
+	if !ok || l.DeletedAt != nil {
+		return nil, fmt.Errorf("not found: %s", id)
+	}
+	return copyLearning(l), nil
+}
+
+func (m *MemoryBackend) Update(namespace, id, content, tags string, confidence float64, source Source) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey{namespace, id}
+	l, ok := m.learnings[key]
+	if !ok || l.DeletedAt != nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	if l.Content != content || l.Tags != tags || l.Confidence != confidence {
+		m.revisions[key] = append(m.revisions[key], &Revision{
+			Number: len(m.revisions[key]) + 1, Content: l.Content, Tags: l.Tags,
+			Confidence: l.Confidence, UpdatedAt: l.UpdatedAt,
+		})
+	}
+	l.Content, l.Tags, l.Confidence, l.UpdatedAt, l.Source = content, tags, confidence, time.Now(), source
+	return nil
+}
+
+// Delete moves the learning to the trash; Purge removes it for good.
+func (m *MemoryBackend) Delete(namespace, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.learnings[memoryKey{namespace, id}]
+	if !ok || l.DeletedAt != nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	now := time.Now()
+	l.DeletedAt = &now
+	return nil
+}
+
+func (m *MemoryBackend) Trash(namespace, category string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	m.mu.RLock()
+	var results []*Learning
+	for _, l := range m.learnings {
+		if l.Namespace == namespace && l.DeletedAt != nil && (category == "" || l.Category == category) {
+			results = append(results, copyLearning(l))
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(results, func(i, j int) bool { return results[i].DeletedAt.After(*results[j].DeletedAt) })
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+func (m *MemoryBackend) Restore(namespace, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.learnings[memoryKey{namespace, id}]
+	if !ok || l.DeletedAt == nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	l.DeletedAt = nil
+	return nil
+}
+
+func (m *MemoryBackend) Purge(namespace string, cutoff time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for key, l := range m.learnings {
+		if key.namespace == namespace && l.DeletedAt != nil && l.DeletedAt.Before(cutoff) {
+			delete(m.learnings, key)
+			delete(m.revisions, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *MemoryBackend) Revisions(namespace, id string) ([]*Revision, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	var revisions []*Revision
+	for _, r := range m.revisions[memoryKey{namespace, id}] {
+		c := *r
+		revisions = append(revisions, &c)
+	}
+	return revisions, nil
+}
+
+func (m *MemoryBackend) IncrementUseCount(namespace, id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if l, ok := m.learnings[memoryKey{namespace, id}]; ok && l.DeletedAt == nil {
+		l.UseCount++
+	}
+}
+
+func (m *MemoryBackend) Stats(namespace string) (map[string]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	stats := map[string]int{}
+	for _, l := range m.learnings {
+		if l.Namespace == namespace && memoryVisible(l) {
+			stats[l.Category]++
+		}
+	}
+	return stats, nil
+}
+
+// Close writes the snapshot, if configured. It goes to a temporary file
+// first so a crash mid-write leaves the previous snapshot intact.
+func (m *MemoryBackend) Close() error {
+	if m.cfg.SnapshotPath == "" {
+		return nil
+	}
+	m.mu.RLock()
+	snap := memorySnapshot{NextID: m.nextID, Learnings: make([]*Learning, 0, len(m.learnings))}
+	for _, l := range m.learnings {
+		snap.Learnings = append(snap.Learnings, l)
+	}
+	for key, revisions := range m.revisions {
+		if snap.Revisions == nil {
+			snap.Revisions = map[string]map[string][]*Revision{}
+		}
+		if snap.Revisions[key.namespace] == nil {
+			snap.Revisions[key.namespace] = map[string][]*Revision{}
+		}
+		snap.Revisions[key.namespace][key.id] = revisions
+	}
+	sort.Slice(snap.Learnings, func(i, j int) bool {
+		return snap.Learnings[i].CreatedAt.Before(snap.Learnings[j].CreatedAt)
+	})
+	data, err := json.MarshalIndent(snap, "", "  ")
+	m.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(m.cfg.SnapshotPath), ".snapshot-*")
+	if err != nil {
+		return fmt.Errorf("memory: write snapshot: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("memory: write snapshot: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("memory: write snapshot: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), m.cfg.SnapshotPath); err != nil {
+		return fmt.Errorf("memory: write snapshot: %w", err)
+	}
+	log.Printf("memory backend: wrote %d learnings to %s", len(snap.Learnings), m.cfg.SnapshotPath)
+	return nil
+}
+
+// ── Bulk transfer ─────────────────────────────────────────────────────────────
+
+func (m *MemoryBackend) Namespaces() ([]string, error) {
+	m.mu.RLock()
+	seen := map[string]bool{}
+	for key := range m.learnings {
+		seen[key.namespace] = true
+	}
+	m.mu.RUnlock()
+	namespaces := make([]string, 0, len(seen))
+	for ns := range seen {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+func (m *MemoryBackend) Each(namespace string, fn func(*Learning) error) error {
+	m.mu.RLock()
+	var ls []*Learning
+	for _, l := range m.learnings {
+		if l.Namespace == namespace {
+			ls = append(ls, copyLearning(l))
+		}
+	}
+	m.mu.RUnlock()
+	sort.Slice(ls, func(i, j int) bool { return ls[i].CreatedAt.Before(ls[j].CreatedAt) })
+	for _, l := range ls {
+		if err := fn(l); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Put keeps any ID, since IDs only need to be unique within a namespace.
+func (m *MemoryBackend) Put(l *Learning) (*Learning, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := copyLearning(l)
+	if stored.ID == "" {
+		stored.ID = strconv.FormatInt(m.nextID, 10)
+	}
+	if n, err := strconv.ParseInt(stored.ID, 10, 64); err == nil && n >= m.nextID {
+		m.nextID = n + 1
+	}
+	key := memoryKey{stored.Namespace, stored.ID}
+	if old, ok := m.learnings[key]; ok {
+		switch {
+		case !sameSecond(old.CreatedAt, stored.CreatedAt):
+			delete(m.revisions, key)
+		case old.Content != stored.Content || old.Tags != stored.Tags || old.Confidence != stored.Confidence:
+			m.revisions[key] = append(m.revisions[key], &Revision{
+				Number: len(m.revisions[key]) + 1, Content: old.Content, Tags: old.Tags,
+				Confidence: old.Confidence, UpdatedAt: old.UpdatedAt,
+			})
+		}
+	}
+	m.learnings[key] = stored
+	return copyLearning(stored), nil
+}
+
+func (m *MemoryBackend) PutRevisions(namespace, id string, revs []*Revision) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := memoryKey{namespace, id}
+	if _, ok := m.learnings[key]; !ok {
+		return fmt.Errorf("not found: %s", id)
+	}
+	delete(m.revisions, key)
+	for _, r := range revs {
+		c := *r
+		c.Current = false
+		m.revisions[key] = append(m.revisions[key], &c)
+	}
+	return nil
+}
+
+// ── Internal helpers ──────────────────────────────────────────────────────────
+
+// copyLearning returns a copy callers may modify without touching the store.
+func copyLearning(l *Learning) *Learning {
+	c := *l
+	c.Match = nil
+	c.Revisions = nil
+	return &c
+}
+
+// memoryVisible reports whether Search, List and Stats should see l.
+func memoryVisible(l *Learning) bool {
+	return l.SupersededBy == "" && l.DeletedAt == nil
+}
+
+// memoryTokens returns the distinct lower-cased words of s.
+func memoryTokens(s string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	}) {
+		tokens[w] = true
+	}
+	return tokens
+}
@@ -0,0 +1,788 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresBackend stores learnings in PostgreSQL. Full-text search uses a
+// generated tsvector column; with an embedding model configured, pgvector
+// embeddings give semantic Search. Several replicas can share one database.
+type PostgresBackend struct {
+	db       *sql.DB
+	cfg      PostgresConfig
+	embedder Embedder // nil: full-text search only
+}
+
+// postgresMigrations are applied in order, once each, and recorded in
+// schema_migrations. Never edit a released migration; append a new one.
+var postgresMigrations = []func(cfg PostgresConfig) string{
+	// 1: initial schema
+	func(cfg PostgresConfig) string {
+		lang := pq.QuoteLiteral(cfg.TextSearchConfig) + "::regconfig"
+		return fmt.Sprintf(`
+			CREATE TABLE IF NOT EXISTS learnings (
+				id         BIGSERIAL PRIMARY KEY,
+				namespace  TEXT NOT NULL DEFAULT 'default',
+				category   TEXT NOT NULL DEFAULT 'general',
+				content    TEXT NOT NULL,
+				tags       TEXT NOT NULL DEFAULT '',
+				confidence DOUBLE PRECISION NOT NULL DEFAULT 0.8,
+				use_count  INTEGER NOT NULL DEFAULT 0,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+				updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+				search     TSVECTOR GENERATED ALWAYS AS (
+					setweight(to_tsvector(%[1]s, content), 'A') ||
+					setweight(to_tsvector(%[1]s, tags), 'B') ||
+					setweight(to_tsvector(%[1]s, category), 'C')
+				) STORED
+			);
+			CREATE INDEX IF NOT EXISTS learnings_namespace ON learnings (namespace, category);
+			CREATE INDEX IF NOT EXISTS learnings_search ON learnings USING GIN (search);
+		`, lang)
+	},
+	// 2: merge_learnings keeps the learnings it merges, marked superseded
+	func(cfg PostgresConfig) string {
+		return `ALTER TABLE learnings ADD COLUMN IF NOT EXISTS superseded_by TEXT NOT NULL DEFAULT ''`
+	},
+	// 3: versions of a learning that Update replaced
+	func(cfg PostgresConfig) string {
+		return `
+			CREATE TABLE IF NOT EXISTS learning_revisions (
+				learning_id BIGINT NOT NULL REFERENCES learnings (id) ON DELETE CASCADE,
+				revision    INTEGER NOT NULL,
+				content     TEXT NOT NULL,
+				tags        TEXT NOT NULL DEFAULT '',
+				confidence  DOUBLE PRECISION NOT NULL,
+				updated_at  TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (learning_id, revision)
+			);
+		`
+	},
+	// 4: Delete moves learnings to the trash until they are purged
+	func(cfg PostgresConfig) string {
+		return `ALTER TABLE learnings ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ`
+	},
+	// 5: where each learning came from
+	func(cfg PostgresConfig) string {
+		return `
+			ALTER TABLE learnings
+				ADD COLUMN IF NOT EXISTS source_client TEXT NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS source_client_version TEXT NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS source_session TEXT NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS source_conversation TEXT NOT NULL DEFAULT '',
+				ADD COLUMN IF NOT EXISTS source_author TEXT NOT NULL DEFAULT '';
+		`
+	},
+}
+
+// postgresMigrationLock is the advisory lock key that serialises migrations
+// when several replicas start at once.
+const postgresMigrationLock = 0x6c6561726e // "learn"
+
+func NewPostgresBackend(cfg PostgresConfig, embedder Embedder) (*PostgresBackend, error) {
+	dsn := cfg.DSN
+	if cfg.DSNEnv != "" {
+		v, ok := os.LookupEnv(cfg.DSNEnv)
+		if !ok {
+			return nil, fmt.Errorf("postgres: environment variable %s not set", cfg.DSNEnv)
+		}
+		dsn = v
+	}
+	if dsn == "" {
+		return nil, fmt.Errorf("postgres: dsn or dsn_env is required")
+	}
+	if embedder != nil && embedder.Dimensions() <= 0 {
+		return nil, fmt.Errorf("postgres: [embedding] dimensions is required")
+	}
+	mode, err := resolveSearchMode(cfg.SearchMode, embedder != nil)
+	if err != nil {
+		return nil, fmt.Errorf("postgres: %w", err)
+	}
+	cfg.SearchMode = mode
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(cfg.MaxOpenConns)
+	}
+	b := &PostgresBackend{db: db, cfg: cfg, embedder: embedder}
+	if err := b.migrate(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("postgres: migrate: %w", err)
+	}
+	log.Printf("postgres backend (text search: %s, embeddings: %s, search: %s)", cfg.TextSearchConfig, b.embeddingLabel(), cfg.SearchMode)
+	return b, nil
+}
+
+func (b *PostgresBackend) embeddingLabel() string {
+	if !b.embeddings() {
+		return "off"
+	}
+	return fmt.Sprintf("%s, %d dims", b.embedder.Name(), b.embedder.Dimensions())
+}
+
+func (b *PostgresBackend) embeddings() bool {
+	return b.embedder != nil
+}
+
+func (b *PostgresBackend) migrate() error {
+	ctx := context.Background()
+	conn, err := b.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, postgresMigrationLock); err != nil {
+		return err
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, postgresMigrationLock)
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		return err
+	}
+	var current int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+	for i := current; i < len(postgresMigrations); i++ {
+		version := i + 1
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(postgresMigrations[i](b.cfg)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_migrations (version) VALUES ($1)`, version); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		log.Printf("postgres: applied migration %d", version)
+	}
+
+	// The embedding column depends on the configured model, so it is
+	// ensured on every start rather than versioned. embedding_model names
+	// the embedder that made each vector, so a model change can't mix
+	// vector spaces
+	if b.embeddings() {
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf(`
+			CREATE EXTENSION IF NOT EXISTS vector;
+			ALTER TABLE learnings ADD COLUMN IF NOT EXISTS embedding vector(%d);
+			ALTER TABLE learnings ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+			CREATE INDEX IF NOT EXISTS learnings_embedding ON learnings USING hnsw (embedding vector_cosine_ops);
+		`, b.embedder.Dimensions())); err != nil {
+			return fmt.Errorf("pgvector: %w", err)
+		}
+		dims, err := b.embeddingColumnDims()
+		if err != nil {
+			return err
+		}
+		if dims != b.embedder.Dimensions() {
+			log.Printf("postgres: the embedding column holds %d-dimensional vectors but %s makes %d; run reembed to resize it",
+				dims, b.embedder.Name(), b.embedder.Dimensions())
+			return nil
+		}
+		// Embeddings stored before models were recorded are assumed to
+		// come from the embedder configured now
+		if _, err := conn.ExecContext(ctx,
+			`UPDATE learnings SET embedding_model = $1 WHERE embedding IS NOT NULL AND embedding_model IS NULL`,
+			b.embedder.Name(),
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// embeddingColumnDims returns the dimension the embedding column was created
+// with; pgvector keeps it as the column's type modifier.
+func (b *PostgresBackend) embeddingColumnDims() (int, error) {
+	var dims int
+	err := b.db.QueryRow(`
+		SELECT atttypmod FROM pg_attribute
+		WHERE attrelid = 'learnings'::regclass AND attname = 'embedding'`).Scan(&dims)
+	return dims, err
+}
+
+// ── Backend interface ─────────────────────────────────────────────────────────
+
+const postgresColumns = `l.id, l.namespace, l.category, l.content, l.tags, l.confidence, l.use_count, l.created_at, l.updated_at,
+	l.superseded_by, l.deleted_at,
+	l.source_client, l.source_client_version, l.source_session, l.source_conversation, l.source_author`
+
+// pgArgs collects query arguments and hands out their $n placeholders.
+type pgArgs []any
+
+func (a *pgArgs) add(v any) string {
+	*a = append(*a, v)
+	return "$" + strconv.Itoa(len(*a))
+}
+
+func (b *PostgresBackend) Add(namespace, category, content, tags string, confidence float64, source Source) (*Learning, error) {
+	l := &Learning{Namespace: namespace, Category: category, Content: content, Tags: tags, Confidence: confidence, Source: source}
+	var id int64
+	err := b.db.QueryRow(
+		`INSERT INTO learnings (namespace, category, content, tags, confidence,
+		   source_client, source_client_version, source_session, source_conversation, source_author)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		 RETURNING id, created_at, updated_at`,
+		namespace, category, content, tags, confidence,
+		source.Client, source.ClientVersion, source.Session, source.Conversation, source.Author,
+	).Scan(&id, &l.CreatedAt, &l.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	l.ID = strconv.FormatInt(id, 10)
+	b.storeEmbedding(l.ID, content)
+	return l, nil
+}
+
+// Search ranks by full-text rank, by embedding similarity or by both fused,
+// according to search_mode. Vector search falls back to full-text when the
+// query can't be embedded or nothing in the namespace has an embedding yet.
+func (b *PostgresBackend) Search(namespace, query, category string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 10
+	}
+	return rankedSearch(b.cfg.SearchMode, b.cfg.RRFK, limit,
+		func(n int) ([]*Learning, error) {
+			return b.keywordSearch(namespace, query, category, n)
+		},
+		func(n int) ([]*Learning, error) {
+			emb, err := b.embed(query)
+			if err != nil {
+				return nil, err
+			}
+			return b.vectorSearch(namespace, emb, category, n)
+		})
+}
+
+func (b *PostgresBackend) vectorSearch(namespace string, query []float64, category string, limit int) ([]*Learning, error) {
+	var args pgArgs
+	q := `SELECT ` + postgresColumns + ` FROM learnings l
+		WHERE l.namespace = ` + args.add(namespace) + ` AND l.superseded_by = '' AND l.deleted_at IS NULL AND l.embedding_model = ` + args.add(b.embedder.Name())
+	if category != "" {
+		q += ` AND l.category = ` + args.add(category)
+	}
+	q += ` ORDER BY l.embedding <=> ` + args.add(pgVector(query)) + `::vector LIMIT ` + args.add(limit)
+	return b.query(q, args...)
+}
+
+// keywordSearch lets any word match, like the SQLite backend; an empty query
+// (or one of only stop words) matches everything, best confidence first.
+func (b *PostgresBackend) keywordSearch(namespace, query, category string, limit int) ([]*Learning, error) {
+	var args pgArgs
+	q := `WITH q AS (
+			SELECT replace(plainto_tsquery(` + args.add(b.cfg.TextSearchConfig) + `::regconfig, ` + args.add(query) + `)::text, ' & ', ' | ')::tsquery AS query
+		)
+		SELECT ` + postgresColumns + ` FROM learnings l, q
+		WHERE l.namespace = ` + args.add(namespace) + ` AND l.superseded_by = '' AND l.deleted_at IS NULL
+			AND (numnode(q.query) = 0 OR l.search @@ q.query)`
+	if category != "" {
+		q += ` AND l.category = ` + args.add(category)
+	}
+	q += ` ORDER BY ts_rank(l.search, q.query) DESC, l.confidence DESC LIMIT ` + args.add(limit)
+	return b.query(q, args...)
+}
+
+func (b *PostgresBackend) List(namespace, category, source string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var args pgArgs
+	q := `SELECT ` + postgresColumns + ` FROM learnings l WHERE l.namespace = ` + args.add(namespace) + `
+		AND l.superseded_by = '' AND l.deleted_at IS NULL`
+	if category != "" {
+		q += ` AND l.category = ` + args.add(category)
+	}
+	if source != "" {
+		q += ` AND ` + args.add(source) + ` IN (l.source_client, l.source_session, l.source_conversation, l.source_author)`
+	}
+	q += ` ORDER BY l.updated_at DESC LIMIT ` + args.add(limit)
+	return b.query(q, args...)
+}
+
+func (b *PostgresBackend) Get(namespace, id string) (*Learning, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("not found: %s", id)
+	}
+	results, err := b.query(`SELECT `+postgresColumns+` FROM learnings l WHERE l.namespace = $1 AND l.id = $2 AND l.deleted_at IS NULL`, namespace, n)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("not found: %s", id)
+	}
+	return results[0], nil
+}
+
+func (b *PostgresBackend) Update(namespace, id, content, tags string, confidence float64, source Source) error {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	// The row lock makes concurrent updates number their revisions in turn
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+		WITH current AS (
+			SELECT id, content, tags, confidence, updated_at FROM learnings
+			WHERE namespace=$1 AND id=$2 AND deleted_at IS NULL FOR UPDATE
+		)
+		INSERT INTO learning_revisions (learning_id, revision, content, tags, confidence, updated_at)
+		SELECT c.id, (SELECT COALESCE(MAX(revision), 0) + 1 FROM learning_revisions WHERE learning_id = c.id),
+		       c.content, c.tags, c.confidence, c.updated_at
+		FROM current c
+		WHERE (c.content, c.tags, c.confidence) IS DISTINCT FROM ($3, $4, $5::double precision)`,
+		namespace, n, content, tags, confidence,
+	); err != nil {
+		return err
+	}
+	res, err := tx.Exec(
+		`UPDATE learnings SET content=$1, tags=$2, confidence=$3, updated_at=now(),
+		   source_client=$4, source_client_version=$5, source_session=$6, source_conversation=$7, source_author=$8
+		 WHERE namespace=$9 AND id=$10 AND deleted_at IS NULL`,
+		content, tags, confidence,
+		source.Client, source.ClientVersion, source.Session, source.Conversation, source.Author, namespace, n,
+	)
+	if err := affectedOne(res, err, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	b.storeEmbedding(id, content)
+	return nil
+}
+
+func (b *PostgresBackend) Revisions(namespace, id string) ([]*Revision, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, nil
+	}
+	rows, err := b.db.Query(`
+		SELECT r.revision, r.content, r.tags, r.confidence, r.updated_at
+		FROM learning_revisions r JOIN learnings l ON l.id = r.learning_id
+		WHERE l.namespace=$1 AND l.id=$2 ORDER BY r.revision`, namespace, n)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRevisions(rows)
+}
+
+// Delete moves the learning to the trash; Purge removes it for good.
+func (b *PostgresBackend) Delete(namespace, id string) error {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	res, err := b.db.Exec(`UPDATE learnings SET deleted_at=now() WHERE namespace=$1 AND id=$2 AND deleted_at IS NULL`,
+		namespace, n)
+	return affectedOne(res, err, id)
+}
+
+func (b *PostgresBackend) Trash(namespace, category string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	var args pgArgs
+	q := `SELECT ` + postgresColumns + ` FROM learnings l WHERE l.namespace = ` + args.add(namespace) + `
+		AND l.deleted_at IS NOT NULL`
+	if category != "" {
+		q += ` AND l.category = ` + args.add(category)
+	}
+	q += ` ORDER BY l.deleted_at DESC LIMIT ` + args.add(limit)
+	return b.query(q, args...)
+}
+
+func (b *PostgresBackend) Restore(namespace, id string) error {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	res, err := b.db.Exec(`UPDATE learnings SET deleted_at=NULL WHERE namespace=$1 AND id=$2 AND deleted_at IS NOT NULL`,
+		namespace, n)
+	return affectedOne(res, err, id)
+}
+
+// Purge relies on learning_revisions' ON DELETE CASCADE.
+func (b *PostgresBackend) Purge(namespace string, cutoff time.Time) (int, error) {
+	res, err := b.db.Exec(`DELETE FROM learnings WHERE namespace=$1 AND deleted_at < $2`, namespace, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+func (b *PostgresBackend) IncrementUseCount(namespace, id string) {
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		b.db.Exec(`UPDATE learnings SET use_count = use_count + 1 WHERE namespace=$1 AND id=$2 AND deleted_at IS NULL`, namespace, n)
+	}
+}
+
+func (b *PostgresBackend) Stats(namespace string) (map[string]int, error) {
+	rows, err := b.db.Query(`SELECT category, COUNT(*) FROM learnings WHERE namespace=$1 AND superseded_by='' AND deleted_at IS NULL
+		GROUP BY category`, namespace)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	stats := map[string]int{}
+	for rows.Next() {
+		var cat string
+		var count int
+		if err := rows.Scan(&cat, &count); err != nil {
+			return nil, err
+		}
+		stats[cat] = count
+	}
+	return stats, rows.Err()
+}
+
+func (b *PostgresBackend) Embedder() Embedder { return b.embedder }
+
+// EmbeddingModels counts learnings in every namespace by the embedder that
+// made their embedding; "" counts those without one.
+func (b *PostgresBackend) EmbeddingModels() (map[string]int, error) {
+	models := map[string]int{}
+	if !b.embeddings() {
+		// Without an embedder the columns may not exist
+		var count int
+		err := b.db.QueryRow(`SELECT COUNT(*) FROM learnings`).Scan(&count)
+		models[""] = count
+		return models, err
+	}
+	rows, err := b.db.Query(`
+		SELECT CASE WHEN embedding IS NULL THEN '' ELSE COALESCE(embedding_model, '') END, COUNT(*)
+		FROM learnings GROUP BY 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var model string
+		var count int
+		if err := rows.Scan(&model, &count); err != nil {
+			return nil, err
+		}
+		models[model] = count
+	}
+	return models, rows.Err()
+}
+
+// Reembed embeds the next batch of learnings whose embedding is missing or
+// came from another embedder. If the embedder's dimension changed, the first
+// call resizes the embedding column, which drops every stored vector.
+func (b *PostgresBackend) Reembed(batch int) (int, error) {
+	if !b.embeddings() {
+		return 0, fmt.Errorf("no embedder configured")
+	}
+	dims, err := b.embeddingColumnDims()
+	if err != nil {
+		return 0, err
+	}
+	if want := b.embedder.Dimensions(); dims != want {
+		log.Printf("postgres: resizing the embedding column from %d to %d dimensions", dims, want)
+		if _, err := b.db.Exec(fmt.Sprintf(`
+			ALTER TABLE learnings ALTER COLUMN embedding TYPE vector(%[1]d) USING NULL::vector(%[1]d);
+			UPDATE learnings SET embedding_model = NULL;
+		`, want)); err != nil {
+			return 0, err
+		}
+	}
+
+	rows, err := b.db.Query(`
+		SELECT id, content FROM learnings
+		WHERE embedding IS NULL OR embedding_model IS DISTINCT FROM $1
+		ORDER BY id LIMIT $2`, b.embedder.Name(), batch)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	var texts []string
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		texts = append(texts, content)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	vectors, err := b.embedder.Embed(texts)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if _, err := tx.Exec(`UPDATE learnings SET embedding = $1::vector, embedding_model = $2 WHERE id = $3`,
+			pgVector(vectors[i]), b.embedder.Name(), id); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+func (b *PostgresBackend) Close() error {
+	return b.db.Close()
+}
+
+// ── Bulk transfer ─────────────────────────────────────────────────────────────
+
+func (b *PostgresBackend) Namespaces() ([]string, error) {
+	rows, err := b.db.Query(`SELECT DISTINCT namespace FROM learnings ORDER BY namespace`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var namespaces []string
+	for rows.Next() {
+		var ns string
+		if err := rows.Scan(&ns); err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, rows.Err()
+}
+
+func (b *PostgresBackend) Each(namespace string, fn func(*Learning) error) error {
+	var after int64
+	for {
+		page, err := b.query(
+			`SELECT `+postgresColumns+` FROM learnings l WHERE l.namespace = $1 AND l.id > $2 ORDER BY l.id LIMIT $3`,
+			namespace, after, portPageSize)
+		if err != nil {
+			return err
+		}
+		for _, l := range page {
+			if err := fn(l); err != nil {
+				return err
+			}
+		}
+		if len(page) < portPageSize {
+			return nil
+		}
+		after, _ = strconv.ParseInt(page[len(page)-1].ID, 10, 64)
+	}
+}
+
+// Put keeps numeric IDs unless another namespace already has the ID, and
+// moves the ID sequence past any it keeps so Add can't collide with them.
+func (b *PostgresBackend) Put(l *Learning) (*Learning, error) {
+	tx, err := b.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := strconv.ParseInt(l.ID, 10, 64)
+	if err != nil || id <= 0 {
+		id = 0
+	} else {
+		// The row lock keeps the revisions in step with the upsert below
+		var content, tags string
+		var confidence float64
+		var created time.Time
+		switch err := tx.QueryRow(
+			`SELECT content, tags, confidence, created_at FROM learnings WHERE namespace=$1 AND id=$2 FOR UPDATE`,
+			l.Namespace, id,
+		).Scan(&content, &tags, &confidence, &created); {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, err
+		case !sameSecond(created, l.CreatedAt):
+			// A different learning: its history goes with it
+			if _, err := tx.Exec(`DELETE FROM learning_revisions WHERE learning_id=$1`, id); err != nil {
+				return nil, err
+			}
+		case content != l.Content || tags != l.Tags || confidence != l.Confidence:
+			if _, err := tx.Exec(`
+				INSERT INTO learning_revisions (learning_id, revision, content, tags, confidence, updated_at)
+				SELECT id, (SELECT COALESCE(MAX(revision), 0) + 1 FROM learning_revisions WHERE learning_id = learnings.id),
+				       content, tags, confidence, updated_at
+				FROM learnings WHERE id=$1`, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if id > 0 {
+		// The WHERE leaves a learning with this ID in another namespace
+		// alone, even one another replica inserts concurrently; nothing is
+		// stored then, and the learning gets a new ID below
+		var res sql.Result
+		res, err = tx.Exec(
+			`INSERT INTO learnings (id, namespace, category, content, tags, confidence, use_count, created_at, updated_at,
+			   superseded_by, deleted_at,
+			   source_client, source_client_version, source_session, source_conversation, source_author)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+			 ON CONFLICT (id) DO UPDATE SET category = EXCLUDED.category, content = EXCLUDED.content,
+			   tags = EXCLUDED.tags, confidence = EXCLUDED.confidence, use_count = EXCLUDED.use_count,
+			   created_at = EXCLUDED.created_at, updated_at = EXCLUDED.updated_at,
+			   superseded_by = EXCLUDED.superseded_by, deleted_at = EXCLUDED.deleted_at,
+			   source_client = EXCLUDED.source_client, source_client_version = EXCLUDED.source_client_version,
+			   source_session = EXCLUDED.source_session, source_conversation = EXCLUDED.source_conversation,
+			   source_author = EXCLUDED.source_author
+			 WHERE learnings.namespace = EXCLUDED.namespace`,
+			id, l.Namespace, l.Category, l.Content, l.Tags, l.Confidence, l.UseCount, l.CreatedAt, l.UpdatedAt,
+			l.SupersededBy, l.DeletedAt,
+			l.Source.Client, l.Source.ClientVersion, l.Source.Session, l.Source.Conversation, l.Source.Author)
+		if err != nil {
+			return nil, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			id = 0
+		} else {
+			// Move the ID sequence past the kept ID, never back; last_value
+			// is NULL until the sequence is first used
+			if _, err := tx.Exec(`
+				WITH s AS (SELECT pg_get_serial_sequence('learnings', 'id')::regclass AS seq)
+				SELECT setval(s.seq, GREATEST($1, COALESCE(pg_sequence_last_value(s.seq), 0))) FROM s`, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if id == 0 {
+		err = tx.QueryRow(
+			`INSERT INTO learnings (namespace, category, content, tags, confidence, use_count, created_at, updated_at,
+			   superseded_by, deleted_at,
+			   source_client, source_client_version, source_session, source_conversation, source_author)
+			 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+			 RETURNING id`,
+			l.Namespace, l.Category, l.Content, l.Tags, l.Confidence, l.UseCount, l.CreatedAt, l.UpdatedAt,
+			l.SupersededBy, l.DeletedAt,
+			l.Source.Client, l.Source.ClientVersion, l.Source.Session, l.Source.Conversation, l.Source.Author,
+		).Scan(&id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	stored := copyLearning(l)
+	stored.ID = strconv.FormatInt(id, 10)
+	b.storeEmbedding(stored.ID, l.Content)
+	return stored, nil
+}
+
+func (b *PostgresBackend) PutRevisions(namespace, id string, revs []*Revision) error {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return fmt.Errorf("not found: %s", id)
+	}
+	tx, err := b.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var one int
+	switch err := tx.QueryRow(`SELECT 1 FROM learnings WHERE namespace=$1 AND id=$2 FOR UPDATE`, namespace, n).Scan(&one); {
+	case err == sql.ErrNoRows:
+		return fmt.Errorf("not found: %s", id)
+	case err != nil:
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM learning_revisions WHERE learning_id=$1`, n); err != nil {
+		return err
+	}
+	for _, r := range revs {
+		if _, err := tx.Exec(
+			`INSERT INTO learning_revisions (learning_id, revision, content, tags, confidence, updated_at) VALUES ($1, $2, $3, $4, $5, $6)`,
+			n, r.Number, r.Content, r.Tags, r.Confidence, r.UpdatedAt,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ── Internal helpers ──────────────────────────────────────────────────────────
+
+func (b *PostgresBackend) query(q string, args ...any) ([]*Learning, error) {
+	rows, err := b.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanLearnings(rows)
+}
+
+func (b *PostgresBackend) embed(text string) ([]float64, error) {
+	return embedOne(b.embedder, text)
+}
+
+// storeEmbedding (re)computes a learning's embedding. Failures leave it
+// NULL: the learning is still found by full-text search.
+func (b *PostgresBackend) storeEmbedding(id, content string) {
+	if !b.embeddings() {
+		return
+	}
+	emb, err := b.embed(content)
+	if err == nil && len(emb) != b.embedder.Dimensions() {
+		err = fmt.Errorf("model returned %d dimensions, expected %d", len(emb), b.embedder.Dimensions())
+	}
+	if err == nil {
+		_, err = b.db.Exec(`UPDATE learnings SET embedding = $1::vector, embedding_model = $2 WHERE id = $3`,
+			pgVector(emb), b.embedder.Name(), id)
+	}
+	if err != nil {
+		log.Printf("embedding failed for learning %s (stored without): %v", id, err)
+	}
+}
+
+// pgVector formats an embedding as a pgvector text literal, e.g. "[0.1,0.2]".
+func pgVector(v []float64) string {
+	var sb strings.Builder
+	sb.WriteByte('[')
+	for i, f := range v {
+		if i > 0 {
+			sb.WriteByte(',')
+		}
+		sb.WriteString(strconv.FormatFloat(f, 'g', -1, 32))
+	}
+	sb.WriteByte(']')
+	return sb.String()
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresTestDSNEnv names the variable holding the DSN of a PostgreSQL
+// server the tests may create and drop schemas in. TestMain sets it to a
+// throwaway server when it isn't set and PostgreSQL is installed.
+const postgresTestDSNEnv = "TEST_POSTGRES_DSN"
+
+// postgresUnavailable says why there is no server for the PostgreSQL tests,
+// if there isn't one.
+var postgresUnavailable string
+
+func TestMain(m *testing.M) {
+	stop := startTestPostgres()
+	code := m.Run()
+	stop()
+	os.Exit(code)
+}
+
+// startTestPostgres starts a PostgreSQL server in a temporary directory,
+// listening on a free local port, unless postgresTestDSNEnv already names
+// one. It returns a function that stops the server and removes its files.
+func startTestPostgres() (stop func()) {
+	stop = func() {}
+	if os.Getenv(postgresTestDSNEnv) != "" {
+		return stop
+	}
+	bin, err := postgresBinDir()
+	if err != nil {
+		postgresUnavailable = err.Error()
+		return stop
+	}
+	dir, err := os.MkdirTemp("", "mcp-postgres-")
+	if err != nil {
+		postgresUnavailable = err.Error()
+		return stop
+	}
+	data := filepath.Join(dir, "data")
+	run := func(name string, args ...string) error {
+		out, err := exec.Command(filepath.Join(bin, name), args...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("%s: %v: %s", name, err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+
+	port, err := freePort()
+	if err == nil {
+		err = run("initdb", "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--locale=C", "--no-sync")
+	}
+	if err == nil {
+		opts := fmt.Sprintf("-F -p %d -k %s -c listen_addresses=127.0.0.1", port, dir)
+		err = run("pg_ctl", "-D", data, "-l", filepath.Join(dir, "server.log"), "-o", opts, "-w", "start")
+	}
+	if err != nil {
+		postgresUnavailable = err.Error()
+		os.RemoveAll(dir)
+		return stop
+	}
+	os.Setenv(postgresTestDSNEnv, fmt.Sprintf("host=127.0.0.1 port=%d user=postgres dbname=postgres sslmode=disable", port))
+	return func() {
+		run("pg_ctl", "-D", data, "-m", "immediate", "stop")
+		os.RemoveAll(dir)
+	}
+}
+
+// postgresBinDir finds the directory holding initdb and pg_ctl: on the
+// PATH, or where Debian and Ubuntu install them.
+func postgresBinDir() (string, error) {
+	if initdb, err := exec.LookPath("initdb"); err == nil {
+		if _, err := exec.LookPath("pg_ctl"); err == nil {
+			return filepath.Dir(initdb), nil
+		}
+	}
+	dirs, _ := filepath.Glob("/usr/lib/postgresql/*/bin")
+	sort.Slice(dirs, func(i, j int) bool { return postgresVersion(dirs[i]) > postgresVersion(dirs[j]) })
+	for _, dir := range dirs {
+		if _, err := os.Stat(filepath.Join(dir, "initdb")); err == nil {
+			return dir, nil
+		}
+	}
+	return "", errors.New("initdb and pg_ctl not found")
+}
+
+// postgresVersion is the major version in a /usr/lib/postgresql/<v>/bin path.
+func postgresVersion(dir string) int {
+	v, _ := strconv.Atoi(filepath.Base(filepath.Dir(dir)))
+	return v
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
+
+// postgresTestConfig returns a config pointed at a fresh schema on the test
+// server, dropped again when the test ends, and a connection to it. Without
+// a server the test is skipped, or fails on CI, where one is expected.
+func postgresTestConfig(t *testing.T) (PostgresConfig, *sql.DB) {
+	t.Helper()
+	dsn := os.Getenv(postgresTestDSNEnv)
+	if dsn == "" {
+		msg := fmt.Sprintf("no PostgreSQL server: %s; install PostgreSQL or set %s", postgresUnavailable, postgresTestDSNEnv)
+		if os.Getenv("CI") != "" {
+			t.Fatal(msg)
+		}
+		t.Skip(msg)
+	}
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("mcp_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + pq.QuoteIdentifier(schema)); err != nil {
+		admin.Close()
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + pq.QuoteIdentifier(schema) + ` CASCADE`); err != nil {
+			t.Errorf("drop schema %s: %v", schema, err)
+		}
+		admin.Close()
+	})
+
+	// lib/pq sends parameters it doesn't know itself as run-time
+	// settings, in URL and key=value DSNs alike
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		dsn += sep + "search_path=" + schema
+	} else {
+		dsn += " search_path=" + schema
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	cfg := DefaultConfig().Postgres
+	cfg.DSN = dsn
+	return cfg, db
+}
+
+func TestPostgresConformance(t *testing.T) {
+	cfg, _ := postgresTestConfig(t)
+	b, err := NewPostgresBackend(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	runConformance(t, b)
+}
+
+// TestPostgresMigrations starts from a database with only the initial
+// schema and a learning stored under it: opening the backend must apply
+// the later migrations and leave that learning usable by every feature
+// they added.
+func TestPostgresMigrations(t *testing.T) {
+	cfg, db := postgresTestConfig(t)
+	if _, err := db.Exec(`
+		CREATE TABLE schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(postgresMigrations[0](cfg)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO schema_migrations (version) VALUES (1)`); err != nil {
+		t.Fatal(err)
+	}
+	var n int64
+	if err := db.QueryRow(`
+		INSERT INTO learnings (namespace, category, content, tags, confidence)
+		VALUES ('upgrade', 'tooling', 'pin the linter version', 'ci', 0.7)
+		RETURNING id
+	`).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	id := strconv.FormatInt(n, 10)
+
+	b, err := NewPostgresBackend(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	var version int
+	if err := db.QueryRow(`SELECT MAX(version) FROM schema_migrations`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(postgresMigrations) {
+		t.Fatalf("schema version %d, want %d", version, len(postgresMigrations))
+	}
+
+	l, err := b.Get("upgrade", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sameLearning(l, "upgrade", "tooling", "pin the linter version", "ci", 0.7); err != nil {
+		t.Fatal(err)
+	}
+	if l.SupersededBy != "" || l.DeletedAt != nil || l.Source != (Source{}) {
+		t.Fatalf("migrated learning has superseded_by %q, deleted_at %v, source %+v", l.SupersededBy, l.DeletedAt, l.Source)
+	}
+
+	// 3: Update keeps the replaced version; 5: and stamps the source
+	source := Source{Client: "upgrade-test", Author: "token:ci"}
+	if err := b.Update("upgrade", id, "pin the linter and formatter versions", "ci", 0.8, source); err != nil {
+		t.Fatal(err)
+	}
+	revs, err := b.Revisions("upgrade", id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(revs) != 1 || revs[0].Content != "pin the linter version" {
+		t.Fatalf("revisions after update: %+v", revs)
+	}
+	if err := listIs(b, "upgrade", "", 10, id); err != nil {
+		t.Fatal(err)
+	}
+	ls, err := b.List("upgrade", "", "upgrade-test", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ls) != 1 || ls[0].Source != source {
+		t.Fatalf("list by source: %s", describe(ls))
+	}
+
+	// 4: Delete moves it to the trash, Restore brings it back
+	if err := b.Delete("upgrade", id); err != nil {
+		t.Fatal(err)
+	}
+	trash, err := b.Trash("upgrade", "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].ID != id {
+		t.Fatalf("trash after delete: %s", describe(trash))
+	}
+	if err := b.Restore("upgrade", id); err != nil {
+		t.Fatal(err)
+	}
+	if err := listIs(b, "upgrade", "", 10, id); err != nil {
+		t.Fatal(err)
+	}
+
+	// The ID sequence must carry on past the migrated rows
+	added, err := b.Add("upgrade", "tooling", "cache the module download", "ci", 0.6, Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if added.ID == id {
+		t.Fatalf("new learning reused ID %s", id)
+	}
+}
+
+// TestPostgresPutOtherNamespace puts a learning under an ID another
+// namespace holds: the other learning must be left alone and the new one
+// stored under a new ID.
+func TestPostgresPutOtherNamespace(t *testing.T) {
+	cfg, _ := postgresTestConfig(t)
+	b, err := NewPostgresBackend(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+
+	theirs, err := b.Add("theirs", "general", "their learning", "", 0.8, Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	ours, err := b.Put(&Learning{
+		ID: theirs.ID, Namespace: "ours", Category: "general", Content: "our learning",
+		Confidence: 0.8, CreatedAt: now, UpdatedAt: now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ours.ID == theirs.ID {
+		t.Fatalf("put kept ID %s, which namespace theirs holds", ours.ID)
+	}
+	l, err := b.Get("theirs", theirs.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sameLearning(l, "theirs", "general", "their learning", "", 0.8); err != nil {
+		t.Fatal(err)
+	}
+}
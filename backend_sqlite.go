@@ -11,38 +11,128 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 )
 
+// SQLiteBackend keeps everything in one file. With an embedding model
+// configured it also stores an embedding per learning and ranks Search by
+// cosine similarity in-process, alone or fused with keyword rank.
 type SQLiteBackend struct {
-	db *sql.DB
+	db       *sql.DB
+	cfg      SQLiteConfig
+	embedder Embedder // nil: keyword search only
 }
 
-func NewSQLiteBackend(path string) (*SQLiteBackend, error) {
-	db, err := sql.Open("sqlite3", path)
+func NewSQLiteBackend(cfg SQLiteConfig, embedder Embedder) (*SQLiteBackend, error) {
+	mode, err := resolveSearchMode(cfg.SearchMode, embedder != nil)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %w", err)
+	}
+	cfg.SearchMode = mode
+	db, err := sql.Open("sqlite3", cfg.Path)
 	if err != nil {
 		return nil, err
 	}
-	s := &SQLiteBackend{db: db}
+	s := &SQLiteBackend{db: db, cfg: cfg, embedder: embedder}
 	if err := s.migrate(); err != nil {
 		return nil, err
 	}
-	log.Printf("sqlite backend: %s", path)
+	if s.embeddings() {
+		log.Printf("sqlite backend: %s (embeddings: %s, search: %s)", cfg.Path, embedder.Name(), cfg.SearchMode)
+	} else {
+		log.Printf("sqlite backend: %s", cfg.Path)
+	}
 	return s, nil
 }
 
+func (s *SQLiteBackend) embeddings() bool {
+	return s.embedder != nil
+}
+
 func (s *SQLiteBackend) migrate() error {
 	if _, err := s.db.Exec(`
 		CREATE TABLE IF NOT EXISTS learnings (
 			id         INTEGER PRIMARY KEY AUTOINCREMENT,
+			namespace  TEXT NOT NULL DEFAULT 'default',
 			category   TEXT NOT NULL DEFAULT 'general',
 			content    TEXT NOT NULL,
 			tags       TEXT NOT NULL DEFAULT '',
 			confidence REAL NOT NULL DEFAULT 0.8,
 			use_count  INTEGER NOT NULL DEFAULT 0,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
-			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			superseded_by TEXT NOT NULL DEFAULT '',
+			deleted_at DATETIME,
+			source_client         TEXT NOT NULL DEFAULT '',
+			source_client_version TEXT NOT NULL DEFAULT '',
+			source_session        TEXT NOT NULL DEFAULT '',
+			source_conversation   TEXT NOT NULL DEFAULT '',
+			source_author         TEXT NOT NULL DEFAULT ''
+		)
+	`); err != nil {
+		return err
+	}
+
+	// Databases created before namespaces: existing rows land in 'default'
+	if !s.hasColumn("learnings", "namespace") {
+		if _, err := s.db.Exec(`ALTER TABLE learnings ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default'`); err != nil {
+			return err
+		}
+	}
+	if _, err := s.db.Exec(`CREATE INDEX IF NOT EXISTS learnings_namespace ON learnings(namespace, category)`); err != nil {
+		return err
+	}
+	// Databases created before merge_learnings: nothing is superseded
+	if !s.hasColumn("learnings", "superseded_by") {
+		if _, err := s.db.Exec(`ALTER TABLE learnings ADD COLUMN superseded_by TEXT NOT NULL DEFAULT ''`); err != nil {
+			return err
+		}
+	}
+	// Databases created before the trash: nothing is deleted
+	if !s.hasColumn("learnings", "deleted_at") {
+		if _, err := s.db.Exec(`ALTER TABLE learnings ADD COLUMN deleted_at DATETIME`); err != nil {
+			return err
+		}
+	}
+	// Databases created before sources were recorded: every source is unknown
+	for _, col := range sourceColumns {
+		if !s.hasColumn("learnings", col) {
+			if _, err := s.db.Exec(`ALTER TABLE learnings ADD COLUMN ` + col + ` TEXT NOT NULL DEFAULT ''`); err != nil {
+				return err
+			}
+		}
+	}
+	// Versions of a learning that Update replaced; IDs are unique across
+	// namespaces, so learning_id alone identifies the learning
+	if _, err := s.db.Exec(`
+		CREATE TABLE IF NOT EXISTS learning_revisions (
+			learning_id INTEGER NOT NULL,
+			revision    INTEGER NOT NULL,
+			content     TEXT NOT NULL,
+			tags        TEXT NOT NULL DEFAULT '',
+			confidence  REAL NOT NULL,
+			updated_at  DATETIME NOT NULL,
+			PRIMARY KEY (learning_id, revision)
 		)
 	`); err != nil {
 		return err
 	}
+	// Little-endian float32s; NULL until embedded. embedding_model names the
+	// embedder that made it, so a model change can't mix vector spaces
+	for _, col := range []string{"embedding BLOB", "embedding_model TEXT", "embedding_dims INTEGER"} {
+		if !s.hasColumn("learnings", strings.Fields(col)[0]) {
+			if _, err := s.db.Exec(`ALTER TABLE learnings ADD COLUMN ` + col); err != nil {
+				return err
+			}
+		}
+	}
+	// Embeddings stored before models were recorded are assumed to come
+	// from the embedder configured now
+	if s.embeddings() {
+		if _, err := s.db.Exec(
+			`UPDATE learnings SET embedding_model = ?, embedding_dims = length(embedding) / 4
+			 WHERE embedding IS NOT NULL AND embedding_model IS NULL`, s.embedder.Name(),
+		); err != nil {
+			return err
+		}
+	}
 
 	// FTS5 is optional — falls back to per-word LIKE search if unavailable
 	ftsStatements := []string{
@@ -74,34 +164,125 @@ func (s *SQLiteBackend) migrate() error {
 	return nil
 }
 
-func (s *SQLiteBackend) Add(category, content, tags string, confidence float64) (*Learning, error) {
+func (s *SQLiteBackend) hasColumn(table, column string) bool {
+	rows, err := s.db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return false
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if rows.Scan(&name) == nil && name == column {
+			return true
+		}
+	}
+	return false
+}
+
+// sourceColumns hold a learning's Source, field by field.
+var sourceColumns = []string{"source_client", "source_client_version", "source_session", "source_conversation", "source_author"}
+
+// sourceFilter restricts a query to learnings whose source matches the
+// argument, as Source.Matches does.
+const sourceFilter = ` AND ? IN (source_client, source_session, source_conversation, source_author)`
+
+const learningColumns = `id, namespace, category, content, tags, confidence, use_count, created_at, updated_at, superseded_by, deleted_at,
+	source_client, source_client_version, source_session, source_conversation, source_author`
+
+// sourceDest returns scan destinations for the source columns.
+func sourceDest(src *Source) []any {
+	return []any{&src.Client, &src.ClientVersion, &src.Session, &src.Conversation, &src.Author}
+}
+
+func (s *SQLiteBackend) Add(namespace, category, content, tags string, confidence float64, source Source) (*Learning, error) {
 	now := time.Now()
 	res, err := s.db.Exec(
-		`INSERT INTO learnings (category, content, tags, confidence, created_at, updated_at)
-		 VALUES (?, ?, ?, ?, ?, ?)`,
-		category, content, tags, confidence, now, now,
+		`INSERT INTO learnings (namespace, category, content, tags, confidence, created_at, updated_at,
+		   source_client, source_client_version, source_session, source_conversation, source_author)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		namespace, category, content, tags, confidence, now, now,
+		source.Client, source.ClientVersion, source.Session, source.Conversation, source.Author,
 	)
 	if err != nil {
 		return nil, err
 	}
 	id, _ := res.LastInsertId()
+	s.storeEmbedding(id, content)
 	return &Learning{
-		ID: strconv.FormatInt(id, 10), Category: category, Content: content,
-		Tags: tags, Confidence: confidence, CreatedAt: now, UpdatedAt: now,
+		ID: strconv.FormatInt(id, 10), Namespace: namespace, Category: category, Content: content,
+		Tags: tags, Confidence: confidence, CreatedAt: now, UpdatedAt: now, Source: source,
 	}, nil
 }
 
-func (s *SQLiteBackend) Search(query, category string, limit int) ([]*Learning, error) {
+// Search ranks by keyword, by embedding similarity or by both fused,
+// according to search_mode. Vector search falls back to keywords when the
+// query can't be embedded or nothing in the namespace has an embedding yet.
+func (s *SQLiteBackend) Search(namespace, query, category string, limit int) ([]*Learning, error) {
 	if limit <= 0 {
 		limit = 10
 	}
+	return rankedSearch(s.cfg.SearchMode, s.cfg.RRFK, limit,
+		func(n int) ([]*Learning, error) {
+			return s.keywordSearch(namespace, query, category, n)
+		},
+		func(n int) ([]*Learning, error) {
+			emb, err := s.embed(query)
+			if err != nil {
+				return nil, err
+			}
+			return s.vectorSearch(namespace, emb, category, n)
+		})
+}
+
+// vectorSearch scores every embedded learning in the namespace against the
+// query embedding. A brute-force scan is fine at personal-memory scale.
+func (s *SQLiteBackend) vectorSearch(namespace string, query []float64, category string, limit int) ([]*Learning, error) {
+	q := `SELECT ` + learningColumns + `, embedding FROM learnings
+		WHERE namespace = ? AND superseded_by = '' AND deleted_at IS NULL AND embedding IS NOT NULL AND embedding_model = ?`
+	args := []interface{}{namespace, s.embedder.Name()}
+	if category != "" {
+		q += " AND category = ?"
+		args = append(args, category)
+	}
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var candidates []scoredLearning
+	for rows.Next() {
+		l := &Learning{}
+		var idInt int64
+		var deleted sql.NullTime
+		var blob []byte
+		dest := append([]any{&idInt, &l.Namespace, &l.Category, &l.Content, &l.Tags,
+			&l.Confidence, &l.UseCount, &l.CreatedAt, &l.UpdatedAt, &l.SupersededBy, &deleted}, sourceDest(&l.Source)...)
+		if err := rows.Scan(append(dest, &blob)...); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		l.ID = strconv.FormatInt(idInt, 10)
+		if deleted.Valid {
+			l.DeletedAt = &deleted.Time
+		}
+		candidates = append(candidates, scoredLearning{l, cosineSimilarity(query, decodeEmbedding(blob))})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return topBySimilarity(candidates, limit), nil
+}
+
+func (s *SQLiteBackend) keywordSearch(namespace, query, category string, limit int) ([]*Learning, error) {
 	ftsQuery := strings.Join(strings.Fields(query), " OR ")
 	baseSQL := `
-		SELECT l.id, l.category, l.content, l.tags, l.confidence, l.use_count, l.created_at, l.updated_at
+		SELECT l.id, l.namespace, l.category, l.content, l.tags, l.confidence, l.use_count, l.created_at, l.updated_at,
+			l.superseded_by, l.deleted_at,
+			l.source_client, l.source_client_version, l.source_session, l.source_conversation, l.source_author
 		FROM learnings l
 		JOIN learnings_fts f ON l.id = f.rowid
-		WHERE learnings_fts MATCH ?`
-	args := []interface{}{ftsQuery}
+		WHERE learnings_fts MATCH ? AND l.namespace = ? AND l.superseded_by = '' AND l.deleted_at IS NULL`
+	args := []interface{}{ftsQuery, namespace}
 	if category != "" {
 		baseSQL += " AND l.category = ?"
 		args = append(args, category)
@@ -123,8 +304,9 @@ func (s *SQLiteBackend) Search(query, category string, limit int) ([]*Learning,
 		if len(clauses) == 0 {
 			clauses = append(clauses, "1=1")
 		}
-		fallback := `SELECT id, category, content, tags, confidence, use_count, created_at, updated_at
-			FROM learnings WHERE (` + strings.Join(clauses, " OR ") + `)`
+		fallback := `SELECT ` + learningColumns + `
+			FROM learnings WHERE namespace = ? AND superseded_by = '' AND deleted_at IS NULL AND (` + strings.Join(clauses, " OR ") + `)`
+		fargs = append([]interface{}{namespace}, fargs...)
 		if category != "" {
 			fallback += " AND category = ?"
 			fargs = append(fargs, category)
@@ -140,16 +322,20 @@ func (s *SQLiteBackend) Search(query, category string, limit int) ([]*Learning,
 	return scanLearnings(rows)
 }
 
-func (s *SQLiteBackend) List(category string, limit int) ([]*Learning, error) {
+func (s *SQLiteBackend) List(namespace, category, source string, limit int) ([]*Learning, error) {
 	if limit <= 0 {
 		limit = 50
 	}
-	q := `SELECT id, category, content, tags, confidence, use_count, created_at, updated_at FROM learnings`
-	var args []interface{}
+	q := `SELECT ` + learningColumns + ` FROM learnings WHERE namespace = ? AND superseded_by = '' AND deleted_at IS NULL`
+	args := []interface{}{namespace}
 	if category != "" {
-		q += " WHERE category = ?"
+		q += " AND category = ?"
 		args = append(args, category)
 	}
+	if source != "" {
+		q += sourceFilter
+		args = append(args, source)
+	}
 	q += " ORDER BY updated_at DESC LIMIT ?"
 	args = append(args, limit)
 	rows, err := s.db.Query(q, args...)
@@ -160,25 +346,134 @@ func (s *SQLiteBackend) List(category string, limit int) ([]*Learning, error) {
 	return scanLearnings(rows)
 }
 
-func (s *SQLiteBackend) Update(id, content, tags string, confidence float64) error {
-	_, err := s.db.Exec(
-		`UPDATE learnings SET content=?, tags=?, confidence=?, updated_at=? WHERE id=?`,
-		content, tags, confidence, time.Now(), id,
+func (s *SQLiteBackend) Get(namespace, id string) (*Learning, error) {
+	rows, err := s.db.Query(
+		`SELECT `+learningColumns+` FROM learnings WHERE namespace=? AND id=? AND deleted_at IS NULL`, namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results, err := scanLearnings(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, fmt.Errorf("not found: %s", id)
+	}
+	return results[0], nil
+}
+
+// Update first copies the current version to learning_revisions, unless
+// the update changes nothing.
+func (s *SQLiteBackend) Update(namespace, id, content, tags string, confidence float64, source Source) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+		INSERT INTO learning_revisions (learning_id, revision, content, tags, confidence, updated_at)
+		SELECT id, (SELECT COALESCE(MAX(revision), 0) + 1 FROM learning_revisions WHERE learning_id = learnings.id),
+		       content, tags, confidence, updated_at
+		FROM learnings
+		WHERE namespace=? AND id=? AND deleted_at IS NULL AND (content <> ? OR tags <> ? OR confidence <> ?)`,
+		namespace, id, content, tags, confidence,
+	); err != nil {
+		return err
+	}
+	res, err := tx.Exec(
+		`UPDATE learnings SET content=?, tags=?, confidence=?, updated_at=?,
+		   source_client=?, source_client_version=?, source_session=?, source_conversation=?, source_author=?
+		 WHERE namespace=? AND id=? AND deleted_at IS NULL`,
+		content, tags, confidence, time.Now(),
+		source.Client, source.ClientVersion, source.Session, source.Conversation, source.Author, namespace, id,
 	)
-	return err
+	if err := affectedOne(res, err, id); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if n, err := strconv.ParseInt(id, 10, 64); err == nil {
+		s.storeEmbedding(n, content)
+	}
+	return nil
 }
 
-func (s *SQLiteBackend) Delete(id string) error {
-	_, err := s.db.Exec(`DELETE FROM learnings WHERE id=?`, id)
-	return err
+// Delete moves the learning to the trash; Purge removes it for good.
+func (s *SQLiteBackend) Delete(namespace, id string) error {
+	res, err := s.db.Exec(`UPDATE learnings SET deleted_at=? WHERE namespace=? AND id=? AND deleted_at IS NULL`,
+		time.Now(), namespace, id)
+	return affectedOne(res, err, id)
 }
 
-func (s *SQLiteBackend) IncrementUseCount(id string) {
-	s.db.Exec(`UPDATE learnings SET use_count = use_count + 1 WHERE id=?`, id)
+func (s *SQLiteBackend) Revisions(namespace, id string) ([]*Revision, error) {
+	rows, err := s.db.Query(`
+		SELECT r.revision, r.content, r.tags, r.confidence, r.updated_at
+		FROM learning_revisions r JOIN learnings l ON l.id = r.learning_id
+		WHERE l.namespace=? AND l.id=? ORDER BY r.revision`, namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanRevisions(rows)
 }
 
-func (s *SQLiteBackend) Stats() (map[string]int, error) {
-	rows, err := s.db.Query(`SELECT category, COUNT(*) FROM learnings GROUP BY category`)
+func (s *SQLiteBackend) Trash(namespace, category string, limit int) ([]*Learning, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+	q := `SELECT ` + learningColumns + ` FROM learnings WHERE namespace = ? AND deleted_at IS NOT NULL`
+	args := []interface{}{namespace}
+	if category != "" {
+		q += " AND category = ?"
+		args = append(args, category)
+	}
+	q += " ORDER BY deleted_at DESC LIMIT ?"
+	args = append(args, limit)
+	rows, err := s.db.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	return scanLearnings(rows)
+}
+
+func (s *SQLiteBackend) Restore(namespace, id string) error {
+	res, err := s.db.Exec(`UPDATE learnings SET deleted_at=NULL WHERE namespace=? AND id=? AND deleted_at IS NOT NULL`,
+		namespace, id)
+	return affectedOne(res, err, id)
+}
+
+func (s *SQLiteBackend) Purge(namespace string, cutoff time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`
+		DELETE FROM learning_revisions WHERE learning_id IN (
+			SELECT id FROM learnings WHERE namespace=? AND deleted_at < ?
+		)`, namespace, cutoff); err != nil {
+		return 0, err
+	}
+	res, err := tx.Exec(`DELETE FROM learnings WHERE namespace=? AND deleted_at < ?`, namespace, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	return int(n), tx.Commit()
+}
+
+func (s *SQLiteBackend) IncrementUseCount(namespace, id string) {
+	s.db.Exec(`UPDATE learnings SET use_count = use_count + 1 WHERE namespace=? AND id=? AND deleted_at IS NULL`, namespace, id)
+}
+
+func (s *SQLiteBackend) Stats(namespace string) (map[string]int, error) {
+	rows, err := s.db.Query(`SELECT category, COUNT(*) FROM learnings WHERE namespace=? AND superseded_by='' AND deleted_at IS NULL GROUP BY category`, namespace)
 	if err != nil {
 		return nil, err
 	}
@@ -197,17 +492,281 @@ func (s *SQLiteBackend) Close() error {
 	return s.db.Close()
 }
 
+func (s *SQLiteBackend) embed(text string) ([]float64, error) {
+	return embedOne(s.embedder, text)
+}
+
+// storeEmbedding (re)computes a learning's embedding. Failures leave it
+// NULL: the learning is still found by keyword search.
+func (s *SQLiteBackend) storeEmbedding(id int64, content string) {
+	if !s.embeddings() {
+		return
+	}
+	emb, err := s.embed(content)
+	if err == nil && len(emb) == 0 {
+		err = fmt.Errorf("empty embedding")
+	}
+	if err == nil {
+		_, err = s.db.Exec(`UPDATE learnings SET embedding = ?, embedding_model = ?, embedding_dims = ? WHERE id = ?`,
+			encodeEmbedding(emb), s.embedder.Name(), len(emb), id)
+	}
+	if err != nil {
+		log.Printf("embedding failed for learning %d (stored without): %v", id, err)
+	}
+}
+
+func (s *SQLiteBackend) Embedder() Embedder { return s.embedder }
+
+// EmbeddingModels counts learnings in every namespace by the embedder that
+// made their embedding; "" counts those without one.
+func (s *SQLiteBackend) EmbeddingModels() (map[string]int, error) {
+	rows, err := s.db.Query(`
+		SELECT CASE WHEN embedding IS NULL THEN '' ELSE COALESCE(embedding_model, '') END, COUNT(*)
+		FROM learnings GROUP BY 1`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	models := map[string]int{}
+	for rows.Next() {
+		var model string
+		var count int
+		if err := rows.Scan(&model, &count); err != nil {
+			return nil, err
+		}
+		models[model] = count
+	}
+	return models, rows.Err()
+}
+
+// Reembed embeds the next batch of learnings whose embedding is missing or
+// came from another embedder.
+func (s *SQLiteBackend) Reembed(batch int) (int, error) {
+	if !s.embeddings() {
+		return 0, fmt.Errorf("no embedder configured")
+	}
+	rows, err := s.db.Query(`
+		SELECT id, content FROM learnings
+		WHERE embedding IS NULL OR embedding_model IS NOT ?
+		ORDER BY id LIMIT ?`, s.embedder.Name(), batch)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int64
+	var texts []string
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		texts = append(texts, content)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(ids) == 0 {
+		return 0, err
+	}
+
+	vectors, err := s.embedder.Embed(texts)
+	if err != nil {
+		return 0, err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	for i, id := range ids {
+		if _, err := tx.Exec(`UPDATE learnings SET embedding = ?, embedding_model = ?, embedding_dims = ? WHERE id = ?`,
+			encodeEmbedding(vectors[i]), s.embedder.Name(), len(vectors[i]), id); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// Namespaces, Each and Put let the migrate command copy learnings in and out.
+
+func (s *SQLiteBackend) Namespaces() ([]string, error) {
+	rows, err := s.db.Query(`SELECT DISTINCT namespace FROM learnings ORDER BY namespace`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var namespaces []string
+	for rows.Next() {
+		var ns string
+		if err := rows.Scan(&ns); err != nil {
+			return nil, err
+		}
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces, rows.Err()
+}
+
+func (s *SQLiteBackend) Each(namespace string, fn func(*Learning) error) error {
+	var after int64
+	for {
+		rows, err := s.db.Query(
+			`SELECT `+learningColumns+` FROM learnings WHERE namespace=? AND id>? ORDER BY id LIMIT ?`,
+			namespace, after, portPageSize)
+		if err != nil {
+			return err
+		}
+		page, err := scanLearnings(rows)
+		rows.Close()
+		if err != nil {
+			return err
+		}
+		for _, l := range page {
+			if err := fn(l); err != nil {
+				return err
+			}
+		}
+		if len(page) < portPageSize {
+			return nil
+		}
+		after, _ = strconv.ParseInt(page[len(page)-1].ID, 10, 64)
+	}
+}
+
+// Put keeps numeric IDs unless another namespace already has the ID: IDs
+// are unique across the whole table.
+func (s *SQLiteBackend) Put(l *Learning) (*Learning, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	id, err := strconv.ParseInt(l.ID, 10, 64)
+	if err != nil || id <= 0 {
+		id = 0
+	} else {
+		var ns, content, tags string
+		var confidence float64
+		var created time.Time
+		switch err := tx.QueryRow(`SELECT namespace, content, tags, confidence, created_at FROM learnings WHERE id=?`, id).
+			Scan(&ns, &content, &tags, &confidence, &created); {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return nil, err
+		case ns != l.Namespace:
+			id = 0
+		case !sameSecond(created, l.CreatedAt):
+			// A different learning: its history goes with it
+			if _, err := tx.Exec(`DELETE FROM learning_revisions WHERE learning_id=?`, id); err != nil {
+				return nil, err
+			}
+		case content != l.Content || tags != l.Tags || confidence != l.Confidence:
+			if _, err := tx.Exec(`
+				INSERT INTO learning_revisions (learning_id, revision, content, tags, confidence, updated_at)
+				SELECT id, (SELECT COALESCE(MAX(revision), 0) + 1 FROM learning_revisions WHERE learning_id = learnings.id),
+				       content, tags, confidence, updated_at
+				FROM learnings WHERE id=?`, id); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if id > 0 {
+		_, err = tx.Exec(
+			`INSERT INTO learnings (id, namespace, category, content, tags, confidence, use_count, created_at, updated_at,
+			   superseded_by, deleted_at,
+			   source_client, source_client_version, source_session, source_conversation, source_author)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			 ON CONFLICT(id) DO UPDATE SET category=excluded.category, content=excluded.content, tags=excluded.tags,
+			   confidence=excluded.confidence, use_count=excluded.use_count,
+			   created_at=excluded.created_at, updated_at=excluded.updated_at, superseded_by=excluded.superseded_by,
+			   deleted_at=excluded.deleted_at,
+			   source_client=excluded.source_client, source_client_version=excluded.source_client_version,
+			   source_session=excluded.source_session, source_conversation=excluded.source_conversation,
+			   source_author=excluded.source_author`,
+			id, l.Namespace, l.Category, l.Content, l.Tags, l.Confidence, l.UseCount, l.CreatedAt, l.UpdatedAt,
+			l.SupersededBy, l.DeletedAt,
+			l.Source.Client, l.Source.ClientVersion, l.Source.Session, l.Source.Conversation, l.Source.Author)
+	} else {
+		var res sql.Result
+		res, err = tx.Exec(
+			`INSERT INTO learnings (namespace, category, content, tags, confidence, use_count, created_at, updated_at,
+			   superseded_by, deleted_at,
+			   source_client, source_client_version, source_session, source_conversation, source_author)
+			 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			l.Namespace, l.Category, l.Content, l.Tags, l.Confidence, l.UseCount, l.CreatedAt, l.UpdatedAt,
+			l.SupersededBy, l.DeletedAt,
+			l.Source.Client, l.Source.ClientVersion, l.Source.Session, l.Source.Conversation, l.Source.Author)
+		if err == nil {
+			id, err = res.LastInsertId()
+		}
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.storeEmbedding(id, l.Content)
+	stored := copyLearning(l)
+	stored.ID = strconv.FormatInt(id, 10)
+	return stored, nil
+}
+
+func (s *SQLiteBackend) PutRevisions(namespace, id string, revs []*Revision) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var n int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM learnings WHERE namespace=? AND id=?`, namespace, id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("not found: %s", id)
+	}
+	if _, err := tx.Exec(`DELETE FROM learning_revisions WHERE learning_id=?`, id); err != nil {
+		return err
+	}
+	for _, r := range revs {
+		if _, err := tx.Exec(
+			`INSERT INTO learning_revisions (learning_id, revision, content, tags, confidence, updated_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			id, r.Number, r.Content, r.Tags, r.Confidence, r.UpdatedAt,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func scanRevisions(rows *sql.Rows) ([]*Revision, error) {
+	var revisions []*Revision
+	for rows.Next() {
+		r := &Revision{}
+		if err := rows.Scan(&r.Number, &r.Content, &r.Tags, &r.Confidence, &r.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("scan: %w", err)
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
 func scanLearnings(rows *sql.Rows) ([]*Learning, error) {
 	var results []*Learning
 	for rows.Next() {
 		l := &Learning{}
 		var idInt int64
-		err := rows.Scan(&idInt, &l.Category, &l.Content, &l.Tags,
-			&l.Confidence, &l.UseCount, &l.CreatedAt, &l.UpdatedAt)
+		var deleted sql.NullTime
+		err := rows.Scan(append([]any{&idInt, &l.Namespace, &l.Category, &l.Content, &l.Tags,
+			&l.Confidence, &l.UseCount, &l.CreatedAt, &l.UpdatedAt, &l.SupersededBy, &deleted}, sourceDest(&l.Source)...)...)
 		if err != nil {
 			return nil, fmt.Errorf("scan: %w", err)
 		}
 		l.ID = strconv.FormatInt(idInt, 10)
+		if deleted.Valid {
+			l.DeletedAt = &deleted.Time
+		}
 		results = append(results, l)
 	}
 	return results, nil
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runExport writes learnings to a file, a directory or stdout. JSONL holds
+// every namespace in one stream; Markdown is one document per namespace,
+// so exporting several needs a directory to put them in.
+func runExport(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to TOML config file (default: look for config.toml in current dir)")
+	format := fs.String("format", "", "jsonl or markdown (default: from the output's extension, else jsonl)")
+	namespace := fs.String("namespace", "", "Only export this namespace (default: all)")
+	category := fs.String("category", "", "Only export this category")
+	output := fs.String("output", "-", "File to write, or a directory for one Markdown file per namespace; - for stdout")
+	fs.Parse(args)
+
+	_, backend := mustOpenBackend(*configPath)
+	defer backend.Close()
+	p, err := porterOf(backend)
+	if err != nil {
+		return err
+	}
+
+	namespaces := []string{*namespace}
+	if *namespace == "" {
+		if namespaces, err = p.Namespaces(); err != nil {
+			return err
+		}
+	}
+	dir := false
+	if info, err := os.Stat(*output); err == nil && info.IsDir() || strings.HasSuffix(*output, "/") {
+		dir = true
+	}
+	if *format == "" {
+		*format = formatJSONL
+		if dir || strings.HasSuffix(*output, ".md") {
+			*format = formatMarkdown
+		}
+	}
+	switch {
+	case *format != formatJSONL && *format != formatMarkdown:
+		return fmt.Errorf("unknown format %q (must be jsonl or markdown)", *format)
+	case *format == formatJSONL && dir:
+		return fmt.Errorf("JSONL is written to a single file, not a directory")
+	case *format == formatMarkdown && !dir && len(namespaces) > 1:
+		return fmt.Errorf("%d namespaces: pass --namespace or an --output directory", len(namespaces))
+	}
+
+	total := 0
+	writeTo := func(path string, write func(w io.Writer) error) error {
+		if path == "-" {
+			return write(os.Stdout)
+		}
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		if err := write(f); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}
+	load := func(ns string) ([]*Learning, error) {
+		ls, err := collectLearnings(p, ns)
+		if err == nil && *category != "" {
+			ls = filterCategory(ls, *category)
+		}
+		total += len(ls)
+		return ls, err
+	}
+
+	switch {
+	case *format == formatJSONL:
+		err = writeTo(*output, func(w io.Writer) error {
+			bw := bufio.NewWriter(w)
+			for _, ns := range namespaces {
+				ls, err := load(ns)
+				if err == nil {
+					err = attachRevisions(p, ls)
+				}
+				if err != nil {
+					return err
+				}
+				if err := writeJSONL(bw, ls); err != nil {
+					return err
+				}
+			}
+			return bw.Flush()
+		})
+	case dir:
+		if err := os.MkdirAll(*output, 0o755); err != nil {
+			return err
+		}
+		for _, ns := range namespaces {
+			ls, err := load(ns)
+			if err != nil {
+				return err
+			}
+			path := filepath.Join(*output, markdownFileName(ns))
+			if err := writeTo(path, func(w io.Writer) error { return writeMarkdown(w, ns, ls) }); err != nil {
+				return err
+			}
+		}
+	default:
+		err = writeTo(*output, func(w io.Writer) error {
+			ls, err := load(namespaces[0])
+			if err != nil {
+				return err
+			}
+			return writeMarkdown(w, namespaces[0], ls)
+		})
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Exported %d learnings from %d namespaces as %s\n", total, len(namespaces), *format)
+	return nil
+}
+
+// markdownFileName maps a namespace to a file name that is safe on any
+// filesystem; the namespace itself is kept in the front-matter.
+func markdownFileName(namespace string) string {
+	safe := strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' || r == '.' {
+			return r
+		}
+		return '_'
+	}, namespace)
+	return strings.TrimLeft(safe, ".") + ".md"
+}
+
+// runImport reads learnings from files, directories of Markdown files or
+// stdin and stores them, keeping their IDs, timestamps and use counts.
+func runImport(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to TOML config file (default: look for config.toml in current dir)")
+	format := fs.String("format", "", "jsonl or markdown (default: from each file's extension or contents)")
+	policy := fs.String("policy", importSkip, "When an imported ID is already stored: skip, overwrite or keep-newer")
+	namespace := fs.String("namespace", "", "Import everything into this namespace instead of the one recorded")
+	dryRun := fs.Bool("dry-run", false, "Report what would be imported without storing anything")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s import [flags] FILE|DIR|- ...\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return fmt.Errorf("nothing to import")
+	}
+	if !validImportPolicy(*policy) {
+		return fmt.Errorf("unknown conflict policy %q (must be skip, overwrite or keep-newer)", *policy)
+	}
+
+	var learnings []*Learning
+	for _, arg := range fs.Args() {
+		ls, err := readImportPath(arg, *format)
+		if err != nil {
+			return err
+		}
+		learnings = append(learnings, ls...)
+	}
+	if *namespace != "" {
+		for _, l := range learnings {
+			l.Namespace = *namespace
+		}
+	}
+
+	_, backend := mustOpenBackend(*configPath)
+	defer backend.Close()
+	p, err := porterOf(backend)
+	if err != nil {
+		return err
+	}
+	counts, err := importLearnings(p, learnings, *policy, *dryRun)
+	if err != nil {
+		return fmt.Errorf("after %s: %w", counts, err)
+	}
+	if *dryRun {
+		fmt.Printf("Dry run: would import %d learnings: %s\n", len(learnings), counts)
+	} else {
+		fmt.Printf("Imported %d learnings: %s\n", len(learnings), counts)
+	}
+	return nil
+}
+
+// readImportPath parses a file, every Markdown and JSONL file in a
+// directory, or stdin for "-".
+func readImportPath(path, format string) ([]*Learning, error) {
+	if path == "-" {
+		return parseLearnings(os.Stdin, format, "", defaultNamespace)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		ls, err := parseLearnings(f, format, path, defaultNamespace)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return ls, nil
+	}
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var all []*Learning
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".md", ".markdown", ".jsonl", ".ndjson":
+		default:
+			continue
+		}
+		if e.IsDir() {
+			continue
+		}
+		ls, err := readImportPath(filepath.Join(path, e.Name()), format)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, ls...)
+	}
+	return all, nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runHistory lists the revisions of a learning, diffs two of them, or
+// reverts it to an earlier one.
+func runHistory(args []string) error {
+	fs := flag.NewFlagSet("history", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to TOML config file (default: look for config.toml in current dir)")
+	namespace := fs.String("namespace", defaultNamespace, "Namespace the learning is in")
+	diff := fs.String("diff", "", "Show the changes between two revisions, FROM:TO, or from FROM to the current one")
+	revert := fs.Int("revert", 0, "Make this revision current again")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: %s history [flags] ID\n\nFlags:\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("expected one learning ID")
+	}
+	if *diff != "" && *revert != 0 {
+		return fmt.Errorf("--diff and --revert can't be combined")
+	}
+	id := fs.Arg(0)
+
+	_, backend := mustOpenBackend(*configPath)
+	defer backend.Close()
+
+	if *revert != 0 {
+		if _, err := revertLearning(backend, *namespace, id, *revert, Source{Client: "self-improvement-mcp history"}); err != nil {
+			return err
+		}
+		fmt.Printf("Reverted learning %s to revision %d\n", id, *revert)
+		return nil
+	}
+
+	history, err := learningHistory(backend, *namespace, id)
+	if err != nil {
+		return err
+	}
+	if *diff == "" {
+		fmt.Print(formatHistory(id, history))
+		return nil
+	}
+	fromArg, toArg, hasTo := strings.Cut(*diff, ":")
+	from, err := strconv.Atoi(fromArg)
+	if err != nil {
+		return fmt.Errorf("--diff: %q is not a revision number", fromArg)
+	}
+	to := len(history)
+	if hasTo {
+		if to, err = strconv.Atoi(toArg); err != nil {
+			return fmt.Errorf("--diff: %q is not a revision number", toArg)
+		}
+	}
+	a, err := findRevision(history, from)
+	if err != nil {
+		return err
+	}
+	b, err := findRevision(history, to)
+	if err != nil {
+		return err
+	}
+	fmt.Print(diffRevisions(a, b))
+	return nil
+}
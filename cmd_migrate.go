@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// runMigrate copies every learning from the backend in one config file to
+// the backend in another, keeping IDs where the destination can, timestamps,
+// use counts and confidence. Learnings the destination already holds
+// unchanged are skipped, so an interrupted or repeated run is safe.
+func runMigrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "", "Config file of the backend to copy from (required)")
+	to := fs.String("to", "", "Config file of the backend to copy to (required)")
+	dryRun := fs.Bool("dry-run", false, "Report what would be copied without writing anything")
+	namespace := fs.String("namespace", "", "Only migrate this namespace (default: all)")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both --from and --to are required")
+	}
+	if a, b := absPath(*from), absPath(*to); a == b {
+		return fmt.Errorf("--from and --to are the same config file")
+	}
+
+	fromCfg, src, err := openConfiguredBackend(*from)
+	if err != nil {
+		return fmt.Errorf("--from: %w", err)
+	}
+	defer src.Close()
+	toCfg, dst, err := openConfiguredBackend(*to)
+	if err != nil {
+		return fmt.Errorf("--to: %w", err)
+	}
+	defer dst.Close()
+
+	srcPorter, ok := src.(Porter)
+	if !ok {
+		return fmt.Errorf("the %s backend can't be migrated from", fromCfg.Backend.Type)
+	}
+	dstPorter, ok := dst.(Porter)
+	if !ok {
+		return fmt.Errorf("the %s backend can't be migrated to", toCfg.Backend.Type)
+	}
+
+	namespaces := []string{*namespace}
+	if *namespace == "" {
+		if namespaces, err = srcPorter.Namespaces(); err != nil {
+			return err
+		}
+	}
+
+	verb := "Migrating"
+	if *dryRun {
+		verb = "Dry run: migrating"
+	}
+	fmt.Printf("%s %d namespaces from %s (%s) to %s (%s)\n",
+		verb, len(namespaces), fromCfg.Backend.Type, *from, toCfg.Backend.Type, *to)
+
+	start := time.Now()
+	var total migrateCounts
+	for _, ns := range namespaces {
+		counts, err := migrateNamespace(srcPorter, dstPorter, ns, *dryRun)
+		fmt.Printf("  %-20s %s\n", ns, counts)
+		total.add(counts)
+		if err != nil {
+			return fmt.Errorf("namespace %s (run again to resume): %w", ns, err)
+		}
+	}
+	if *dryRun {
+		fmt.Printf("Would migrate: %s\n", total)
+	} else {
+		fmt.Printf("Migrated: %s in %s\n", total, time.Since(start).Round(time.Millisecond))
+	}
+	return nil
+}
+
+// migrateCounts tallies what happened to a namespace's learnings.
+type migrateCounts struct {
+	created, updated, unchanged, renumbered int
+}
+
+func (c *migrateCounts) add(o migrateCounts) {
+	c.created += o.created
+	c.updated += o.updated
+	c.unchanged += o.unchanged
+	c.renumbered += o.renumbered
+}
+
+func (c migrateCounts) String() string {
+	s := fmt.Sprintf("%d new, %d updated, %d unchanged", c.created, c.updated, c.unchanged)
+	if c.renumbered > 0 {
+		s += fmt.Sprintf(" (%d with new IDs)", c.renumbered)
+	}
+	return s
+}
+
+// migrateNamespace copies one namespace, with the revision history of each
+// learning. A learning already in the destination is recognised by its ID
+// and creation time or, if it had to be given a new one, by its content and
+// creation time. A different learning holding its ID in the destination is
+// left alone and the copy given a new ID.
+func migrateNamespace(src, dst Porter, ns string, dryRun bool) (migrateCounts, error) {
+	_, history := src.(Historian)
+	var counts migrateCounts
+	byID := map[string]*Learning{}
+	byKey := map[string]*Learning{}
+	if err := dst.Each(ns, func(l *Learning) error {
+		byID[l.ID] = l
+		byKey[migrateKey(l)] = l
+		return nil
+	}); err != nil {
+		return counts, err
+	}
+
+	err := src.Each(ns, func(l *Learning) error {
+		l.Namespace = ns
+		existing, ok := byID[l.ID]
+		collides := ok && !sameSecond(existing.CreatedAt, l.CreatedAt)
+		if !ok || collides {
+			existing, ok = byKey[migrateKey(l)]
+		}
+		want := l.ID
+		revs, err := revisionsOf(src, ns, want)
+		if err != nil {
+			return fmt.Errorf("learning %s: %w", want, err)
+		}
+		onlyHistory := false
+		switch {
+		case ok && sameStoredLearning(existing, l):
+			have, err := revisionsOf(dst, ns, existing.ID)
+			if err != nil {
+				return fmt.Errorf("learning %s: %w", want, err)
+			}
+			if !history || sameRevisions(have, revs) {
+				counts.unchanged++
+				return nil
+			}
+			onlyHistory = true
+			counts.updated++
+		case ok:
+			counts.updated++
+		default:
+			counts.created++
+		}
+		if dryRun {
+			return nil
+		}
+		switch {
+		case ok:
+			l.ID = existing.ID
+		case collides:
+			l.ID = ""
+		}
+		stored := existing
+		if !onlyHistory {
+			if stored, err = dst.Put(l); err != nil {
+				return fmt.Errorf("learning %s: %w", want, err)
+			}
+		}
+		if stored.ID != want {
+			counts.renumbered++
+		}
+		// Replacing the history also drops the revision Put just recorded
+		// of the destination's own version
+		if history {
+			if err := dst.PutRevisions(ns, stored.ID, revs); err != nil {
+				return fmt.Errorf("learning %s: revisions: %w", want, err)
+			}
+		}
+		// a later learning may carry the ID this one was just given
+		byID[stored.ID] = stored
+		byKey[migrateKey(stored)] = stored
+		return nil
+	})
+	return counts, err
+}
+
+// migrateKey identifies a learning independently of its ID. Creation times
+// are compared to the second, the coarsest any backend has stored them.
+func migrateKey(l *Learning) string {
+	return strconv.FormatInt(l.CreatedAt.Unix(), 10) + "\x00" + l.Content
+}
+
+// sameRevisions reports whether a and b hold the same versions, with
+// timestamps compared as sameStoredLearning does.
+func sameRevisions(a, b []*Revision) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Number != b[i].Number || a[i].Content != b[i].Content || a[i].Tags != b[i].Tags ||
+			a[i].Confidence != b[i].Confidence ||
+			!a[i].UpdatedAt.Truncate(time.Millisecond).Equal(b[i].UpdatedAt.Truncate(time.Millisecond)) {
+			return false
+		}
+	}
+	return true
+}
+
+// sameStoredLearning reports whether a and b agree on every stored field.
+// Timestamps are compared to the millisecond, since backends round them
+// differently.
+func sameStoredLearning(a, b *Learning) bool {
+	return a.Category == b.Category && a.Content == b.Content && a.Tags == b.Tags &&
+		a.Confidence == b.Confidence && a.UseCount == b.UseCount && a.SupersededBy == b.SupersededBy &&
+		a.Source == b.Source &&
+		a.CreatedAt.Truncate(time.Millisecond).Equal(b.CreatedAt.Truncate(time.Millisecond)) &&
+		a.UpdatedAt.Truncate(time.Millisecond).Equal(b.UpdatedAt.Truncate(time.Millisecond)) &&
+		(a.DeletedAt == nil) == (b.DeletedAt == nil) &&
+		(a.DeletedAt == nil || a.DeletedAt.Truncate(time.Millisecond).Equal(b.DeletedAt.Truncate(time.Millisecond)))
+}
+
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// testMemoryBackend returns an empty memory backend closed when the test
+// ends.
+func testMemoryBackend(t *testing.T) *MemoryBackend {
+	t.Helper()
+	m, err := NewMemoryBackend(MemoryConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { m.Close() })
+	return m
+}
+
+func putLearning(t *testing.T, p Porter, id, content string, created time.Time) *Learning {
+	t.Helper()
+	l, err := p.Put(&Learning{
+		ID: id, Namespace: "team", Category: "pattern", Content: content,
+		Confidence: 0.8, CreatedAt: created, UpdatedAt: created,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// TestMigrateIntoNonEmpty migrates into a destination where an unrelated
+// learning already holds one of the IDs: it must survive, the copy must get
+// a new ID, and running again must find everything unchanged.
+func TestMigrateIntoNonEmpty(t *testing.T) {
+	src, dst := testMemoryBackend(t), testMemoryBackend(t)
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	putLearning(t, src, "1", "run go vet before pushing", t0.Add(time.Hour))
+	putLearning(t, src, "2", "pin tool versions in CI", t0.Add(2*time.Hour))
+	putLearning(t, dst, "1", "the staging database is read-only", t0)
+
+	counts, err := migrateNamespace(src, dst, "team", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (migrateCounts{created: 2, renumbered: 2}); counts != want {
+		t.Fatalf("first run: %+v, want %+v", counts, want)
+	}
+	kept, err := dst.Get("team", "1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kept.Content != "the staging database is read-only" {
+		t.Fatalf("learning 1 was overwritten with %q", kept.Content)
+	}
+	var contents []string
+	dst.Each("team", func(l *Learning) error {
+		contents = append(contents, l.Content)
+		return nil
+	})
+	if len(contents) != 3 {
+		t.Fatalf("destination holds %q, want 3 learnings", contents)
+	}
+
+	counts, err = migrateNamespace(src, dst, "team", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (migrateCounts{unchanged: 2}); counts != want {
+		t.Fatalf("second run: %+v, want %+v", counts, want)
+	}
+
+	// The same ID and creation time is the same learning, updated in place
+	putLearning(t, src, "10", "cache module downloads", t0.Add(3*time.Hour))
+	if _, err := migrateNamespace(src, dst, "team", false); err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Update("team", "10", "cache module and build downloads", "", 0.9, Source{}); err != nil {
+		t.Fatal(err)
+	}
+	counts, err = migrateNamespace(src, dst, "team", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (migrateCounts{updated: 1, unchanged: 2}); counts != want {
+		t.Fatalf("after update: %+v, want %+v", counts, want)
+	}
+	updated, err := dst.Get("team", "10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Content != "cache module and build downloads" {
+		t.Fatalf("learning 10 is %q after migrating the update", updated.Content)
+	}
+}
+
+// TestMigrateRevisions migrates a learning with history: the copy must have
+// the same revisions, also when it was migrated before without them.
+func TestMigrateRevisions(t *testing.T) {
+	src, dst := testMemoryBackend(t), testMemoryBackend(t)
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	l := putLearning(t, src, "1", "run go vet before pushing", t0)
+	for _, content := range []string{"run go vet and staticcheck before pushing", "run make lint before pushing"} {
+		if err := src.Update("team", l.ID, content, "", 0.8, Source{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want, err := src.Revisions("team", l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// An earlier migration copied the learning without its history
+	current, err := src.Get("team", l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dst.Put(current); err != nil {
+		t.Fatal(err)
+	}
+	counts, err := migrateNamespace(src, dst, "team", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (migrateCounts{updated: 1}); counts != want {
+		t.Fatalf("first run: %+v, want %+v", counts, want)
+	}
+	got, err := dst.Revisions("team", l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sameRevisions(got, want) {
+		t.Fatalf("revisions %+v, want %+v", got, want)
+	}
+
+	counts, err = migrateNamespace(src, dst, "team", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (migrateCounts{unchanged: 1}); counts != want {
+		t.Fatalf("second run: %+v, want %+v", counts, want)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runReembed re-embeds every learning whose embedding is missing or came
+// from another embedder than the configured one, in batches. It is safe to
+// interrupt: the next run carries on with whatever is still stale.
+func runReembed(args []string) error {
+	fs := flag.NewFlagSet("reembed", flag.ExitOnError)
+	configPath := fs.String("config", "", "Path to TOML config file (default: look for config.toml in current dir)")
+	batch := fs.Int("batch", 0, "Learnings per batch (default: [embedding] batch_size)")
+	fs.Parse(args)
+
+	cfg, backend := mustOpenBackend(*configPath)
+	defer backend.Close()
+
+	r, ok := backend.(Reembedder)
+	if !ok {
+		return fmt.Errorf("the %s backend doesn't store embeddings", cfg.Backend.Type)
+	}
+	embedder := r.Embedder()
+	if embedder == nil {
+		return fmt.Errorf("no embedder configured: set [embedding] provider")
+	}
+	size := *batch
+	if size <= 0 {
+		size = cfg.Embedding.BatchSize
+	}
+	if size <= 0 {
+		size = 32
+	}
+
+	models, err := r.EmbeddingModels()
+	if err != nil {
+		return err
+	}
+	total, stale := 0, 0
+	for model, n := range models {
+		total += n
+		if model != embedder.Name() {
+			stale += n
+		}
+	}
+	if stale == 0 {
+		fmt.Printf("All %d learnings are embedded with %s\n", total, embedder.Name())
+		return nil
+	}
+	fmt.Printf("Re-embedding %d of %d learnings with %s, %d at a time\n", stale, total, embedder.Name(), size)
+
+	start := time.Now()
+	done := 0
+	for {
+		n, err := r.Reembed(size)
+		if err != nil {
+			return fmt.Errorf("after %d learnings (run again to resume): %w", done, err)
+		}
+		if n == 0 {
+			break
+		}
+		done += n
+		fmt.Printf("  %d/%d (%d%%)\n", done, stale, min(100, 100*done/stale))
+	}
+	fmt.Printf("Re-embedded %d learnings in %s\n", done, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// warnStaleEmbeddings logs at startup when stored embeddings came from
+// another embedder than the configured one, or are missing: vectors from
+// different models can't be compared with new query embeddings.
+func warnStaleEmbeddings(r Reembedder) {
+	models, err := r.EmbeddingModels()
+	if err != nil {
+		log.Printf("embedding check failed: %v", err)
+		return
+	}
+	current := r.Embedder().Name()
+	var stale []string
+	for model, n := range models {
+		if model != current && model != "" {
+			stale = append(stale, fmt.Sprintf("%d by %s", n, model))
+		}
+	}
+	sort.Strings(stale)
+	if len(stale) > 0 {
+		log.Printf("embeddings: %s, not the configured %s; they won't match new queries until you run `self-improvement-mcp reembed`",
+			strings.Join(stale, ", "), current)
+	}
+	if n := models[""]; n > 0 {
+		log.Printf("embeddings: %d learnings have none recorded; `self-improvement-mcp reembed` embeds them", n)
+	}
+}
@@ -0,0 +1,978 @@
+package main
+
+import (
+	"fmt"
+	"maps"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ── Backend conformance suite ─────────────────────────────────────────────────
+
+// conformanceCheck is one behaviour every Backend must share, so callers
+// (tools, resources, the permission and notification wrappers) can rely on
+// it whichever backend is configured. Each check gets an empty namespace.
+type conformanceCheck struct {
+	name string
+	run  func(b Backend, ns string) error
+}
+
+var conformanceChecks = []conformanceCheck{
+	{"add and get", checkAddGet},
+	{"get missing", checkGetMissing},
+	{"update", checkUpdate},
+	{"update missing", checkUpdateMissing},
+	{"delete", checkDelete},
+	{"list order and limit", checkListOrder},
+	{"list category filter", checkListCategory},
+	{"search", checkSearch},
+	{"use count", checkUseCount},
+	{"stats", checkStats},
+	{"namespace isolation", checkNamespaceIsolation},
+	{"bulk transfer", checkPorter},
+	{"superseded", checkSuperseded},
+	{"revisions", checkRevisions},
+	{"revisions through Put", checkPutRevisions},
+	{"trash", checkTrash},
+	{"source", checkSource},
+	{"embedding models", checkEmbeddingModels},
+}
+
+// TestConformance runs the suite against every backend that needs no
+// outside service; TestPostgresConformance covers PostgreSQL.
+func TestConformance(t *testing.T) {
+	dir := t.TempDir()
+	chroma := newFakeChroma()
+	defer chroma.Close()
+	hash := EmbeddingConfig{Provider: "hash"}
+
+	targets := []struct {
+		name      string
+		configure func(cfg *Config)
+	}{
+		{"memory", func(cfg *Config) { cfg.Backend.Type = "memory" }},
+		{"sqlite", func(cfg *Config) {
+			cfg.Backend.Type = "sqlite"
+			cfg.SQLite.Path = filepath.Join(dir, "keyword.db")
+		}},
+		{"sqlite hybrid", func(cfg *Config) {
+			cfg.Backend.Type = "sqlite"
+			cfg.SQLite.Path = filepath.Join(dir, "hybrid.db")
+			cfg.SQLite.SearchMode = searchHybrid
+			cfg.Embedding = hash
+		}},
+		{"chroma", func(cfg *Config) {
+			cfg.Backend.Type = "chroma"
+			cfg.Chroma.URL = chroma.URL
+			cfg.Chroma.Collection = "plain"
+		}},
+		{"chroma embedder", func(cfg *Config) {
+			cfg.Backend.Type = "chroma"
+			cfg.Chroma.URL = chroma.URL
+			cfg.Chroma.Collection = "embedded"
+			cfg.Embedding = hash
+		}},
+	}
+	for _, target := range targets {
+		t.Run(target.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			target.configure(cfg)
+			b, err := NewBackend(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			runConformance(t, b)
+		})
+	}
+}
+
+// runConformance runs every check against b as a subtest, each in its own
+// namespace, and removes what the checks stored.
+func runConformance(t *testing.T, b Backend) {
+	for i, c := range conformanceChecks {
+		t.Run(c.name, func(t *testing.T) {
+			ns := fmt.Sprintf("conformance-%d", i)
+			err := c.run(b, ns)
+			for _, n := range []string{ns, ns + "-other"} {
+				if cerr := clearNamespace(b, n); cerr != nil {
+					t.Errorf("cleanup %s: %v", n, cerr)
+				}
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// clearNamespace deletes every learning in ns, through Each where the
+// backend has it since List leaves superseded learnings out, and empties
+// the trash.
+func clearNamespace(b Backend, ns string) error {
+	var ls []*Learning
+	var err error
+	if p, ok := b.(Porter); ok {
+		err = p.Each(ns, func(l *Learning) error {
+			ls = append(ls, l)
+			return nil
+		})
+	} else {
+		ls, err = b.List(ns, "", "", 1000)
+	}
+	if err != nil {
+		return err
+	}
+	for _, l := range ls {
+		if l.DeletedAt != nil {
+			continue
+		}
+		if err := b.Delete(ns, l.ID); err != nil {
+			return err
+		}
+	}
+	if t, ok := b.(Trasher); ok {
+		_, err = t.Purge(ns, time.Now().Add(time.Hour))
+	}
+	return err
+}
+
+// conformanceTick separates writes whose order a check depends on, above
+// the timestamp resolution of every backend.
+const conformanceTick = 20 * time.Millisecond
+
+func checkAddGet(b Backend, ns string) error {
+	before := time.Now().Add(-time.Second)
+	added, err := b.Add(ns, "pitfall", "Never force-push to main", "git,safety", 0.9, Source{})
+	if err != nil {
+		return err
+	}
+	if added.ID == "" {
+		return fmt.Errorf("Add returned no ID")
+	}
+	if err := sameLearning(added, ns, "pitfall", "Never force-push to main", "git,safety", 0.9); err != nil {
+		return fmt.Errorf("Add: %w", err)
+	}
+	got, err := b.Get(ns, added.ID)
+	if err != nil {
+		return fmt.Errorf("Get: %w", err)
+	}
+	if err := sameLearning(got, ns, "pitfall", "Never force-push to main", "git,safety", 0.9); err != nil {
+		return fmt.Errorf("Get: %w", err)
+	}
+	if got.ID != added.ID {
+		return fmt.Errorf("Get: ID %q, want %q", got.ID, added.ID)
+	}
+	if got.UseCount != 0 {
+		return fmt.Errorf("Get: use count %d, want 0", got.UseCount)
+	}
+	if got.CreatedAt.Before(before) || got.UpdatedAt.Before(before) {
+		return fmt.Errorf("Get: timestamps %v / %v not set to now", got.CreatedAt, got.UpdatedAt)
+	}
+	return nil
+}
+
+func checkGetMissing(b Backend, ns string) error {
+	if _, err := b.Get(ns, "999999999"); err == nil {
+		return fmt.Errorf("Get of a missing ID succeeded")
+	}
+	return nil
+}
+
+func checkUpdate(b Backend, ns string) error {
+	l, err := b.Add(ns, "preference", "Prefers tabs", "style", 0.5, Source{})
+	if err != nil {
+		return err
+	}
+	b.IncrementUseCount(ns, l.ID)
+	before, err := b.Get(ns, l.ID)
+	if err != nil {
+		return err
+	}
+	time.Sleep(conformanceTick)
+	if err := b.Update(ns, l.ID, "Prefers spaces", "style,go", 0.7, Source{}); err != nil {
+		return fmt.Errorf("Update: %w", err)
+	}
+	got, err := b.Get(ns, l.ID)
+	if err != nil {
+		return err
+	}
+	if err := sameLearning(got, ns, "preference", "Prefers spaces", "style,go", 0.7); err != nil {
+		return err
+	}
+	if got.UseCount != 1 {
+		return fmt.Errorf("use count %d after Update, want 1", got.UseCount)
+	}
+	if !got.CreatedAt.Equal(before.CreatedAt) {
+		return fmt.Errorf("created_at changed from %v to %v", before.CreatedAt, got.CreatedAt)
+	}
+	if !got.UpdatedAt.After(before.UpdatedAt) {
+		return fmt.Errorf("updated_at %v not after %v", got.UpdatedAt, before.UpdatedAt)
+	}
+	return nil
+}
+
+func checkUpdateMissing(b Backend, ns string) error {
+	if err := b.Update(ns, "999999999", "x", "", 0.5, Source{}); err == nil {
+		return fmt.Errorf("Update of a missing ID succeeded")
+	}
+	if ls, err := b.List(ns, "", "", 10); err != nil || len(ls) != 0 {
+		return fmt.Errorf("Update of a missing ID stored something: %d learnings, %v", len(ls), err)
+	}
+	return nil
+}
+
+func checkDelete(b Backend, ns string) error {
+	keep, err := b.Add(ns, "general", "keep me", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	gone, err := b.Add(ns, "general", "delete me", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	if err := b.Delete(ns, gone.ID); err != nil {
+		return fmt.Errorf("Delete: %w", err)
+	}
+	if _, err := b.Get(ns, gone.ID); err == nil {
+		return fmt.Errorf("Get after Delete succeeded")
+	}
+	if _, err := b.Get(ns, keep.ID); err != nil {
+		return fmt.Errorf("Delete removed another learning: %w", err)
+	}
+	if err := b.Delete(ns, gone.ID); err == nil {
+		return fmt.Errorf("Delete of a missing ID succeeded")
+	}
+	return nil
+}
+
+func checkListOrder(b Backend, ns string) error {
+	var ids []string
+	for _, content := range []string{"first", "second", "third"} {
+		l, err := b.Add(ns, "general", content, "", 0.8, Source{})
+		if err != nil {
+			return err
+		}
+		ids = append(ids, l.ID)
+		time.Sleep(conformanceTick)
+	}
+	if err := listIs(b, ns, "", 10, ids[2], ids[1], ids[0]); err != nil {
+		return err
+	}
+	// Updating moves a learning to the front
+	if err := b.Update(ns, ids[0], "first, revised", "", 0.8, Source{}); err != nil {
+		return err
+	}
+	if err := listIs(b, ns, "", 10, ids[0], ids[2], ids[1]); err != nil {
+		return fmt.Errorf("after Update: %w", err)
+	}
+	return listIs(b, ns, "", 2, ids[0], ids[2])
+}
+
+func checkListCategory(b Backend, ns string) error {
+	p, err := b.Add(ns, "preference", "likes short answers", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	time.Sleep(conformanceTick)
+	if _, err := b.Add(ns, "pitfall", "forgot the tests", "", 0.8, Source{}); err != nil {
+		return err
+	}
+	if err := listIs(b, ns, "preference", 10, p.ID); err != nil {
+		return err
+	}
+	return listIs(b, ns, "technical", 10)
+}
+
+func checkSearch(b Backend, ns string) error {
+	for _, l := range []struct{ category, content string }{
+		{"technical", "The zebra cluster runs Kubernetes 1.29"},
+		{"pitfall", "Zebra deploys need the staging flag"},
+		{"preference", "Prefers concise answers"},
+		{"personal", "Lives in Lisbon"},
+	} {
+		if _, err := b.Add(ns, l.category, l.content, "", 0.8, Source{}); err != nil {
+			return err
+		}
+	}
+	results, err := b.Search(ns, "zebra", "", 10)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 || !strings.Contains(strings.ToLower(results[0].Content), "zebra") {
+		return fmt.Errorf("best result for %q is %s", "zebra", describe(results))
+	}
+	for _, l := range results {
+		if l.Namespace != ns {
+			return fmt.Errorf("result %s in namespace %q", l.ID, l.Namespace)
+		}
+	}
+	results, err = b.Search(ns, "zebra", "pitfall", 10)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		return fmt.Errorf("category filter: no results")
+	}
+	for _, l := range results {
+		if l.Category != "pitfall" {
+			return fmt.Errorf("category filter: got a %s learning", l.Category)
+		}
+	}
+	results, err = b.Search(ns, "zebra", "", 1)
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 {
+		return fmt.Errorf("limit 1: got %d results", len(results))
+	}
+	return nil
+}
+
+func checkUseCount(b Backend, ns string) error {
+	l, err := b.Add(ns, "general", "counted", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	b.IncrementUseCount(ns, l.ID)
+	b.IncrementUseCount(ns, l.ID)
+	b.IncrementUseCount(ns, "999999999")
+	got, err := b.Get(ns, l.ID)
+	if err != nil {
+		return err
+	}
+	if got.UseCount != 2 {
+		return fmt.Errorf("use count %d after two increments, want 2", got.UseCount)
+	}
+	if got.Content != "counted" || got.Confidence != 0.8 {
+		return fmt.Errorf("IncrementUseCount changed the learning: %q, %v", got.Content, got.Confidence)
+	}
+	return nil
+}
+
+func checkStats(b Backend, ns string) error {
+	if stats, err := b.Stats(ns); err != nil || len(stats) != 0 {
+		return fmt.Errorf("empty namespace: stats %v, %v", stats, err)
+	}
+	var last *Learning
+	for _, c := range []string{"pitfall", "pitfall", "preference"} {
+		l, err := b.Add(ns, c, "stat "+c, "", 0.8, Source{})
+		if err != nil {
+			return err
+		}
+		last = l
+	}
+	if err := statsAre(b, ns, map[string]int{"pitfall": 2, "preference": 1}); err != nil {
+		return err
+	}
+	if err := b.Delete(ns, last.ID); err != nil {
+		return err
+	}
+	return statsAre(b, ns, map[string]int{"pitfall": 2})
+}
+
+func checkNamespaceIsolation(b Backend, ns string) error {
+	other := ns + "-other"
+	l, err := b.Add(ns, "general", "only in the first namespace", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	if _, err := b.Get(other, l.ID); err == nil {
+		return fmt.Errorf("Get from another namespace succeeded")
+	}
+	if ls, err := b.List(other, "", "", 10); err != nil || len(ls) != 0 {
+		return fmt.Errorf("List of another namespace: %s, %v", describe(ls), err)
+	}
+	if ls, err := b.Search(other, "namespace", "", 10); err != nil || len(ls) != 0 {
+		return fmt.Errorf("Search of another namespace: %s, %v", describe(ls), err)
+	}
+	if stats, err := b.Stats(other); err != nil || len(stats) != 0 {
+		return fmt.Errorf("Stats of another namespace: %v, %v", stats, err)
+	}
+	if err := b.Update(other, l.ID, "overwritten", "", 0.1, Source{}); err == nil {
+		return fmt.Errorf("Update from another namespace succeeded")
+	}
+	if err := b.Delete(other, l.ID); err == nil {
+		return fmt.Errorf("Delete from another namespace succeeded")
+	}
+	b.IncrementUseCount(other, l.ID)
+	got, err := b.Get(ns, l.ID)
+	if err != nil {
+		return fmt.Errorf("learning gone after operations from another namespace: %w", err)
+	}
+	if got.Content != "only in the first namespace" || got.UseCount != 0 {
+		return fmt.Errorf("learning changed from another namespace: %q, use count %d", got.Content, got.UseCount)
+	}
+	return nil
+}
+
+// checkPorter covers the optional Porter methods; backends without them pass.
+func checkPorter(b Backend, ns string) error {
+	p, ok := b.(Porter)
+	if !ok {
+		return nil
+	}
+	l, err := b.Add(ns, "general", "original", "", 0.5, Source{})
+	if err != nil {
+		return err
+	}
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	updated := created.Add(36 * time.Hour)
+	replaced := &Learning{
+		ID: l.ID, Namespace: ns, Category: "technical", Content: "replaced", Tags: "a,b",
+		Confidence: 0.6, UseCount: 7, CreatedAt: created, UpdatedAt: updated,
+		Source: Source{Client: "porter", ClientVersion: "2.0", Session: "s-port", Conversation: "c-port", Author: "token:port"},
+	}
+	stored, err := p.Put(replaced)
+	if err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+	if stored.ID != l.ID {
+		return fmt.Errorf("Put of an existing ID stored it as %s", stored.ID)
+	}
+	got, err := b.Get(ns, l.ID)
+	if err != nil {
+		return err
+	}
+	if err := sameLearning(got, ns, "technical", "replaced", "a,b", 0.6); err != nil {
+		return fmt.Errorf("after Put: %w", err)
+	}
+	if got.UseCount != 7 || !got.CreatedAt.Equal(created) || !got.UpdatedAt.Equal(updated) {
+		return fmt.Errorf("Put didn't keep use count and timestamps: %d, %v, %v", got.UseCount, got.CreatedAt, got.UpdatedAt)
+	}
+	if got.Source != replaced.Source {
+		return fmt.Errorf("Put didn't keep the source: %+v, want %+v", got.Source, replaced.Source)
+	}
+
+	fresh, err := p.Put(&Learning{Namespace: ns, Category: "general", Content: "no ID", Confidence: 0.8, CreatedAt: created, UpdatedAt: created})
+	if err != nil {
+		return fmt.Errorf("Put without an ID: %w", err)
+	}
+	if fresh.ID == "" || fresh.ID == l.ID {
+		return fmt.Errorf("Put without an ID stored it as %q", fresh.ID)
+	}
+
+	namespaces, err := p.Namespaces()
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(namespaces, ns) {
+		return fmt.Errorf("Namespaces() = %v, missing %s", namespaces, ns)
+	}
+	var seen []string
+	if err := p.Each(ns, func(l *Learning) error {
+		if l.Namespace != ns {
+			return fmt.Errorf("Each returned learning %s in namespace %q", l.ID, l.Namespace)
+		}
+		seen = append(seen, l.ID)
+		return nil
+	}); err != nil {
+		return err
+	}
+	slices.Sort(seen)
+	want := []string{l.ID, fresh.ID}
+	slices.Sort(want)
+	if !slices.Equal(seen, want) {
+		return fmt.Errorf("Each returned %v, want %v", seen, want)
+	}
+	return nil
+}
+
+// checkSuperseded puts a learning marked superseded: Search, List and Stats
+// must leave it out while Get and Each still return it, and putting it back
+// unmarked must restore it.
+func checkSuperseded(b Backend, ns string) error {
+	p, ok := b.(Porter)
+	if !ok {
+		return nil
+	}
+	old, err := b.Add(ns, "technical", "Walrus builds use make", "", 0.6, Source{})
+	if err != nil {
+		return err
+	}
+	merged, err := b.Add(ns, "technical", "Walrus builds use make and need Go 1.22", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	old.SupersededBy = merged.ID
+	if _, err := p.Put(old); err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+
+	got, err := b.Get(ns, old.ID)
+	if err != nil {
+		return fmt.Errorf("Get of a superseded learning: %w", err)
+	}
+	if got.SupersededBy != merged.ID {
+		return fmt.Errorf("superseded_by %q, want %q", got.SupersededBy, merged.ID)
+	}
+	if err := listIs(b, ns, "", 10, merged.ID); err != nil {
+		return err
+	}
+	results, err := b.Search(ns, "walrus", "", 10)
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 || results[0].ID != merged.ID {
+		return fmt.Errorf("Search returned %s, want only %s", describe(results), merged.ID)
+	}
+	if err := statsAre(b, ns, map[string]int{"technical": 1}); err != nil {
+		return err
+	}
+	n := 0
+	if err := p.Each(ns, func(*Learning) error { n++; return nil }); err != nil {
+		return err
+	}
+	if n != 2 {
+		return fmt.Errorf("Each returned %d learnings, want 2", n)
+	}
+
+	old.SupersededBy = ""
+	if _, err := p.Put(old); err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+	if err := statsAre(b, ns, map[string]int{"technical": 2}); err != nil {
+		return fmt.Errorf("after restoring: %w", err)
+	}
+	return nil
+}
+
+// checkRevisions updates a learning three times, once changing nothing:
+// the two versions replaced must be its revisions, in order, without
+// showing up anywhere else, and go when it is deleted for good.
+func checkRevisions(b Backend, ns string) error {
+	h, ok := b.(Historian)
+	if !ok {
+		return nil
+	}
+	l, err := b.Add(ns, "technical", "Okapi service listens on 8080", "net", 0.6, Source{})
+	if err != nil {
+		return err
+	}
+	for _, u := range []struct {
+		content, tags string
+		confidence    float64
+	}{
+		{"Okapi service listens on 9090", "net", 0.6},
+		{"Okapi service listens on 9090", "net", 0.6},
+		{"Okapi service listens on 9090 behind nginx", "net,proxy", 0.9},
+	} {
+		time.Sleep(conformanceTick)
+		if err := b.Update(ns, l.ID, u.content, u.tags, u.confidence, Source{}); err != nil {
+			return err
+		}
+	}
+
+	revisions, err := h.Revisions(ns, l.ID)
+	if err != nil {
+		return err
+	}
+	if len(revisions) != 2 {
+		return fmt.Errorf("%d revisions, want 2", len(revisions))
+	}
+	for i, want := range []string{"Okapi service listens on 8080", "Okapi service listens on 9090"} {
+		if r := revisions[i]; r.Number != i+1 || r.Content != want || r.Tags != "net" || r.Confidence != 0.6 {
+			return fmt.Errorf("revision %d is %d %q %q %v, want %d %q", i, r.Number, r.Content, r.Tags, r.Confidence, i+1, want)
+		}
+	}
+	if !revisions[0].UpdatedAt.Before(revisions[1].UpdatedAt) {
+		return fmt.Errorf("revision times %v, %v out of order", revisions[0].UpdatedAt, revisions[1].UpdatedAt)
+	}
+	if other, err := h.Revisions(ns+"-other", l.ID); err != nil || len(other) != 0 {
+		return fmt.Errorf("another namespace sees %d revisions (%v)", len(other), err)
+	}
+	if err := listIs(b, ns, "", 10, l.ID); err != nil {
+		return err
+	}
+	results, err := b.Search(ns, "okapi", "", 10)
+	if err != nil {
+		return err
+	}
+	if len(results) != 1 || results[0].ID != l.ID {
+		return fmt.Errorf("Search returned %s, want only %s", describe(results), l.ID)
+	}
+	if err := statsAre(b, ns, map[string]int{"technical": 1}); err != nil {
+		return err
+	}
+
+	if err := b.Delete(ns, l.ID); err != nil {
+		return err
+	}
+	if t, ok := b.(Trasher); ok {
+		if revisions, err := h.Revisions(ns, l.ID); err != nil || len(revisions) != 2 {
+			return fmt.Errorf("in the trash: %d revisions (%v), want 2", len(revisions), err)
+		}
+		if _, err := t.Purge(ns, time.Now().Add(time.Hour)); err != nil {
+			return err
+		}
+	}
+	if revisions, err := h.Revisions(ns, l.ID); err != nil || len(revisions) != 0 {
+		return fmt.Errorf("after Delete: %d revisions (%v)", len(revisions), err)
+	}
+	return nil
+}
+
+// checkPutRevisions replaces a learning through Put: a change must be
+// recorded as a revision, as Update records it, and a different learning
+// put under its ID must not inherit its history. PutRevisions must replace
+// the history outright.
+func checkPutRevisions(b Backend, ns string) error {
+	p, ok := b.(Porter)
+	h, hok := b.(Historian)
+	if !ok || !hok {
+		return nil
+	}
+	added, err := b.Add(ns, "technical", "Gecko builds need cmake", "build", 0.6, Source{})
+	if err != nil {
+		return err
+	}
+	l, err := b.Get(ns, added.ID)
+	if err != nil {
+		return err
+	}
+	time.Sleep(conformanceTick)
+	edited := copyLearning(l)
+	edited.Content, edited.Confidence, edited.UpdatedAt = "Gecko builds need cmake 3.20", 0.7, time.Now()
+	for range 2 {
+		if _, err := p.Put(edited); err != nil {
+			return fmt.Errorf("Put: %w", err)
+		}
+	}
+	revisions, err := h.Revisions(ns, l.ID)
+	if err != nil {
+		return err
+	}
+	if len(revisions) != 1 || revisions[0].Content != "Gecko builds need cmake" || revisions[0].Confidence != 0.6 {
+		return fmt.Errorf("after Put: revisions %+v, want only the version added", revisions)
+	}
+
+	other := copyLearning(edited)
+	other.Content, other.CreatedAt = "Heron deploys on Fridays", l.CreatedAt.Add(-time.Hour)
+	if _, err := p.Put(other); err != nil {
+		return fmt.Errorf("Put: %w", err)
+	}
+	if revisions, err := h.Revisions(ns, l.ID); err != nil || len(revisions) != 0 {
+		return fmt.Errorf("a different learning under its ID has %d revisions (%v)", len(revisions), err)
+	}
+
+	t0 := time.Date(2024, 5, 1, 9, 0, 0, 0, time.UTC)
+	want := []*Revision{
+		{Number: 1, Content: "Heron deploys on Thursdays", Tags: "ops", Confidence: 0.5, UpdatedAt: t0},
+		{Number: 2, Content: "Heron deploys on Wednesdays", Tags: "ops,release", Confidence: 0.6, UpdatedAt: t0.Add(time.Hour)},
+	}
+	for range 2 {
+		if err := p.PutRevisions(ns, l.ID, want); err != nil {
+			return fmt.Errorf("PutRevisions: %w", err)
+		}
+	}
+	revisions, err = h.Revisions(ns, l.ID)
+	if err != nil {
+		return err
+	}
+	if !sameRevisions(revisions, want) {
+		return fmt.Errorf("after PutRevisions: %+v", revisions)
+	}
+	if err := p.PutRevisions(ns, "999999999", want); err == nil {
+		return fmt.Errorf("PutRevisions of a missing learning succeeded")
+	}
+	return nil
+}
+
+// checkTrash deletes two of three learnings: they must vanish from
+// everything but Trash and Each, one must come back intact on Restore, and
+// Purge must remove only what was deleted before its cutoff.
+func checkTrash(b Backend, ns string) error {
+	t, ok := b.(Trasher)
+	if !ok {
+		return nil
+	}
+	a, err := b.Add(ns, "general", "Quokka builds run nightly", "ci", 0.7, Source{})
+	if err != nil {
+		return err
+	}
+	kept, err := b.Add(ns, "general", "Quokka deploys need approval", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	c, err := b.Add(ns, "technical", "Quokka caches live in redis", "", 0.8, Source{})
+	if err != nil {
+		return err
+	}
+	for _, l := range []*Learning{a, c} {
+		time.Sleep(conformanceTick)
+		if err := b.Delete(ns, l.ID); err != nil {
+			return fmt.Errorf("Delete: %w", err)
+		}
+	}
+
+	if _, err := b.Get(ns, a.ID); err == nil {
+		return fmt.Errorf("Get of a deleted learning succeeded")
+	}
+	if err := b.Update(ns, a.ID, "changed", "", 0.5, Source{}); err == nil {
+		return fmt.Errorf("Update of a deleted learning succeeded")
+	}
+	if err := b.Delete(ns, a.ID); err == nil {
+		return fmt.Errorf("Delete of a deleted learning succeeded")
+	}
+	if err := listIs(b, ns, "", 10, kept.ID); err != nil {
+		return err
+	}
+	if results, err := b.Search(ns, "quokka", "", 10); err != nil || len(results) != 1 || results[0].ID != kept.ID {
+		return fmt.Errorf("Search returned %s (%v), want only %s", describe(results), err, kept.ID)
+	}
+	if err := statsAre(b, ns, map[string]int{"general": 1}); err != nil {
+		return err
+	}
+	trashIs := func(category string, ids ...string) error {
+		ls, err := t.Trash(ns, category, 10)
+		if err != nil {
+			return err
+		}
+		var got []string
+		for _, l := range ls {
+			if l.DeletedAt == nil {
+				return fmt.Errorf("Trash returned %s without a deletion time", l.ID)
+			}
+			got = append(got, l.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(ids, ",") {
+			return fmt.Errorf("Trash(%q) = [%s], want [%s]", category, strings.Join(got, ","), strings.Join(ids, ","))
+		}
+		return nil
+	}
+	if err := trashIs("", c.ID, a.ID); err != nil {
+		return err
+	}
+	if err := trashIs("technical", c.ID); err != nil {
+		return err
+	}
+	if p, ok := b.(Porter); ok {
+		trashed := 0
+		if err := p.Each(ns, func(l *Learning) error {
+			if l.DeletedAt != nil {
+				trashed++
+			}
+			return nil
+		}); err != nil || trashed != 2 {
+			return fmt.Errorf("Each returned %d deleted learnings (%v), want 2", trashed, err)
+		}
+	}
+	if other, err := t.Trash(ns+"-other", "", 10); err != nil || len(other) != 0 {
+		return fmt.Errorf("another namespace's trash holds %d learnings (%v)", len(other), err)
+	}
+
+	if err := t.Restore(ns+"-other", a.ID); err == nil {
+		return fmt.Errorf("Restore from another namespace succeeded")
+	}
+	if err := t.Restore(ns, kept.ID); err == nil {
+		return fmt.Errorf("Restore of a learning not in the trash succeeded")
+	}
+	if err := t.Restore(ns, a.ID); err != nil {
+		return fmt.Errorf("Restore: %w", err)
+	}
+	restored, err := b.Get(ns, a.ID)
+	if err != nil {
+		return fmt.Errorf("Get after Restore: %w", err)
+	}
+	if err := sameLearning(restored, ns, "general", "Quokka builds run nightly", "ci", 0.7); err != nil {
+		return fmt.Errorf("after Restore: %w", err)
+	}
+	if restored.DeletedAt != nil {
+		return fmt.Errorf("restored learning still has a deletion time")
+	}
+	if err := trashIs("", c.ID); err != nil {
+		return err
+	}
+
+	deleted, err := t.Trash(ns, "", 1)
+	if err != nil || len(deleted) != 1 {
+		return fmt.Errorf("Trash: %d learnings (%v)", len(deleted), err)
+	}
+	if n, err := t.Purge(ns, deleted[0].DeletedAt.Add(-time.Second)); err != nil || n != 0 {
+		return fmt.Errorf("Purge before the deletion removed %d (%v)", n, err)
+	}
+	if n, err := t.Purge(ns+"-other", time.Now().Add(time.Hour)); err != nil || n != 0 {
+		return fmt.Errorf("Purge of another namespace removed %d (%v)", n, err)
+	}
+	if n, err := t.Purge(ns, time.Now().Add(time.Hour)); err != nil || n != 1 {
+		return fmt.Errorf("Purge removed %d (%v), want 1", n, err)
+	}
+	if err := trashIs(""); err != nil {
+		return err
+	}
+	if err := t.Restore(ns, c.ID); err == nil {
+		return fmt.Errorf("Restore of a purged learning succeeded")
+	}
+	return statsAre(b, ns, map[string]int{"general": 2})
+}
+
+// checkEmbeddingModels counts the learnings of a backend with an embedder:
+// every learning, trashed ones too, counts once under the embedder, and
+// revisions not at all.
+func checkEmbeddingModels(b Backend, ns string) error {
+	r, ok := b.(Reembedder)
+	if !ok || r.Embedder() == nil {
+		return nil
+	}
+	a, err := b.Add(ns, "technical", "Okapi tests need a display", "ci", 0.6, Source{})
+	if err != nil {
+		return err
+	}
+	for _, content := range []string{"Okapi tests need xvfb", "Okapi tests need xvfb-run"} {
+		time.Sleep(conformanceTick)
+		if err := b.Update(ns, a.ID, content, "ci", 0.7, Source{}); err != nil {
+			return err
+		}
+	}
+	c, err := b.Add(ns, "technical", "Okapi ships on Fridays", "", 0.5, Source{})
+	if err != nil {
+		return err
+	}
+	if err := b.Delete(ns, c.ID); err != nil {
+		return err
+	}
+
+	want := map[string]int{r.Embedder().Name(): 2}
+	models, err := r.EmbeddingModels()
+	if err != nil {
+		return err
+	}
+	if !maps.Equal(models, want) {
+		return fmt.Errorf("EmbeddingModels: %v, want %v", models, want)
+	}
+	if n, err := r.Reembed(10); err != nil || n != 0 {
+		return fmt.Errorf("Reembed with nothing stale re-embedded %d (%v)", n, err)
+	}
+	return nil
+}
+
+// checkSource stores learnings from two sources: Add, Get and List must
+// keep each source, List must filter by a source's client, session,
+// conversation or author but nothing else, and Update must replace it.
+func checkSource(b Backend, ns string) error {
+	cli := Source{Client: "cli", ClientVersion: "1.0", Session: "s-1", Conversation: "https://example.com/c/1", Author: "token:alice"}
+	ide := Source{Client: "ide", Session: "s-2", Author: "token:bob"}
+	a, err := b.Add(ns, "general", "Tapirs sleep by day", "", 0.8, cli)
+	if err != nil {
+		return err
+	}
+	if a.Source != cli {
+		return fmt.Errorf("Add: source %+v, want %+v", a.Source, cli)
+	}
+	time.Sleep(conformanceTick)
+	c, err := b.Add(ns, "general", "Tapirs swim well", "", 0.8, ide)
+	if err != nil {
+		return err
+	}
+	if got, err := b.Get(ns, a.ID); err != nil {
+		return err
+	} else if got.Source != cli {
+		return fmt.Errorf("Get: source %+v, want %+v", got.Source, cli)
+	}
+
+	listFrom := func(source string, ids ...string) error {
+		ls, err := b.List(ns, "", source, 10)
+		if err != nil {
+			return err
+		}
+		var got []string
+		for _, l := range ls {
+			got = append(got, l.ID)
+		}
+		if strings.Join(got, ",") != strings.Join(ids, ",") {
+			return fmt.Errorf("List(source %q) = [%s], want [%s]", source, strings.Join(got, ","), strings.Join(ids, ","))
+		}
+		return nil
+	}
+	for _, tc := range []struct {
+		source string
+		ids    []string
+	}{
+		{"", []string{c.ID, a.ID}},
+		{"cli", []string{a.ID}},
+		{"s-2", []string{c.ID}},
+		{"https://example.com/c/1", []string{a.ID}},
+		{"token:bob", []string{c.ID}},
+		{"1.0", nil},
+		{"general", nil},
+	} {
+		if err := listFrom(tc.source, tc.ids...); err != nil {
+			return err
+		}
+	}
+
+	time.Sleep(conformanceTick)
+	if err := b.Update(ns, a.ID, "Tapirs sleep by day and forage at night", "", 0.8, ide); err != nil {
+		return err
+	}
+	if got, err := b.Get(ns, a.ID); err != nil {
+		return err
+	} else if got.Source != ide {
+		return fmt.Errorf("after Update: source %+v, want %+v", got.Source, ide)
+	}
+	if err := listFrom("cli"); err != nil {
+		return fmt.Errorf("after Update: %w", err)
+	}
+	if err := listFrom("token:bob", a.ID, c.ID); err != nil {
+		return fmt.Errorf("after Update: %w", err)
+	}
+	return nil
+}
+
+// ── Helpers ──
+
+func sameLearning(l *Learning, ns, category, content, tags string, confidence float64) error {
+	switch {
+	case l.Namespace != ns:
+		return fmt.Errorf("namespace %q, want %q", l.Namespace, ns)
+	case l.Category != category:
+		return fmt.Errorf("category %q, want %q", l.Category, category)
+	case l.Content != content:
+		return fmt.Errorf("content %q, want %q", l.Content, content)
+	case l.Tags != tags:
+		return fmt.Errorf("tags %q, want %q", l.Tags, tags)
+	case l.Confidence != confidence:
+		return fmt.Errorf("confidence %v, want %v", l.Confidence, confidence)
+	}
+	return nil
+}
+
+func listIs(b Backend, ns, category string, limit int, ids ...string) error {
+	ls, err := b.List(ns, category, "", limit)
+	if err != nil {
+		return err
+	}
+	var got []string
+	for _, l := range ls {
+		got = append(got, l.ID)
+	}
+	if strings.Join(got, ",") != strings.Join(ids, ",") {
+		return fmt.Errorf("List(%q, %d) = [%s], want [%s]", category, limit, strings.Join(got, ","), strings.Join(ids, ","))
+	}
+	return nil
+}
+
+func statsAre(b Backend, ns string, want map[string]int) error {
+	stats, err := b.Stats(ns)
+	if err != nil {
+		return err
+	}
+	if fmt.Sprint(stats) != fmt.Sprint(want) {
+		return fmt.Errorf("Stats = %v, want %v", stats, want)
+	}
+	return nil
+}
+
+func describe(ls []*Learning) string {
+	if len(ls) == 0 {
+		return "nothing"
+	}
+	var parts []string
+	for _, l := range ls {
+		parts = append(parts, fmt.Sprintf("%s:%q", l.ID, l.Content))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ── Near-duplicate detection ──────────────────────────────────────────────────
+
+// What store_learning does when the new learning nearly repeats a stored one.
+const (
+	dedupOff     = "off"     // store it anyway
+	dedupReject  = "reject"  // don't store it; point at the existing learning
+	dedupMerge   = "merge"   // don't store it; reinforce the existing learning instead
+	dedupSuggest = "suggest" // don't store it unless forced; list the candidates
+)
+
+func validDedupMode(mode string) bool {
+	switch mode {
+	case dedupOff, dedupReject, dedupMerge, dedupSuggest:
+		return true
+	}
+	return false
+}
+
+// duplicate is a stored learning that resembles a new one.
+type duplicate struct {
+	Learning   *Learning `json:"learning"`
+	Similarity float64   `json:"similarity"`
+}
+
+// findDuplicates searches the namespace for learnings in category at least
+// cfg.Threshold similar to content, most similar first. Similarity is the
+// word overlap of the two texts, or the embedding similarity Search
+// reports if that is higher, so both rewordings and paraphrases are caught.
+// Learnings in other categories are never duplicates: merging into one
+// would file the new learning under the wrong category.
+func findDuplicates(b Backend, namespace, category, content string, cfg DedupConfig) ([]duplicate, error) {
+	words := significantWords(content)
+	if len(words) == 0 {
+		return nil, nil
+	}
+	query := make([]string, 0, len(words))
+	for w := range words {
+		query = append(query, w)
+	}
+	sort.Strings(query)
+	candidates, err := b.Search(namespace, strings.Join(query, " "), category, cfg.Candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var dups []duplicate
+	for _, c := range candidates {
+		similarity := wordSimilarity(words, significantWords(c.Content))
+		if c.Match != nil && c.Match.Similarity > similarity {
+			similarity = c.Match.Similarity
+		}
+		if similarity >= cfg.Threshold {
+			c.Match = nil
+			dups = append(dups, duplicate{Learning: c, Similarity: similarity})
+		}
+	}
+	sort.SliceStable(dups, func(i, j int) bool { return dups[i].Similarity > dups[j].Similarity })
+	return dups, nil
+}
+
+// wordSimilarity is the Dice coefficient of two word sets: 1 when they are
+// the same, 0 when they share nothing.
+func wordSimilarity(a, b map[string]bool) float64 {
+	if len(a)+len(b) == 0 {
+		return 0
+	}
+	shared := 0
+	for w := range a {
+		if b[w] {
+			shared++
+		}
+	}
+	return 2 * float64(shared) / float64(len(a)+len(b))
+}
+
+// significantWords returns the distinct lower-cased words of s, leaving out
+// words too common to tell two learnings apart.
+func significantWords(s string) map[string]bool {
+	words := memoryTokens(s)
+	for w := range words {
+		if stopWords[w] {
+			delete(words, w)
+		}
+	}
+	return words
+}
+
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`a an and are as at be but by do does for from has have i if in into is it
+		its me my not of on or so than that the their them then there they this to too s use uses used user
+		was we were what when which who will with you your`) {
+		stopWords[w] = true
+	}
+}
+
+// mergeDuplicate reinforces an existing learning with a new observation of
+// it from source: confidence rises by step (at most to 1) and the new tags
+// are added. The existing content is kept.
+func mergeDuplicate(b Backend, namespace string, existing *Learning, tags string, step float64, source Source) (*Learning, error) {
+	merged := copyLearning(existing)
+	merged.Confidence = min(1, math.Round((existing.Confidence+step)*100)/100)
+	merged.Tags = unionTags(existing.Tags, tags)
+	if err := b.Update(namespace, existing.ID, merged.Content, merged.Tags, merged.Confidence, source); err != nil {
+		return nil, err
+	}
+	return b.Get(namespace, existing.ID)
+}
+
+// unionTags joins comma-separated tag lists, dropping repeats and blanks
+// and keeping first-seen order.
+func unionTags(lists ...string) string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, list := range lists {
+		for _, t := range strings.Split(list, ",") {
+			t = strings.TrimSpace(t)
+			if t != "" && !seen[strings.ToLower(t)] {
+				seen[strings.ToLower(t)] = true
+				tags = append(tags, t)
+			}
+		}
+	}
+	return strings.Join(tags, ",")
+}
+
+// formatDuplicates lists near-duplicates for the model.
+func formatDuplicates(dups []duplicate) string {
+	var sb strings.Builder
+	for _, d := range dups {
+		sb.WriteString(fmt.Sprintf("--- [ID:%s | %s | confidence:%.1f | similarity:%.2f]\n%s\n",
+			d.Learning.ID, d.Learning.Category, d.Learning.Confidence, d.Similarity, d.Learning.Content))
+	}
+	return sb.String()
+}
+
+// ── Merging ───────────────────────────────────────────────────────────────────
+
+// mergeLearnings consolidates several learnings into a new one with the
+// given content. It keeps the earliest creation time, the sum of the use
+// counts, the highest confidence and every tag; category defaults to the
+// first source's. The new learning is recorded as written by from. The
+// sources are kept, marked as superseded by the new learning, which is
+// returned with them. If marking a source fails, the merge is undone; a
+// *mergeError says what was left if that fails too.
+func mergeLearnings(b Backend, namespace string, ids []string, content, category, tags string, from Source) (*Learning, []*Learning, error) {
+	if strings.TrimSpace(content) == "" {
+		return nil, nil, fmt.Errorf("content is empty")
+	}
+	p, err := porterOf(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	var sources []*Learning
+	seen := map[string]bool{}
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		l, err := b.Get(namespace, id)
+		if err != nil {
+			return nil, nil, fmt.Errorf("learning ID:%s not found", id)
+		}
+		if l.SupersededBy != "" {
+			return nil, nil, fmt.Errorf("learning ID:%s was already merged into ID:%s", id, l.SupersededBy)
+		}
+		sources = append(sources, l)
+	}
+	if len(sources) < 2 {
+		return nil, nil, fmt.Errorf("merging needs at least two different IDs")
+	}
+
+	now := time.Now()
+	merged := &Learning{Namespace: namespace, Category: category, Content: content, CreatedAt: now, UpdatedAt: now, Source: from}
+	if merged.Category == "" {
+		merged.Category = sources[0].Category
+	}
+	tagLists := []string{tags}
+	for _, s := range sources {
+		merged.UseCount += s.UseCount
+		merged.Confidence = max(merged.Confidence, s.Confidence)
+		if s.CreatedAt.Before(merged.CreatedAt) {
+			merged.CreatedAt = s.CreatedAt
+		}
+		tagLists = append(tagLists, s.Tags)
+	}
+	merged.Tags = unionTags(tagLists...)
+
+	if merged, err = p.Put(merged); err != nil {
+		return nil, nil, err
+	}
+	var marked []*Learning // as they were before
+	for _, s := range sources {
+		original := copyLearning(s)
+		s.SupersededBy, s.UpdatedAt = merged.ID, now
+		if _, err := p.Put(s); err != nil {
+			err = fmt.Errorf("marking ID:%s superseded: %w", s.ID, err)
+			return nil, nil, undoMerge(b, p, merged, marked, sources, err)
+		}
+		marked = append(marked, original)
+	}
+	return merged, sources, nil
+}
+
+// mergeError is a merge that failed and couldn't be fully undone.
+type mergeError struct {
+	err      error
+	merged   *Learning // the merged learning, still stored
+	marked   []string  // sources still marked superseded by it
+	unmarked []string  // sources that aren't
+}
+
+func (e *mergeError) Error() string {
+	return fmt.Sprintf("%v; ID:%s is still stored and marks %d of the %d learnings superseded",
+		e.err, e.merged.ID, len(e.marked), len(e.marked)+len(e.unmarked))
+}
+
+func (e *mergeError) Unwrap() error { return e.err }
+
+// undoMerge puts back the sources already marked superseded as they were,
+// then removes the merged learning. It returns cause, or a *mergeError
+// wrapping it if something is left over.
+func undoMerge(b Backend, p Porter, merged *Learning, marked, sources []*Learning, cause error) error {
+	still := map[string]bool{}
+	var errs []error
+	for _, original := range marked {
+		if _, err := p.Put(original); err != nil {
+			still[original.ID] = true
+			errs = append(errs, fmt.Errorf("unmarking ID:%s: %w", original.ID, err))
+		}
+	}
+	if len(errs) == 0 {
+		err := discardLearning(b, p, merged)
+		if err == nil {
+			return fmt.Errorf("%w (the merge was undone)", cause)
+		}
+		errs = append(errs, fmt.Errorf("removing ID:%s: %w", merged.ID, err))
+	}
+
+	e := &mergeError{err: fmt.Errorf("%w; undoing the merge: %w", cause, errors.Join(errs...)), merged: merged, marked: []string{}}
+	for _, s := range sources {
+		if still[s.ID] {
+			e.marked = append(e.marked, s.ID)
+		} else {
+			e.unmarked = append(e.unmarked, s.ID)
+		}
+	}
+	return e
+}
+
+// discardLearning removes a learning for good. Where Delete only moves it
+// to the trash, it is put there as deleted at the Unix epoch, ahead of
+// everything else in the trash, and purged on its own.
+func discardLearning(b Backend, p Porter, l *Learning) error {
+	t, ok := b.(Trasher)
+	if !ok {
+		return b.Delete(l.Namespace, l.ID)
+	}
+	epoch := time.Unix(0, 0).UTC()
+	gone := copyLearning(l)
+	gone.DeletedAt = &epoch
+	if _, err := p.Put(gone); err != nil {
+		return err
+	}
+	_, err := t.Purge(l.Namespace, epoch.Add(time.Second))
+	return err
+}
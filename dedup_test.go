@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// flakyPutBackend is a memory backend whose Puts fail where fails says,
+// given their number counting from 1.
+type flakyPutBackend struct {
+	*MemoryBackend
+	fails func(n int) bool
+	puts  int
+}
+
+func (b *flakyPutBackend) Put(l *Learning) (*Learning, error) {
+	b.puts++
+	if b.fails != nil && b.fails(b.puts) {
+		return nil, errors.New("disk full")
+	}
+	return b.MemoryBackend.Put(l)
+}
+
+// mergeSources adds three learnings to merge and returns their IDs.
+func mergeSources(t *testing.T, b Backend) []string {
+	t.Helper()
+	var ids []string
+	for _, content := range []string{"use make build", "run make to build", "builds go through make"} {
+		l, err := b.Add("team", "technical", content, "build", 0.7, Source{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, l.ID)
+	}
+	return ids
+}
+
+func TestMerge(t *testing.T) {
+	m := testMemoryBackend(t)
+	ids := mergeSources(t, m)
+	merged, sources, err := mergeLearnings(m, "team", ids, "build with make", "", "", Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sources) != 3 {
+		t.Fatalf("%d sources, want 3", len(sources))
+	}
+	for _, id := range ids {
+		l, err := m.Get("team", id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if l.SupersededBy != merged.ID {
+			t.Errorf("ID:%s superseded by %q, want %s", id, l.SupersededBy, merged.ID)
+		}
+	}
+	if err := listIs(m, "team", "", 10, merged.ID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestMergeUndone fails to mark the second source: the first must be
+// unmarked again and the merged learning gone, even from the trash.
+func TestMergeUndone(t *testing.T) {
+	b := &flakyPutBackend{MemoryBackend: testMemoryBackend(t)}
+	ids := mergeSources(t, b)
+	b.fails = func(n int) bool { return n == 3 } // after the merged learning and the first source
+	_, _, err := mergeLearnings(b, "team", ids, "build with make", "", "", Source{})
+	if err == nil {
+		t.Fatal("merge succeeded")
+	}
+	var partial *mergeError
+	if errors.As(err, &partial) {
+		t.Fatalf("merge wasn't undone: %v", err)
+	}
+
+	var left []string
+	b.Each("team", func(l *Learning) error {
+		if l.SupersededBy != "" || l.DeletedAt != nil {
+			t.Errorf("ID:%s left superseded by %q, deleted at %v", l.ID, l.SupersededBy, l.DeletedAt)
+		}
+		left = append(left, l.ID)
+		return nil
+	})
+	slices.Sort(left)
+	if !slices.Equal(left, ids) {
+		t.Fatalf("namespace holds %v, want only %v", left, ids)
+	}
+}
+
+// TestMergeLeftOver fails every Put after the first source is marked, so
+// the merge can't be undone either: the result must say which sources are
+// marked and which aren't.
+func TestMergeLeftOver(t *testing.T) {
+	b := &flakyPutBackend{MemoryBackend: testMemoryBackend(t)}
+	ids := mergeSources(t, b)
+	b.fails = func(n int) bool { return n >= 3 }
+	args, _ := json.Marshal(map[string]any{"ids": ids, "content": "build with make"})
+	result := handleMerge(toolEnv{}, b, "team", args)
+	if !result.IsError {
+		t.Fatal("merge succeeded")
+	}
+	data, ok := result.StructuredContent.(map[string]any)
+	if !ok {
+		t.Fatalf("structured content %#v", result.StructuredContent)
+	}
+	merged, _ := data["learning"].(*Learning)
+	if merged == nil || !slices.Equal(data["superseded"].([]string), ids[:1]) || !slices.Equal(data["unmarked"].([]string), ids[1:]) {
+		t.Fatalf("result %+v, want %v superseded and %v unmarked", data, ids[:1], ids[1:])
+	}
+	first, err := b.Get("team", ids[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.SupersededBy != merged.ID {
+		t.Fatalf("ID:%s superseded by %q, want the merged ID:%s", first.ID, first.SupersededBy, merged.ID)
+	}
+	if _, err := b.Get("team", merged.ID); err != nil {
+		t.Fatalf("the merged learning: %v", err)
+	}
+}
+
+// TestDuplicatesSameCategory stores a learning repeating one in another
+// category: only a learning in its own category may count as a duplicate.
+func TestDuplicatesSameCategory(t *testing.T) {
+	m := testMemoryBackend(t)
+	env := toolEnv{dedup: DefaultConfig().Dedup}
+	env.dedup.Mode = dedupMerge
+	mistake, err := m.Add("team", "mistakes", "forgot to run the migrations before deploying", "", 0.7, Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := func(category string) map[string]any {
+		t.Helper()
+		args, _ := json.Marshal(map[string]any{"category": category, "content": "forgot to run the migrations before deploying"})
+		result := handleStore(env, m, "team", args)
+		data, _ := result.StructuredContent.(map[string]any)
+		if result.IsError || data == nil {
+			t.Fatalf("store_learning in %s: %+v", category, result)
+		}
+		return data
+	}
+	if data := store("technical"); data["action"] != "stored" {
+		t.Fatalf("a learning in another category counted as a duplicate: %+v", data)
+	}
+	if data := store("mistakes"); data["action"] != "merged" {
+		t.Fatalf("a learning in the same category wasn't merged: %+v", data)
+	}
+	if l, err := m.Get("team", mistake.ID); err != nil || l.Category != "mistakes" {
+		t.Fatalf("ID:%s after merging: %+v (%v)", mistake.ID, l, err)
+	}
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+)
+
+// Embedder turns text into vectors for semantic search. One embedder,
+// configured under [embedding], is shared by whichever backend is in use.
+type Embedder interface {
+	// Embed returns one vector per text, in order.
+	Embed(texts []string) ([][]float64, error)
+	// Dimensions is the length of the vectors, or 0 if only the model knows.
+	Dimensions() int
+	// Name identifies the provider and model in logs, e.g. "ollama/nomic-embed-text".
+	Name() string
+}
+
+const (
+	defaultHashDimensions   = 256
+	defaultEmbeddingTimeout = 30 * time.Second
+)
+
+// NewEmbedder builds the configured embedder, or returns nil if embeddings
+// are off.
+func NewEmbedder(cfg EmbeddingConfig) (Embedder, error) {
+	timeout := cfg.Timeout.Duration
+	if timeout <= 0 {
+		timeout = defaultEmbeddingTimeout
+	}
+	client := &http.Client{Timeout: timeout}
+	batch := cfg.BatchSize
+	if batch <= 0 {
+		batch = 32
+	}
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "ollama":
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("ollama embedder needs a model")
+		}
+		url := cfg.URL
+		if url == "" {
+			url = "http://ollama:11434"
+		}
+		return &ollamaEmbedder{client: client, url: strings.TrimSuffix(url, "/"), model: cfg.Model, dims: cfg.Dimensions, batch: batch}, nil
+	case "openai":
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("openai embedder needs a model")
+		}
+		url := cfg.URL
+		if url == "" {
+			url = "https://api.openai.com/v1"
+		}
+		key := cfg.APIKey
+		if cfg.APIKeyEnv != "" {
+			v, ok := os.LookupEnv(cfg.APIKeyEnv)
+			if !ok {
+				return nil, fmt.Errorf("environment variable %s not set", cfg.APIKeyEnv)
+			}
+			key = v
+		}
+		return &openAIEmbedder{client: client, url: strings.TrimSuffix(url, "/"), apiKey: key, model: cfg.Model, dims: cfg.Dimensions, batch: batch}, nil
+	case "hash":
+		dims := cfg.Dimensions
+		if dims <= 0 {
+			dims = defaultHashDimensions
+		}
+		return hashEmbedder{dims: dims}, nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider %q (must be ollama, openai or hash)", cfg.Provider)
+	}
+}
+
+// newEmbedder builds the configured embedder behind a cache, if one is
+// configured.
+func newEmbedder(cfg EmbeddingConfig) (Embedder, error) {
+	e, err := NewEmbedder(cfg)
+	if e == nil || err != nil || cfg.CacheSize <= 0 {
+		return e, err
+	}
+	return newCachingEmbedder(e, cfg.CacheSize), nil
+}
+
+// embedOne embeds a single text.
+func embedOne(e Embedder, text string) ([]float64, error) {
+	vs, err := e.Embed([]string{text})
+	if err != nil {
+		return nil, err
+	}
+	return vs[0], nil
+}
+
+// embedBatched calls embed on at most size texts at a time and checks that
+// every text got a vector back.
+func embedBatched(texts []string, size int, embed func([]string) ([][]float64, error)) ([][]float64, error) {
+	out := make([][]float64, 0, len(texts))
+	for start := 0; start < len(texts); start += size {
+		end := min(start+size, len(texts))
+		vs, err := embed(texts[start:end])
+		if err != nil {
+			return nil, err
+		}
+		if len(vs) != end-start {
+			return nil, fmt.Errorf("asked for %d embeddings, got %d", end-start, len(vs))
+		}
+		out = append(out, vs...)
+	}
+	return out, nil
+}
+
+// errNotFound marks a 404 from an embedding endpoint. message is the error
+// the API gave in a JSON {"error": …} body, "" if the body was anything else,
+// such as the plain-text 404 of a route the server doesn't have.
+type errNotFound struct{ url, message string }
+
+func (e errNotFound) Error() string {
+	if e.message != "" {
+		return e.url + " → 404: " + e.message
+	}
+	return e.url + " → 404"
+}
+
+// postJSON sends req as JSON and decodes the reply into resp.
+func postJSON(client *http.Client, url, apiKey string, req, resp any) error {
+	body, _ := json.Marshal(req)
+	httpReq, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	r, err := client.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode == http.StatusNotFound {
+		var apiErr struct {
+			Error string `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(r.Body, 1024)).Decode(&apiErr)
+		return errNotFound{url, apiErr.Error}
+	}
+	if r.StatusCode >= 400 {
+		data, _ := io.ReadAll(io.LimitReader(r.Body, 1024))
+		return fmt.Errorf("POST %s → %d: %s", url, r.StatusCode, strings.TrimSpace(string(data)))
+	}
+	return json.NewDecoder(r.Body).Decode(resp)
+}
+
+// ── Cache ─────────────────────────────────────────────────────────────────────
+
+// cachingEmbedder remembers the most recently used embeddings by content
+// hash, so repeated queries, unchanged updates and duplicate content are
+// embedded once.
+type cachingEmbedder struct {
+	Embedder
+	size int
+
+	mu    sync.Mutex
+	order *list.List // most recently used first; values are *cacheEntry
+	byKey map[[sha256.Size]byte]*list.Element
+}
+
+type cacheEntry struct {
+	key    [sha256.Size]byte
+	vector []float64
+}
+
+func newCachingEmbedder(e Embedder, size int) *cachingEmbedder {
+	return &cachingEmbedder{Embedder: e, size: size, order: list.New(), byKey: map[[sha256.Size]byte]*list.Element{}}
+}
+
+func (c *cachingEmbedder) Embed(texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	keys := make([][sha256.Size]byte, len(texts))
+	var missing []string
+	var missingAt []int
+
+	c.mu.Lock()
+	for i, text := range texts {
+		keys[i] = sha256.Sum256([]byte(text))
+		if el, ok := c.byKey[keys[i]]; ok {
+			c.order.MoveToFront(el)
+			out[i] = el.Value.(*cacheEntry).vector
+		} else {
+			missing = append(missing, text)
+			missingAt = append(missingAt, i)
+		}
+	}
+	c.mu.Unlock()
+	if len(missing) == 0 {
+		return out, nil
+	}
+
+	vectors, err := c.Embedder.Embed(missing)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for j, i := range missingAt {
+		out[i] = vectors[j]
+		if _, ok := c.byKey[keys[i]]; ok {
+			continue
+		}
+		c.byKey[keys[i]] = c.order.PushFront(&cacheEntry{keys[i], vectors[j]})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.byKey, oldest.Value.(*cacheEntry).key)
+		}
+	}
+	return out, nil
+}
+
+// ── Ollama ────────────────────────────────────────────────────────────────────
+
+// ollamaEmbedder uses Ollama's batched /api/embed, falling back to the
+// one-text-per-request /api/embeddings on servers older than 0.3.4. Those
+// answer /api/embed with a plain-text 404; a 404 with a JSON error is
+// Ollama reporting something else, such as a model that isn't pulled.
+type ollamaEmbedder struct {
+	client *http.Client
+	url    string
+	model  string
+	dims   int
+	batch  int
+	legacy atomic.Bool
+}
+
+func (e *ollamaEmbedder) Name() string    { return "ollama/" + e.model }
+func (e *ollamaEmbedder) Dimensions() int { return e.dims }
+
+func (e *ollamaEmbedder) Embed(texts []string) ([][]float64, error) {
+	return embedBatched(texts, e.batch, func(batch []string) ([][]float64, error) {
+		if e.legacy.Load() {
+			return e.embedLegacy(batch)
+		}
+		var resp struct {
+			Embeddings [][]float64 `json:"embeddings"`
+		}
+		err := postJSON(e.client, e.url+"/api/embed", "", map[string]any{"model": e.model, "input": batch}, &resp)
+		if nf, ok := err.(errNotFound); ok && nf.message == "" {
+			e.legacy.Store(true)
+			return e.embedLegacy(batch)
+		}
+		return resp.Embeddings, err
+	})
+}
+
+func (e *ollamaEmbedder) embedLegacy(texts []string) ([][]float64, error) {
+	var out [][]float64
+	for _, text := range texts {
+		var resp struct {
+			Embedding []float64 `json:"embedding"`
+		}
+		if err := postJSON(e.client, e.url+"/api/embeddings", "", map[string]any{"model": e.model, "prompt": text}, &resp); err != nil {
+			return nil, err
+		}
+		out = append(out, resp.Embedding)
+	}
+	return out, nil
+}
+
+// ── OpenAI-compatible ─────────────────────────────────────────────────────────
+
+// openAIEmbedder speaks the OpenAI /v1/embeddings API, which llama.cpp,
+// vLLM and LocalAI also serve. url is the API base, ending in /v1.
+type openAIEmbedder struct {
+	client *http.Client
+	url    string
+	apiKey string
+	model  string
+	dims   int
+	batch  int
+}
+
+func (e *openAIEmbedder) Name() string    { return "openai/" + e.model }
+func (e *openAIEmbedder) Dimensions() int { return e.dims }
+
+func (e *openAIEmbedder) Embed(texts []string) ([][]float64, error) {
+	return embedBatched(texts, e.batch, func(batch []string) ([][]float64, error) {
+		var resp struct {
+			Data []struct {
+				Index     int       `json:"index"`
+				Embedding []float64 `json:"embedding"`
+			} `json:"data"`
+		}
+		if err := postJSON(e.client, e.url+"/embeddings", e.apiKey, map[string]any{"model": e.model, "input": batch}, &resp); err != nil {
+			return nil, err
+		}
+		out := make([][]float64, len(batch))
+		for _, d := range resp.Data {
+			if d.Index < 0 || d.Index >= len(out) {
+				return nil, fmt.Errorf("embedding index %d out of range", d.Index)
+			}
+			out[d.Index] = d.Embedding
+		}
+		for i, v := range out {
+			if v == nil {
+				return nil, fmt.Errorf("no embedding returned for input %d", i)
+			}
+		}
+		return out, nil
+	})
+}
+
+// ── Local hashing ─────────────────────────────────────────────────────────────
+
+// hashEmbedder hashes lower-cased words into a fixed number of signed
+// buckets. It needs no model or network and always gives the same vector for
+// the same text, which makes it useful offline and in tests. Texts sharing
+// words are similar; paraphrases are not.
+type hashEmbedder struct {
+	dims int
+}
+
+func (e hashEmbedder) Name() string    { return fmt.Sprintf("hash/%d", e.dims) }
+func (e hashEmbedder) Dimensions() int { return e.dims }
+
+func (e hashEmbedder) Embed(texts []string) ([][]float64, error) {
+	out := make([][]float64, len(texts))
+	for i, text := range texts {
+		v := make([]float64, e.dims)
+		words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, w := range words {
+			h := fnv.New64a()
+			h.Write([]byte(w))
+			sum := h.Sum64()
+			sign := 1.0
+			if sum>>63 == 1 {
+				sign = -1
+			}
+			v[sum%uint64(e.dims)] += sign
+		}
+		var norm float64
+		for _, f := range v {
+			norm += f * f
+		}
+		if norm > 0 {
+			norm = math.Sqrt(norm)
+			for j := range v {
+				v[j] /= norm
+			}
+		}
+		out[i] = v
+	}
+	return out, nil
+}
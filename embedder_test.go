@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeOllama serves /api/embeddings, and /api/embed unless legacy; a model
+// other than "known" gets Ollama's JSON 404. It counts the requests to
+// each path.
+func fakeOllama(t *testing.T, legacy bool) (*httptest.Server, map[string]int) {
+	t.Helper()
+	calls := map[string]int{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls[r.URL.Path]++
+		var req struct {
+			Model string   `json:"model"`
+			Input []string `json:"input"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		switch {
+		case r.URL.Path == "/api/embed" && legacy, r.URL.Path != "/api/embed" && r.URL.Path != "/api/embeddings":
+			http.NotFound(w, r)
+		case req.Model != "known":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"model \"` + req.Model + `\" not found, try pulling it first"}`))
+		case r.URL.Path == "/api/embed":
+			embeddings := make([][]float64, len(req.Input))
+			for i := range embeddings {
+				embeddings[i] = []float64{1, 0}
+			}
+			json.NewEncoder(w).Encode(map[string]any{"embeddings": embeddings})
+		default:
+			json.NewEncoder(w).Encode(map[string]any{"embedding": []float64{0, 1}})
+		}
+	}))
+	t.Cleanup(ts.Close)
+	return ts, calls
+}
+
+func TestOllamaLegacyFallback(t *testing.T) {
+	for _, tc := range []struct {
+		name          string
+		legacy        bool
+		model         string
+		wantErr       string
+		wantLegacy    bool
+		wantEmbedding float64 // the first component
+	}{
+		{"current server", false, "known", "", false, 1},
+		{"old server", true, "known", "", true, 0},
+		{"model not pulled", false, "missing", `model "missing" not found`, false, 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			ts, calls := fakeOllama(t, tc.legacy)
+			e, err := NewEmbedder(EmbeddingConfig{Provider: "ollama", URL: ts.URL, Model: tc.model, Dimensions: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for range 2 {
+				vectors, err := e.Embed([]string{"a", "b"})
+				if tc.wantErr != "" {
+					if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+						t.Fatalf("error %v, want %q", err, tc.wantErr)
+					}
+					continue
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(vectors) != 2 || vectors[0][0] != tc.wantEmbedding {
+					t.Fatalf("embeddings %v", vectors)
+				}
+			}
+			if legacy := e.(*ollamaEmbedder).legacy.Load(); legacy != tc.wantLegacy {
+				t.Errorf("legacy = %v, want %v", legacy, tc.wantLegacy)
+			}
+			// Once it knows, it doesn't try /api/embed again
+			if tc.legacy && calls["/api/embed"] != 1 {
+				t.Errorf("/api/embed requested %d times", calls["/api/embed"])
+			}
+			if !tc.legacy && calls["/api/embeddings"] != 0 {
+				t.Errorf("/api/embeddings requested %d times", calls["/api/embeddings"])
+			}
+		})
+	}
+}
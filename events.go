@@ -0,0 +1,292 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Notification is a JSON-RPC notification (no ID, no reply expected).
+type Notification struct {
+	JSONRPC string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+// Event is a server-initiated notification queued for delivery to clients.
+type Event struct {
+	ID        string          // "<hub epoch>-<sequence>", used for Last-Event-ID resumption
+	Namespace string          // namespace the event concerns; "" = every namespace
+	URI       string          // resource the event concerns; only sent to subscribers. "" = everyone
+	Session   string          // session the event is for; "" = every session
+	Data      json.RawMessage // the encoded Notification
+}
+
+// EventHub fans server-initiated notifications out to every connected
+// client and keeps a bounded replay buffer so reconnecting clients can
+// resume from their Last-Event-ID.
+type EventHub struct {
+	mu     sync.Mutex
+	epoch  string // start time in nanoseconds, distinguishing IDs across restarts
+	seq    uint64
+	buffer []Event // oldest first, at most size entries
+	size   int
+	subs   map[chan Event]struct{}
+}
+
+const subscriberQueue = 64
+
+func NewEventHub(replaySize int) *EventHub {
+	return &EventHub{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		size:  replaySize,
+		subs:  map[chan Event]struct{}{},
+	}
+}
+
+// Publish queues a notification for every subscriber. When namespace is
+// non-empty only sessions that may use it receive it; when uri is non-empty
+// only sessions subscribed to that resource.
+func (h *EventHub) Publish(namespace, method, uri string, params any) {
+	h.publish(Event{Namespace: namespace, URI: uri}, method, params)
+}
+
+// PublishTo queues a notification for one session only.
+func (h *EventHub) PublishTo(session, method string, params any) {
+	h.publish(Event{Session: session}, method, params)
+}
+
+// publish fills in ev's ID and data and delivers it.
+func (h *EventHub) publish(ev Event, method string, params any) {
+	data, err := json.Marshal(Notification{JSONRPC: "2.0", Method: method, Params: params})
+	if err != nil {
+		log.Printf("event encode failed: %v", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.seq++
+	ev.ID, ev.Data = fmt.Sprintf("%s-%d", h.epoch, h.seq), data
+	if h.size > 0 {
+		h.buffer = append(h.buffer, ev)
+		if len(h.buffer) > h.size {
+			h.buffer = h.buffer[len(h.buffer)-h.size:]
+		}
+	}
+	for ch := range h.subs {
+		select {
+		case ch <- ev:
+		default:
+			// Subscriber can't keep up: disconnect it so it reconnects with
+			// Last-Event-ID and replays from the buffer instead of silently
+			// missing events.
+			delete(h.subs, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe registers a new listener. Events after lastEventID still in the
+// replay buffer are returned as backlog; gap reports that some events since
+// lastEventID were lost (evicted, or from before a restart) so the client
+// should refetch. Call cancel when done.
+func (h *EventHub) Subscribe(lastEventID string) (ch <-chan Event, backlog []Event, gap bool, cancel func()) {
+	c := make(chan Event, subscriberQueue)
+
+	h.mu.Lock()
+	if lastEventID != "" {
+		backlog, gap = h.replayAfter(lastEventID)
+	}
+	h.subs[c] = struct{}{}
+	h.mu.Unlock()
+
+	cancel = func() {
+		h.mu.Lock()
+		if _, ok := h.subs[c]; ok {
+			delete(h.subs, c)
+			close(c)
+		}
+		h.mu.Unlock()
+	}
+	return c, backlog, gap, cancel
+}
+
+// replayAfter must be called with h.mu held.
+func (h *EventHub) replayAfter(lastEventID string) ([]Event, bool) {
+	epoch, seqStr, ok := strings.Cut(lastEventID, "-")
+	seq, err := strconv.ParseUint(seqStr, 10, 64)
+	if !ok || err != nil || epoch != h.epoch || seq > h.seq {
+		return append([]Event(nil), h.buffer...), true
+	}
+	var out []Event
+	for _, ev := range h.buffer {
+		if eventSeq(ev.ID) > seq {
+			out = append(out, ev)
+		}
+	}
+	// Events between lastEventID and the oldest buffered one were evicted
+	gap := seq < h.seq && (len(h.buffer) == 0 || eventSeq(h.buffer[0].ID) > seq+1)
+	return out, gap
+}
+
+func eventSeq(id string) uint64 {
+	_, seqStr, _ := strings.Cut(id, "-")
+	n, _ := strconv.ParseUint(seqStr, 10, 64)
+	return n
+}
+
+// ── Change notifications ──────────────────────────────────────────────────────
+
+// notifyingBackend wraps a Backend and publishes change events whenever a
+// learning is added, updated or deleted, whichever client made the change.
+type notifyingBackend struct {
+	Backend
+	events *EventHub
+}
+
+func (b *notifyingBackend) Add(namespace, category, content, tags string, confidence float64, source Source) (*Learning, error) {
+	l, err := b.Backend.Add(namespace, category, content, tags, confidence, source)
+	if err == nil {
+		b.publishChange(namespace, "added", l.ID, l.Category)
+	}
+	return l, err
+}
+
+func (b *notifyingBackend) Update(namespace, id, content, tags string, confidence float64, source Source) error {
+	err := b.Backend.Update(namespace, id, content, tags, confidence, source)
+	if err == nil {
+		category := ""
+		if l, _ := b.Backend.Get(namespace, id); l != nil {
+			category = l.Category
+		}
+		b.publishChange(namespace, "updated", id, category)
+	}
+	return err
+}
+
+func (b *notifyingBackend) Delete(namespace, id string) error {
+	category := ""
+	if l, _ := b.Backend.Get(namespace, id); l != nil {
+		category = l.Category
+	}
+	err := b.Backend.Delete(namespace, id)
+	if err == nil {
+		b.publishChange(namespace, "deleted", id, category)
+	}
+	return err
+}
+
+func (b *notifyingBackend) Namespaces() ([]string, error) {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return p.Namespaces()
+}
+
+func (b *notifyingBackend) Each(namespace string, fn func(*Learning) error) error {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return err
+	}
+	return p.Each(namespace, fn)
+}
+
+func (b *notifyingBackend) Put(l *Learning) (*Learning, error) {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	action := "added"
+	if l.ID != "" {
+		if _, err := b.Backend.Get(l.Namespace, l.ID); err == nil {
+			action = "updated"
+		}
+	}
+	stored, err := p.Put(l)
+	if err == nil {
+		if stored.ID != l.ID {
+			action = "added"
+		}
+		b.publishChange(stored.Namespace, action, stored.ID, stored.Category)
+	}
+	return stored, err
+}
+
+func (b *notifyingBackend) PutRevisions(namespace, id string, revs []*Revision) error {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return err
+	}
+	return p.PutRevisions(namespace, id, revs)
+}
+
+func (b *notifyingBackend) Revisions(namespace, id string) ([]*Revision, error) {
+	h, err := historianOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return h.Revisions(namespace, id)
+}
+
+func (b *notifyingBackend) Trash(namespace, category string, limit int) ([]*Learning, error) {
+	t, err := trasherOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return t.Trash(namespace, category, limit)
+}
+
+func (b *notifyingBackend) Restore(namespace, id string) error {
+	t, err := trasherOf(b.Backend)
+	if err != nil {
+		return err
+	}
+	err = t.Restore(namespace, id)
+	if err == nil {
+		category := ""
+		if l, _ := b.Backend.Get(namespace, id); l != nil {
+			category = l.Category
+		}
+		b.publishChange(namespace, "restored", id, category)
+	}
+	return err
+}
+
+// Purge publishes nothing: the learnings it removes already left every
+// resource when they were deleted.
+func (b *notifyingBackend) Purge(namespace string, cutoff time.Time) (int, error) {
+	t, err := trasherOf(b.Backend)
+	if err != nil {
+		return 0, err
+	}
+	return t.Purge(namespace, cutoff)
+}
+
+// publishChange emits notifications/resources/updated for the learning and
+// its category collection, notifications/resources/list_changed when the
+// set of resources changed, and a notifications/learnings/changed event
+// describing the change for clients that track the store directly.
+func (b *notifyingBackend) publishChange(namespace, action, id, category string) {
+	uri := learningURI(id)
+	b.events.Publish(namespace, "notifications/resources/updated", uri, map[string]string{"uri": uri})
+	if category != "" {
+		catURI := categoryURI(category)
+		b.events.Publish(namespace, "notifications/resources/updated", catURI, map[string]string{"uri": catURI})
+	}
+	if action != "updated" {
+		b.events.Publish(namespace, "notifications/resources/list_changed", "", nil)
+	}
+	b.events.Publish(namespace, "notifications/learnings/changed", "", map[string]string{
+		"action":    action,
+		"namespace": namespace,
+		"id":        id,
+		"category":  category,
+		"uri":       uri,
+	})
+}
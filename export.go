@@ -0,0 +1,465 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ── Export formats ────────────────────────────────────────────────────────────
+
+const (
+	formatJSONL    = "jsonl"    // one full Learning per line, with its revisions
+	formatMarkdown = "markdown" // one document per namespace, grouped by category
+)
+
+// collectLearnings reads every learning in a namespace through Each.
+func collectLearnings(p Porter, namespace string) ([]*Learning, error) {
+	var ls []*Learning
+	err := p.Each(namespace, func(l *Learning) error {
+		l.Namespace = namespace
+		ls = append(ls, l)
+		return nil
+	})
+	return ls, err
+}
+
+// attachRevisions fills in the Revisions of learnings read from b, for
+// JSONL export; a backend that keeps no history leaves them empty.
+func attachRevisions(b any, learnings []*Learning) error {
+	for _, l := range learnings {
+		revs, err := revisionsOf(b, l.Namespace, l.ID)
+		if err != nil {
+			return fmt.Errorf("learning %s: %w", l.ID, err)
+		}
+		l.Revisions = revs
+	}
+	return nil
+}
+
+func writeJSONL(w io.Writer, learnings []*Learning) error {
+	enc := json.NewEncoder(w)
+	for _, l := range learnings {
+		c := copyLearning(l)
+		c.Revisions = l.Revisions
+		if err := enc.Encode(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readJSONL(r io.Reader) ([]*Learning, error) {
+	var ls []*Learning
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var l Learning
+		if err := json.Unmarshal([]byte(line), &l); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		l.Match = nil
+		ls = append(ls, &l)
+	}
+	return ls, scanner.Err()
+}
+
+// writeMarkdown renders one namespace's learnings for reading and editing by
+// hand: front-matter naming the namespace, a heading per category, and
+// under it a heading per learning with its ID, a list of its fields and its
+// content:
+//
+//	---
+//	namespace: default
+//	exported_at: 2025-01-02T15:04:05Z
+//	count: 1
+//	---
+//
+//	# preferences
+//
+//	## 12
+//
+//	- tags: style
+//	- confidence: 0.9
+//	- use_count: 4
+//	- created_at: 2024-11-30T09:12:00Z
+//	- updated_at: 2024-12-01T10:00:00Z
+//
+//	Prefers concise answers without preamble.
+//
+// A superseded learning also has a "superseded_by" field, one in the trash
+// a "deleted_at" field, and one with a known source a "source_…" field for
+// each part of it that is set. Content lines starting with "#" are escaped
+// with a backslash so they can't be mistaken for headings.
+func writeMarkdown(w io.Writer, namespace string, learnings []*Learning) error {
+	byCategory := map[string][]*Learning{}
+	var categories []string
+	for _, l := range learnings {
+		if _, ok := byCategory[l.Category]; !ok {
+			categories = append(categories, l.Category)
+		}
+		byCategory[l.Category] = append(byCategory[l.Category], l)
+	}
+	sort.Strings(categories)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "---\nnamespace: %s\nexported_at: %s\ncount: %d\n---\n",
+		namespace, time.Now().UTC().Format(time.RFC3339), len(learnings))
+	for _, category := range categories {
+		fmt.Fprintf(bw, "\n# %s\n", category)
+		for _, l := range byCategory[category] {
+			fmt.Fprintf(bw, "\n## %s\n\n", l.ID)
+			fmt.Fprintf(bw, "- tags: %s\n", l.Tags)
+			fmt.Fprintf(bw, "- confidence: %s\n", strconv.FormatFloat(l.Confidence, 'f', -1, 64))
+			fmt.Fprintf(bw, "- use_count: %d\n", l.UseCount)
+			fmt.Fprintf(bw, "- created_at: %s\n", l.CreatedAt.UTC().Format(time.RFC3339Nano))
+			fmt.Fprintf(bw, "- updated_at: %s\n", l.UpdatedAt.UTC().Format(time.RFC3339Nano))
+			if l.SupersededBy != "" {
+				fmt.Fprintf(bw, "- superseded_by: %s\n", l.SupersededBy)
+			}
+			if l.DeletedAt != nil {
+				fmt.Fprintf(bw, "- deleted_at: %s\n", l.DeletedAt.UTC().Format(time.RFC3339Nano))
+			}
+			for _, f := range markdownSourceFields(&l.Source) {
+				if *f.value != "" {
+					fmt.Fprintf(bw, "- %s: %s\n", f.name, *f.value)
+				}
+			}
+			fmt.Fprintf(bw, "\n")
+			for _, line := range strings.Split(strings.TrimRight(l.Content, "\n"), "\n") {
+				if markdownEscaped.MatchString(line) {
+					line = `\` + line
+				}
+				fmt.Fprintf(bw, "%s\n", line)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+var (
+	markdownEscaped = regexp.MustCompile(`^\\*#`)
+	markdownField   = regexp.MustCompile(`^- (tags|confidence|use_count|created_at|updated_at|superseded_by|deleted_at|source_client|source_client_version|source_session|source_conversation|source_author):\s*(.*)$`)
+)
+
+// readMarkdown parses what writeMarkdown writes. Hand-written learnings may
+// leave out any field: a learning headed "## new" (or with no field list at
+// all) is stored as a new learning. It returns the front-matter namespace,
+// "" if there is none.
+func readMarkdown(r io.Reader) (string, []*Learning, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var lines []string
+	for scanner.Scan() {
+		lines = append(lines, strings.TrimRight(scanner.Text(), "\r"))
+	}
+	if err := scanner.Err(); err != nil {
+		return "", nil, err
+	}
+
+	namespace := ""
+	i := 0
+	if len(lines) > 0 && lines[0] == "---" {
+		for i = 1; i < len(lines) && lines[i] != "---"; i++ {
+			if k, v, ok := strings.Cut(lines[i], ":"); ok && strings.TrimSpace(k) == "namespace" {
+				namespace = strings.TrimSpace(v)
+			}
+		}
+		if i == len(lines) {
+			return "", nil, fmt.Errorf("front-matter is not closed with ---")
+		}
+		i++
+	}
+
+	var ls []*Learning
+	var cur *Learning
+	var content []string
+	inFields := false
+	finish := func() {
+		if cur != nil {
+			cur.Content = strings.Trim(strings.Join(content, "\n"), "\n")
+			ls = append(ls, cur)
+		}
+		cur, content = nil, nil
+	}
+	category := ""
+	for n := i; n < len(lines); n++ {
+		line := lines[n]
+		switch {
+		case strings.HasPrefix(line, "# "):
+			finish()
+			category = strings.TrimSpace(line[2:])
+		case strings.HasPrefix(line, "## ") || line == "##":
+			finish()
+			if category == "" {
+				return "", nil, fmt.Errorf("line %d: learning before any # category heading", n+1)
+			}
+			id := strings.TrimSpace(strings.TrimPrefix(line, "##"))
+			if strings.EqualFold(id, "new") {
+				id = ""
+			}
+			cur = &Learning{ID: id, Namespace: namespace, Category: category}
+			inFields = true
+		case cur == nil:
+			if strings.TrimSpace(line) != "" {
+				return "", nil, fmt.Errorf("line %d: text outside a ## learning", n+1)
+			}
+		case inFields && strings.TrimSpace(line) == "" && len(content) == 0:
+			// blank lines around the field list
+		case inFields && markdownField.MatchString(line):
+			m := markdownField.FindStringSubmatch(line)
+			if err := setMarkdownField(cur, m[1], strings.TrimSpace(m[2])); err != nil {
+				return "", nil, fmt.Errorf("line %d: %w", n+1, err)
+			}
+		default:
+			inFields = false
+			if markdownEscaped.MatchString(line) && strings.HasPrefix(line, `\`) {
+				line = line[1:]
+			}
+			content = append(content, line)
+		}
+	}
+	finish()
+	return namespace, ls, nil
+}
+
+func setMarkdownField(l *Learning, name, value string) error {
+	var err error
+	switch name {
+	case "tags":
+		l.Tags = value
+	case "confidence":
+		l.Confidence, err = strconv.ParseFloat(value, 64)
+	case "use_count":
+		l.UseCount, err = strconv.Atoi(value)
+	case "created_at":
+		l.CreatedAt, err = time.Parse(time.RFC3339, value)
+	case "updated_at":
+		l.UpdatedAt, err = time.Parse(time.RFC3339, value)
+	case "superseded_by":
+		l.SupersededBy = value
+	case "deleted_at":
+		var t time.Time
+		if t, err = time.Parse(time.RFC3339, value); err == nil {
+			l.DeletedAt = &t
+		}
+	default:
+		for _, f := range markdownSourceFields(&l.Source) {
+			if f.name == name {
+				*f.value = value
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	return nil
+}
+
+// markdownSourceFields pairs the Markdown field names of a Source with the
+// fields they hold.
+func markdownSourceFields(src *Source) []struct {
+	name  string
+	value *string
+} {
+	return []struct {
+		name  string
+		value *string
+	}{
+		{"source_client", &src.Client},
+		{"source_client_version", &src.ClientVersion},
+		{"source_session", &src.Session},
+		{"source_conversation", &src.Conversation},
+		{"source_author", &src.Author},
+	}
+}
+
+// parseLearnings reads learnings in either format; "" detects it from the
+// name's extension, then from the data itself. Markdown learnings without
+// a front-matter namespace get defaultNS.
+func parseLearnings(r io.Reader, format, name, defaultNS string) ([]*Learning, error) {
+	br := bufio.NewReader(r)
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".md", ".markdown":
+			format = formatMarkdown
+		case ".jsonl", ".json", ".ndjson":
+			format = formatJSONL
+		default:
+			format = formatJSONL
+			if start, _ := br.Peek(3); len(start) > 0 && (start[0] == '#' || string(start) == "---") {
+				format = formatMarkdown
+			}
+		}
+	}
+	switch format {
+	case formatJSONL:
+		return readJSONL(br)
+	case formatMarkdown:
+		ns, ls, err := readMarkdown(br)
+		if ns == "" {
+			for _, l := range ls {
+				l.Namespace = defaultNS
+			}
+		}
+		return ls, err
+	default:
+		return nil, fmt.Errorf("unknown format %q (must be jsonl or markdown)", format)
+	}
+}
+
+func filterCategory(learnings []*Learning, category string) []*Learning {
+	var out []*Learning
+	for _, l := range learnings {
+		if l.Category == category {
+			out = append(out, l)
+		}
+	}
+	return out
+}
+
+// ── Importing ─────────────────────────────────────────────────────────────────
+
+// Import conflict policies, for a learning whose ID is already stored in
+// its namespace.
+const (
+	importSkip      = "skip"       // keep the stored learning
+	importOverwrite = "overwrite"  // replace it with the imported one
+	importKeepNewer = "keep-newer" // whichever was updated last wins
+)
+
+func validImportPolicy(policy string) bool {
+	return policy == importSkip || policy == importOverwrite || policy == importKeepNewer
+}
+
+// importCounts tallies what an import did.
+type importCounts struct {
+	Created     int `json:"created"`
+	Overwritten int `json:"overwritten"`
+	Skipped     int `json:"skipped"`
+	Renumbered  int `json:"renumbered"` // created under a new ID, as theirs was taken
+}
+
+func (c importCounts) String() string {
+	s := fmt.Sprintf("%d new, %d overwritten, %d skipped", c.Created, c.Overwritten, c.Skipped)
+	if c.Renumbered > 0 {
+		s += fmt.Sprintf(" (%d with new IDs)", c.Renumbered)
+	}
+	return s
+}
+
+// importLearnings stores learnings through p, resolving conflicts with
+// stored ones by policy. Learnings keep their namespace; fields a
+// hand-written record leaves out get the same defaults as store_learning.
+// A learning without an ID is skipped if its content is already stored, so
+// re-importing a hand-edited file doesn't duplicate its new entries. Like
+// migrate, a stored learning is the same one if it has the same ID and
+// creation time; a different learning holding the ID is left alone and the
+// import stored under a new ID.
+func importLearnings(p Porter, learnings []*Learning, policy string, dryRun bool) (importCounts, error) {
+	var counts importCounts
+	if !validImportPolicy(policy) {
+		return counts, fmt.Errorf("unknown conflict policy %q (must be skip, overwrite or keep-newer)", policy)
+	}
+	for i, l := range learnings {
+		if strings.TrimSpace(l.Content) == "" {
+			return counts, fmt.Errorf("learning %d (ID %q): content is empty", i+1, l.ID)
+		}
+		if err := validateLearning(l.Category, l.Confidence); err != nil {
+			return counts, fmt.Errorf("learning %d (ID %q): %w", i+1, l.ID, err)
+		}
+	}
+
+	type index struct{ byID, byContent, byKey map[string]*Learning }
+	stored := map[string]index{} // by namespace
+	now := time.Now()
+	for _, l := range learnings {
+		revs := l.Revisions
+		l = copyLearning(l)
+		if l.Namespace == "" {
+			l.Namespace = defaultNamespace
+		}
+		if l.Category == "" {
+			l.Category = "general"
+		}
+		if l.Confidence == 0 {
+			l.Confidence = 0.8
+		}
+		dated := !l.CreatedAt.IsZero()
+		if !dated {
+			l.CreatedAt = now
+		}
+		if l.UpdatedAt.IsZero() {
+			l.UpdatedAt = l.CreatedAt
+		}
+
+		idx, ok := stored[l.Namespace]
+		if !ok {
+			idx = index{map[string]*Learning{}, map[string]*Learning{}, map[string]*Learning{}}
+			if err := p.Each(l.Namespace, func(s *Learning) error {
+				idx.byID[s.ID] = s
+				idx.byContent[s.Content] = s
+				idx.byKey[migrateKey(s)] = s
+				return nil
+			}); err != nil {
+				return counts, err
+			}
+			stored[l.Namespace] = idx
+		}
+
+		// A record without a creation time can only be matched by ID
+		existing := idx.byID[l.ID]
+		collides := existing != nil && dated && !sameSecond(existing.CreatedAt, l.CreatedAt)
+		if collides {
+			existing = idx.byKey[migrateKey(l)]
+		}
+		switch {
+		case l.ID == "" && idx.byContent[l.Content] != nil:
+			// Hand-written and imported before
+			counts.Skipped++
+			continue
+		case l.ID == "" || existing == nil:
+			counts.Created++
+			if collides {
+				counts.Renumbered++
+				l.ID = ""
+			}
+		case policy == importOverwrite,
+			policy == importKeepNewer && l.UpdatedAt.After(existing.UpdatedAt):
+			counts.Overwritten++
+		default:
+			counts.Skipped++
+			continue
+		}
+		if dryRun {
+			continue
+		}
+		if existing != nil {
+			l.ID = existing.ID
+		}
+		put, err := p.Put(l)
+		if err != nil {
+			return counts, fmt.Errorf("learning %q: %w", l.ID, err)
+		}
+		if len(revs) > 0 {
+			if err := p.PutRevisions(put.Namespace, put.ID, revs); err != nil {
+				return counts, fmt.Errorf("learning %q: revisions: %w", put.ID, err)
+			}
+		}
+		idx.byID[put.ID] = put
+		idx.byContent[put.Content] = put
+		idx.byKey[migrateKey(put)] = put
+	}
+	return counts, nil
+}
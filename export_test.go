@@ -0,0 +1,166 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestImportForeignIDs imports learnings from another deployment whose IDs
+// are already taken here by different learnings: under every policy the
+// local ones must survive and the imported ones be stored under new IDs,
+// once.
+func TestImportForeignIDs(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	for _, policy := range []string{importSkip, importOverwrite, importKeepNewer} {
+		t.Run(policy, func(t *testing.T) {
+			m := testMemoryBackend(t)
+			local, err := m.Put(&Learning{
+				ID: "1", Namespace: "team", Category: "technical", Content: "deploys go through the staging cluster",
+				Confidence: 0.8, CreatedAt: t0, UpdatedAt: t0,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			foreign := []*Learning{{
+				ID: "1", Namespace: "team", Category: "mistakes", Content: "never rebase a shared branch",
+				Confidence: 0.9, CreatedAt: t0.Add(time.Hour), UpdatedAt: t0.Add(2 * time.Hour),
+			}}
+
+			counts, err := importLearnings(m, foreign, policy, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := (importCounts{Created: 1, Renumbered: 1}); counts != want {
+				t.Fatalf("first import: %+v, want %+v", counts, want)
+			}
+			kept, err := m.Get("team", "1")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kept.Content != local.Content {
+				t.Fatalf("learning 1 was overwritten with %q", kept.Content)
+			}
+
+			// Importing again finds the copy under its new ID
+			counts, err = importLearnings(m, foreign, policy, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if counts.Created != 0 || counts.Renumbered != 0 {
+				t.Fatalf("second import: %+v, want nothing new", counts)
+			}
+			var n int
+			m.Each("team", func(*Learning) error {
+				n++
+				return nil
+			})
+			if n != 2 {
+				t.Fatalf("namespace holds %d learnings, want 2", n)
+			}
+		})
+	}
+}
+
+// TestImportSameLearning re-imports a learning with its ID and creation
+// time: the policy decides, as before.
+func TestImportSameLearning(t *testing.T) {
+	t0 := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	m := testMemoryBackend(t)
+	if _, err := m.Put(&Learning{
+		ID: "7", Namespace: "team", Category: "technical", Content: "use go 1.25",
+		Confidence: 0.8, CreatedAt: t0, UpdatedAt: t0,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	edited := []*Learning{{
+		ID: "7", Namespace: "team", Category: "technical", Content: "use go 1.25 or later",
+		Confidence: 0.8, CreatedAt: t0, UpdatedAt: t0.Add(time.Hour),
+	}}
+	counts, err := importLearnings(m, edited, importSkip, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (importCounts{Skipped: 1}); counts != want {
+		t.Fatalf("skip: %+v, want %+v", counts, want)
+	}
+	counts, err = importLearnings(m, edited, importKeepNewer, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (importCounts{Overwritten: 1}); counts != want {
+		t.Fatalf("keep-newer: %+v, want %+v", counts, want)
+	}
+	l, err := m.Get("team", "7")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.Content != "use go 1.25 or later" {
+		t.Fatalf("learning 7 is %q", l.Content)
+	}
+}
+
+func TestImportRejectsInvalidFields(t *testing.T) {
+	for name, data := range map[string]string{
+		"category":   "---\nnamespace: team\n---\n\n# misc\n\n## new\n\nsomething\n",
+		"confidence": `{"namespace":"team","category":"general","content":"something","confidence":7}` + "\n",
+		"negative":   `{"namespace":"team","content":"something","confidence":-0.5}` + "\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			learnings, err := parseLearnings(strings.NewReader(data), "", "", "team")
+			if err != nil {
+				t.Fatal(err)
+			}
+			m := testMemoryBackend(t)
+			if _, err := importLearnings(m, learnings, importSkip, false); err == nil {
+				t.Fatal("import succeeded")
+			}
+			if ls, _ := m.List("team", "", "", 10); len(ls) != 0 {
+				t.Fatalf("stored %s", describe(ls))
+			}
+		})
+	}
+}
+
+// TestExportRevisions exports a learning with history as JSONL and imports
+// it elsewhere: its revisions must come along.
+func TestExportRevisions(t *testing.T) {
+	src, dst := testMemoryBackend(t), testMemoryBackend(t)
+	l, err := src.Add("team", "technical", "use go 1.24", "", 0.7, Source{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.Update("team", l.ID, "use go 1.25", "", 0.8, Source{}); err != nil {
+		t.Fatal(err)
+	}
+	want, err := src.Revisions("team", l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ls, err := collectLearnings(src, "team")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := attachRevisions(src, ls); err != nil {
+		t.Fatal(err)
+	}
+	var sb strings.Builder
+	if err := writeJSONL(&sb, ls); err != nil {
+		t.Fatal(err)
+	}
+	learnings, err := readJSONL(strings.NewReader(sb.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := importLearnings(dst, learnings, importSkip, false); err != nil {
+		t.Fatal(err)
+	}
+	got, err := dst.Revisions("team", l.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) != 1 || !sameRevisions(got, want) {
+		t.Fatalf("imported revisions %+v, want %+v", got, want)
+	}
+}
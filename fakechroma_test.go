@@ -0,0 +1,579 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ── Fake Chroma v2 server ─────────────────────────────────────────────────────
+
+// fakeChroma serves the part of the Chroma v2 HTTP API that ChromaBackend
+// uses, in memory, so the backend can be exercised without a live Chroma.
+// Like Chroma it fixes a collection's dimension on the first embedding,
+// merges metadata on update and ignores adds of existing IDs. Documents
+// added without an embedding get one from a hashing embedder, standing in
+// for Chroma's default embedding function.
+type fakeChroma struct {
+	mu          sync.Mutex
+	collections map[string]*fakeCollection // by ID
+	nextID      int
+	embedder    Embedder
+}
+
+type fakeCollection struct {
+	ID        string         `json:"id"`
+	Name      string         `json:"name"`
+	Dimension *int           `json:"dimension"`
+	Metadata  map[string]any `json:"metadata"`
+	records   []*fakeRecord  // insertion order
+}
+
+type fakeRecord struct {
+	id        string
+	document  string
+	metadata  map[string]any
+	embedding []float64
+}
+
+// newFakeChroma starts a fake Chroma; Close the server when done.
+func newFakeChroma() *httptest.Server {
+	f := &fakeChroma{collections: map[string]*fakeCollection{}, embedder: hashEmbedder{dims: 64}}
+	return httptest.NewServer(f)
+}
+
+// fakeChromaError is a request Chroma would reject.
+type fakeChromaError struct {
+	status int
+	msg    string
+}
+
+func (e *fakeChromaError) Error() string { return e.msg }
+
+func (f *fakeChroma) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	// /api/v2/tenants/{tenant}/databases/{database}/collections[/{id}[/{op}]]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 7 || parts[0] != "api" || parts[1] != "v2" || parts[2] != "tenants" || parts[4] != "databases" || parts[6] != "collections" {
+		http.NotFound(w, r)
+		return
+	}
+	parts = parts[7:]
+
+	var body map[string]json.RawMessage
+	if r.Method == http.MethodPost || r.Method == http.MethodPut {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeFakeChroma(w, nil, &fakeChromaError{http.StatusBadRequest, "invalid JSON: " + err.Error()})
+			return
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var resp any
+	var err error
+	switch {
+	case len(parts) == 0 && r.Method == http.MethodGet:
+		resp = f.list()
+	case len(parts) == 0 && r.Method == http.MethodPost:
+		resp, err = f.create(body)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		err = f.drop(parts[0])
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		err = f.rename(parts[0], body)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		c, ok := f.collections[parts[0]]
+		if !ok {
+			err = &fakeChromaError{http.StatusNotFound, "collection " + parts[0] + " does not exist"}
+			break
+		}
+		switch parts[1] {
+		case "add":
+			err = f.add(c, body)
+		case "get":
+			resp, err = f.get(c, body)
+		case "query":
+			resp, err = f.query(c, body)
+		case "update":
+			err = f.update(c, body)
+		case "upsert":
+			err = f.upsert(c, body)
+		case "delete":
+			err = f.delete(c, body)
+		case "count":
+			resp = len(c.records)
+		default:
+			err = &fakeChromaError{http.StatusNotFound, "unknown operation " + parts[1]}
+		}
+	default:
+		err = &fakeChromaError{http.StatusNotFound, "not found"}
+	}
+	writeFakeChroma(w, resp, err)
+}
+
+func writeFakeChroma(w http.ResponseWriter, resp any, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	if err != nil {
+		status := http.StatusInternalServerError
+		if ce, ok := err.(*fakeChromaError); ok {
+			status = ce.status
+		}
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]string{"error": http.StatusText(status), "message": err.Error()})
+		return
+	}
+	if resp == nil {
+		resp = map[string]any{}
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// decodeField unmarshals one field of a request body, if present.
+func decodeField(body map[string]json.RawMessage, name string, v any) error {
+	raw, ok := body[name]
+	if !ok || string(raw) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return &fakeChromaError{http.StatusBadRequest, fmt.Sprintf("%s: %v", name, err)}
+	}
+	return nil
+}
+
+// ── Collections ──
+
+func (f *fakeChroma) list() []*fakeCollection {
+	cols := make([]*fakeCollection, 0, len(f.collections))
+	for _, c := range f.collections {
+		cols = append(cols, c)
+	}
+	sort.Slice(cols, func(i, j int) bool { return cols[i].Name < cols[j].Name })
+	return cols
+}
+
+func (f *fakeChroma) byName(name string) *fakeCollection {
+	for _, c := range f.collections {
+		if c.Name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+func (f *fakeChroma) create(body map[string]json.RawMessage) (*fakeCollection, error) {
+	var name string
+	var getOrCreate bool
+	var metadata map[string]any
+	if err := decodeField(body, "name", &name); err != nil {
+		return nil, err
+	}
+	if err := decodeField(body, "metadata", &metadata); err != nil {
+		return nil, err
+	}
+	if err := decodeField(body, "get_or_create", &getOrCreate); err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return nil, &fakeChromaError{http.StatusBadRequest, "name is required"}
+	}
+	if c := f.byName(name); c != nil {
+		if !getOrCreate {
+			return nil, &fakeChromaError{http.StatusConflict, "collection " + name + " already exists"}
+		}
+		return c, nil
+	}
+	f.nextID++
+	c := &fakeCollection{ID: fmt.Sprintf("00000000-0000-0000-0000-%012d", f.nextID), Name: name, Metadata: metadata}
+	f.collections[c.ID] = c
+	return c, nil
+}
+
+func (f *fakeChroma) drop(name string) error {
+	c := f.byName(name)
+	if c == nil {
+		return &fakeChromaError{http.StatusNotFound, "collection " + name + " does not exist"}
+	}
+	delete(f.collections, c.ID)
+	return nil
+}
+
+func (f *fakeChroma) rename(id string, body map[string]json.RawMessage) error {
+	c, ok := f.collections[id]
+	if !ok {
+		return &fakeChromaError{http.StatusNotFound, "collection " + id + " does not exist"}
+	}
+	var name string
+	if err := decodeField(body, "new_name", &name); err != nil {
+		return err
+	}
+	if name != "" {
+		if other := f.byName(name); other != nil && other != c {
+			return &fakeChromaError{http.StatusConflict, "collection " + name + " already exists"}
+		}
+		c.Name = name
+	}
+	return nil
+}
+
+// ── Records ──
+
+// checkDimension fixes the collection's dimension on first use and rejects
+// embeddings of any other length afterwards.
+func (c *fakeCollection) checkDimension(emb []float64) error {
+	if c.Dimension == nil {
+		n := len(emb)
+		c.Dimension = &n
+		return nil
+	}
+	if len(emb) != *c.Dimension {
+		return &fakeChromaError{http.StatusBadRequest,
+			fmt.Sprintf("Collection expecting embedding with dimension of %d, got %d", *c.Dimension, len(emb))}
+	}
+	return nil
+}
+
+func (c *fakeCollection) find(id string) *fakeRecord {
+	for _, rec := range c.records {
+		if rec.id == id {
+			return rec
+		}
+	}
+	return nil
+}
+
+type fakeRecordsRequest struct {
+	ids        []string
+	documents  []string
+	metadatas  []map[string]any
+	embeddings [][]float64
+}
+
+func decodeRecords(body map[string]json.RawMessage) (fakeRecordsRequest, error) {
+	var req fakeRecordsRequest
+	for name, v := range map[string]any{"ids": &req.ids, "documents": &req.documents, "metadatas": &req.metadatas, "embeddings": &req.embeddings} {
+		if err := decodeField(body, name, v); err != nil {
+			return req, err
+		}
+	}
+	for name, n := range map[string]int{"documents": len(req.documents), "metadatas": len(req.metadatas), "embeddings": len(req.embeddings)} {
+		if n != 0 && n != len(req.ids) {
+			return req, &fakeChromaError{http.StatusBadRequest, fmt.Sprintf("%d ids but %d %s", len(req.ids), n, name)}
+		}
+	}
+	return req, nil
+}
+
+func (f *fakeChroma) add(c *fakeCollection, body map[string]json.RawMessage) error {
+	req, err := decodeRecords(body)
+	if err != nil {
+		return err
+	}
+	for i, id := range req.ids {
+		if c.find(id) != nil {
+			continue
+		}
+		rec := f.record(req, i)
+		if err := c.checkDimension(rec.embedding); err != nil {
+			return err
+		}
+		c.records = append(c.records, rec)
+	}
+	return nil
+}
+
+// record builds the i-th record of an add or upsert.
+func (f *fakeChroma) record(req fakeRecordsRequest, i int) *fakeRecord {
+	rec := &fakeRecord{id: req.ids[i], metadata: map[string]any{}}
+	if req.documents != nil {
+		rec.document = req.documents[i]
+	}
+	if req.metadatas != nil && req.metadatas[i] != nil {
+		rec.metadata = req.metadatas[i]
+	}
+	if req.embeddings != nil {
+		rec.embedding = req.embeddings[i]
+	} else {
+		rec.embedding, _ = embedOne(f.embedder, rec.document)
+	}
+	return rec
+}
+
+func (f *fakeChroma) update(c *fakeCollection, body map[string]json.RawMessage) error {
+	req, err := decodeRecords(body)
+	if err != nil {
+		return err
+	}
+	for i := range req.embeddings {
+		if err := c.checkDimension(req.embeddings[i]); err != nil {
+			return err
+		}
+	}
+	for i, id := range req.ids {
+		rec := c.find(id)
+		if rec == nil {
+			continue
+		}
+		if req.documents != nil {
+			rec.document = req.documents[i]
+		}
+		if req.metadatas != nil {
+			for k, v := range req.metadatas[i] {
+				if v == nil {
+					delete(rec.metadata, k)
+				} else {
+					rec.metadata[k] = v
+				}
+			}
+		}
+		if req.embeddings != nil {
+			rec.embedding = req.embeddings[i]
+		}
+	}
+	return nil
+}
+
+// upsert adds new IDs and replaces existing ones outright.
+func (f *fakeChroma) upsert(c *fakeCollection, body map[string]json.RawMessage) error {
+	req, err := decodeRecords(body)
+	if err != nil {
+		return err
+	}
+	for i, id := range req.ids {
+		rec := f.record(req, i)
+		if err := c.checkDimension(rec.embedding); err != nil {
+			return err
+		}
+		if old := c.find(id); old != nil {
+			*old = *rec
+		} else {
+			c.records = append(c.records, rec)
+		}
+	}
+	return nil
+}
+
+func (f *fakeChroma) delete(c *fakeCollection, body map[string]json.RawMessage) error {
+	var ids []string
+	if err := decodeField(body, "ids", &ids); err != nil {
+		return err
+	}
+	remove := map[string]bool{}
+	for _, id := range ids {
+		remove[id] = true
+	}
+	kept := c.records[:0]
+	for _, rec := range c.records {
+		if !remove[rec.id] {
+			kept = append(kept, rec)
+		}
+	}
+	c.records = kept
+	return nil
+}
+
+// selectRecords applies the ids and where filters of a get or query.
+func selectRecords(c *fakeCollection, body map[string]json.RawMessage) ([]*fakeRecord, error) {
+	var ids []string
+	var where map[string]any
+	if err := decodeField(body, "ids", &ids); err != nil {
+		return nil, err
+	}
+	if err := decodeField(body, "where", &where); err != nil {
+		return nil, err
+	}
+	wanted := map[string]bool{}
+	for _, id := range ids {
+		wanted[id] = true
+	}
+	var out []*fakeRecord
+	for _, rec := range c.records {
+		if len(ids) > 0 && !wanted[rec.id] {
+			continue
+		}
+		ok, err := fakeWhere(rec.metadata, where)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			out = append(out, rec)
+		}
+	}
+	return out, nil
+}
+
+// fakeWhere evaluates a Chroma metadata filter: $and, $or, and per-key
+// $eq, $ne, $in, $nin or a bare value.
+func fakeWhere(meta, where map[string]any) (bool, error) {
+	for key, cond := range where {
+		switch key {
+		case "$and", "$or":
+			clauses, _ := cond.([]any)
+			matched := false
+			for _, c := range clauses {
+				sub, _ := c.(map[string]any)
+				ok, err := fakeWhere(meta, sub)
+				if err != nil {
+					return false, err
+				}
+				if key == "$and" && !ok {
+					return false, nil
+				}
+				matched = matched || ok
+			}
+			if key == "$or" && !matched {
+				return false, nil
+			}
+			continue
+		}
+		ops, isOps := cond.(map[string]any)
+		if !isOps {
+			ops = map[string]any{"$eq": cond}
+		}
+		v, present := meta[key]
+		for op, want := range ops {
+			var ok bool
+			switch op {
+			case "$eq":
+				ok = present && fmt.Sprint(v) == fmt.Sprint(want)
+			case "$ne":
+				ok = !present || fmt.Sprint(v) != fmt.Sprint(want)
+			case "$in", "$nin":
+				list, _ := want.([]any)
+				for _, w := range list {
+					if present && fmt.Sprint(v) == fmt.Sprint(w) {
+						ok = true
+					}
+				}
+				if op == "$nin" {
+					ok = !ok
+				}
+			default:
+				return false, &fakeChromaError{http.StatusBadRequest, "unsupported operator " + op}
+			}
+			if !ok {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}
+
+func fakeIncludes(body map[string]json.RawMessage, field string) bool {
+	var include []string
+	if _, ok := body["include"]; !ok {
+		return field == "documents" || field == "metadatas"
+	}
+	decodeField(body, "include", &include)
+	for _, f := range include {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *fakeChroma) get(c *fakeCollection, body map[string]json.RawMessage) (map[string]any, error) {
+	recs, err := selectRecords(c, body)
+	if err != nil {
+		return nil, err
+	}
+	var limit, offset int
+	decodeField(body, "limit", &limit)
+	decodeField(body, "offset", &offset)
+	recs = recs[min(offset, len(recs)):]
+	if limit > 0 && len(recs) > limit {
+		recs = recs[:limit]
+	}
+
+	ids := []string{}
+	var docs []string
+	var metas []map[string]any
+	for _, rec := range recs {
+		ids = append(ids, rec.id)
+		docs = append(docs, rec.document)
+		metas = append(metas, rec.metadata)
+	}
+	resp := map[string]any{"ids": ids}
+	if fakeIncludes(body, "documents") {
+		resp["documents"] = docs
+	}
+	if fakeIncludes(body, "metadatas") {
+		resp["metadatas"] = metas
+	}
+	return resp, nil
+}
+
+func (f *fakeChroma) query(c *fakeCollection, body map[string]json.RawMessage) (map[string]any, error) {
+	var texts []string
+	var queries [][]float64
+	var n int
+	if err := decodeField(body, "query_texts", &texts); err != nil {
+		return nil, err
+	}
+	if err := decodeField(body, "query_embeddings", &queries); err != nil {
+		return nil, err
+	}
+	decodeField(body, "n_results", &n)
+	if n <= 0 {
+		n = 10
+	}
+	if queries == nil {
+		var err error
+		if queries, err = f.embedder.Embed(texts); err != nil {
+			return nil, err
+		}
+	}
+	recs, err := selectRecords(c, body)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := map[string]any{}
+	var allIDs [][]string
+	var allDocs [][]string
+	var allMetas [][]map[string]any
+	var allDists [][]float64
+	for _, q := range queries {
+		if c.Dimension != nil && len(q) != *c.Dimension {
+			return nil, &fakeChromaError{http.StatusBadRequest,
+				fmt.Sprintf("Collection expecting embedding with dimension of %d, got %d", *c.Dimension, len(q))}
+		}
+		type hit struct {
+			rec  *fakeRecord
+			dist float64
+		}
+		var hits []hit
+		for _, rec := range recs {
+			hits = append(hits, hit{rec, 1 - cosineSimilarity(q, rec.embedding)})
+		}
+		sort.SliceStable(hits, func(i, j int) bool { return hits[i].dist < hits[j].dist })
+		if len(hits) > n {
+			hits = hits[:n]
+		}
+		ids, docs, metas, dists := []string{}, []string{}, []map[string]any{}, []float64{}
+		for _, h := range hits {
+			ids = append(ids, h.rec.id)
+			docs = append(docs, h.rec.document)
+			metas = append(metas, h.rec.metadata)
+			dists = append(dists, h.dist)
+		}
+		allIDs = append(allIDs, ids)
+		allDocs = append(allDocs, docs)
+		allMetas = append(allMetas, metas)
+		allDists = append(allDists, dists)
+	}
+	resp["ids"] = allIDs
+	if fakeIncludes(body, "documents") {
+		resp["documents"] = allDocs
+	}
+	if fakeIncludes(body, "metadatas") {
+		resp["metadatas"] = allMetas
+	}
+	if fakeIncludes(body, "distances") {
+		resp["distances"] = allDists
+	}
+	return resp, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ── Revision history ──────────────────────────────────────────────────────────
+
+// learningHistory returns every version of a learning, oldest first, ending
+// with the current one.
+func learningHistory(b Backend, namespace, id string) ([]*Revision, error) {
+	h, err := historianOf(b)
+	if err != nil {
+		return nil, err
+	}
+	current, err := b.Get(namespace, id)
+	if err != nil {
+		return nil, fmt.Errorf("learning ID:%s not found", id)
+	}
+	revisions, err := h.Revisions(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	return append(revisions, &Revision{
+		Number: len(revisions) + 1, Content: current.Content, Tags: current.Tags,
+		Confidence: current.Confidence, UpdatedAt: current.UpdatedAt, Current: true,
+	}), nil
+}
+
+func findRevision(history []*Revision, n int) (*Revision, error) {
+	for _, r := range history {
+		if r.Number == n {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("no revision %d (there are %d)", n, len(history))
+}
+
+// revertLearning makes an earlier revision current again, on behalf of
+// source. It goes through Update, so the version it replaces becomes a
+// revision in turn and the revert can itself be undone.
+func revertLearning(b Backend, namespace, id string, n int, source Source) (*Revision, error) {
+	history, err := learningHistory(b, namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	r, err := findRevision(history, n)
+	if err != nil {
+		return nil, err
+	}
+	if r.Current {
+		return nil, fmt.Errorf("revision %d is the current version", n)
+	}
+	if err := b.Update(namespace, id, r.Content, r.Tags, r.Confidence, source); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// formatHistory lists revisions for the model or a terminal.
+func formatHistory(id string, history []*Revision) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Learning ID:%s has %d revisions:\n\n", id, len(history)))
+	for _, r := range history {
+		sb.WriteString(fmt.Sprintf("[revision %d | %s | confidence:%s", r.Number,
+			r.UpdatedAt.Format("2006-01-02 15:04"), strconv.FormatFloat(r.Confidence, 'f', -1, 64)))
+		if r.Tags != "" {
+			sb.WriteString(" | tags:" + r.Tags)
+		}
+		if r.Current {
+			sb.WriteString(" | current")
+		}
+		sb.WriteString("]\n" + r.Content + "\n\n")
+	}
+	return sb.String()
+}
+
+// diffRevisions shows how revision b differs from revision a, as a unified
+// diff without hunk headers: tags and confidence first if they changed,
+// then the content line by line.
+func diffRevisions(a, b *Revision) string {
+	var sb strings.Builder
+	label := func(r *Revision) string {
+		s := fmt.Sprintf("revision %d (%s", r.Number, r.UpdatedAt.Format("2006-01-02 15:04"))
+		if r.Current {
+			s += ", current"
+		}
+		return s + ")"
+	}
+	sb.WriteString("--- " + label(a) + "\n+++ " + label(b) + "\n")
+	if a.Tags != b.Tags {
+		sb.WriteString("-tags: " + a.Tags + "\n+tags: " + b.Tags + "\n")
+	}
+	if a.Confidence != b.Confidence {
+		sb.WriteString(fmt.Sprintf("-confidence: %s\n+confidence: %s\n",
+			strconv.FormatFloat(a.Confidence, 'f', -1, 64), strconv.FormatFloat(b.Confidence, 'f', -1, 64)))
+	}
+	for _, line := range diffLines(strings.Split(a.Content, "\n"), strings.Split(b.Content, "\n")) {
+		sb.WriteString(line + "\n")
+	}
+	return sb.String()
+}
+
+// diffLines returns b's lines prefixed with " " where they are kept from a
+// or "+" where they are new, with a's removed lines prefixed "-" before
+// them. It keeps the longest common subsequence, which is plenty fast for
+// learnings.
+func diffLines(a, b []string) []string {
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []string
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			out = append(out, " "+a[i])
+			i++
+			j++
+		case i < len(a) && (j == len(b) || lcs[i+1][j] >= lcs[i][j+1]):
+			out = append(out, "-"+a[i])
+			i++
+		default:
+			out = append(out, "+"+b[j])
+			j++
+		}
+	}
+	return out
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ── Search modes ──────────────────────────────────────────────────────────────
+
+const (
+	searchKeyword = "keyword" // full-text only
+	searchVector  = "vector"  // embedding similarity, keyword fallback
+	searchHybrid  = "hybrid"  // both, fused with reciprocal rank fusion
+
+	defaultRRFK = 60 // the constant from the original RRF paper
+)
+
+// Match explains why Search returned a learning.
+type Match struct {
+	Score       float64 `json:"score"`                  // reciprocal rank fusion score; higher is better
+	KeywordRank int     `json:"keyword_rank,omitempty"` // 1-based position in the keyword ranking
+	VectorRank  int     `json:"vector_rank,omitempty"`  // 1-based position in the similarity ranking
+	Similarity  float64 `json:"similarity,omitempty"`   // cosine similarity to the query, where known
+}
+
+func (m *Match) String() string {
+	var why []string
+	if m.KeywordRank > 0 {
+		why = append(why, fmt.Sprintf("keyword #%d", m.KeywordRank))
+	}
+	if m.VectorRank > 0 {
+		v := fmt.Sprintf("vector #%d", m.VectorRank)
+		if m.Similarity != 0 {
+			v += fmt.Sprintf(" (similarity %.2f)", m.Similarity)
+		}
+		why = append(why, v)
+	}
+	return fmt.Sprintf("%s, score %.4f", strings.Join(why, " + "), m.Score)
+}
+
+// resolveSearchMode validates a backend's search_mode. Unset means vector
+// search when an embedder is configured, keywords otherwise.
+func resolveSearchMode(mode string, embeddings bool) (string, error) {
+	switch mode {
+	case "":
+		if embeddings {
+			return searchVector, nil
+		}
+		return searchKeyword, nil
+	case searchKeyword:
+		return mode, nil
+	case searchVector, searchHybrid:
+		if !embeddings {
+			return "", fmt.Errorf("search_mode %q needs an [embedding] provider", mode)
+		}
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown search_mode %q (must be keyword, vector or hybrid)", mode)
+	}
+}
+
+// rankedSearch runs a backend's keyword and vector rankers according to the
+// search mode and annotates every result with its Match. Each ranker returns
+// at most n learnings, best first.
+func rankedSearch(mode string, k, limit int, keyword, vector func(n int) ([]*Learning, error)) ([]*Learning, error) {
+	if k <= 0 {
+		k = defaultRRFK
+	}
+	switch mode {
+	case searchVector:
+		learnings, err := vector(limit)
+		if err != nil {
+			log.Printf("vector search failed, falling back to keywords: %v", err)
+		} else if len(learnings) > 0 {
+			return fuseRRF(nil, learnings, k, limit), nil
+		}
+	case searchHybrid:
+		// Rank deeper than asked so fusion can promote results that only
+		// one ranker placed highly
+		n := limit * 3
+		kw, err := keyword(n)
+		if err != nil {
+			return nil, err
+		}
+		vec, err := vector(n)
+		if err != nil {
+			log.Printf("vector search failed, using keywords only: %v", err)
+		}
+		return fuseRRF(kw, vec, k, limit), nil
+	}
+	learnings, err := keyword(limit)
+	if err != nil {
+		return nil, err
+	}
+	return fuseRRF(learnings, nil, k, limit), nil
+}
+
+// fuseRRF merges rankings by reciprocal rank fusion: each ranking adds
+// 1/(k+rank) for every learning it contains. Vector results may carry their
+// similarity in Match already.
+func fuseRRF(keyword, vector []*Learning, k, limit int) []*Learning {
+	byID := map[string]*Learning{}
+	var fused []*Learning
+	match := func(l *Learning) *Match {
+		if seen, ok := byID[l.ID]; ok {
+			return seen.Match
+		}
+		l.Match = &Match{}
+		byID[l.ID] = l
+		fused = append(fused, l)
+		return l.Match
+	}
+	for i, l := range keyword {
+		m := match(l)
+		m.KeywordRank = i + 1
+		m.Score += 1 / float64(k+i+1)
+	}
+	for i, l := range vector {
+		var similarity float64
+		if l.Match != nil {
+			similarity = l.Match.Similarity
+		}
+		m := match(l)
+		m.VectorRank = i + 1
+		m.Similarity = similarity
+		m.Score += 1 / float64(k+i+1)
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Match.Score > fused[j].Match.Score
+	})
+	if limit > 0 && len(fused) > limit {
+		fused = fused[:limit]
+	}
+	return fused
+}
@@ -1,16 +1,44 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
 )
 
+// subcommands run instead of the server when named as the first argument.
+var subcommands = map[string]struct {
+	summary string
+	run     func(args []string) error
+}{
+	"reembed": {"Re-embed stored learnings with the configured embedder", runReembed},
+	"migrate": {"Copy every learning from one backend to another", runMigrate},
+	"export":  {"Write learnings as JSONL or Markdown", runExport},
+	"import":  {"Read learnings from JSONL or Markdown", runImport},
+	"history": {"List, diff or revert the revisions of a learning", runHistory},
+}
+
 func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			if err := cmd.run(os.Args[2:]); err != nil {
+				log.Fatalf("%s: %v", os.Args[1], err)
+			}
+			return
+		}
+	}
+
 	configPath := flag.String("config", "", "Path to TOML config file (default: look for config.toml in current dir)")
 	printConfig := flag.Bool("print-config", false, "Print an example config file and exit")
+	transport := flag.String("transport", "http", `Transport: "http" (streamable HTTP) or "stdio" (newline-delimited JSON-RPC on stdin/stdout)`)
+	flag.Usage = usage
 	flag.Parse()
 
 	if *printConfig {
@@ -18,43 +46,32 @@ func main() {
 		os.Exit(0)
 	}
 
-	// Resolve config path: flag > env > default locations
-	path := *configPath
-	if path == "" {
-		path = os.Getenv("CONFIG_FILE")
-	}
-	if path == "" {
-		// Check default locations
-		for _, candidate := range []string{"config.toml", "/config/config.toml", "/etc/self-improvement-mcp/config.toml"} {
-			if _, err := os.Stat(candidate); err == nil {
-				path = candidate
-				break
-			}
-		}
-	}
-
-	cfg, err := LoadConfig(path)
-	if err != nil {
-		log.Fatalf("config error: %v", err)
+	switch *transport {
+	case "http":
+	case "stdio":
+		// stdout carries the protocol stream — keep every log line off it
+		log.SetOutput(os.Stderr)
+	default:
+		log.Fatalf("unknown transport: %q (must be 'http' or 'stdio')", *transport)
 	}
 
-	if path != "" {
-		log.Printf("loaded config: %s", path)
-	} else {
-		log.Printf("using default config (no config file found)")
-	}
-	log.Printf("backend: %s", cfg.Backend.Type)
+	cfg, backend := mustOpenBackend(*configPath)
+	defer backend.Close()
 
-	backend, err := NewBackend(cfg)
+	srv, err := NewServer(backend, cfg)
 	if err != nil {
-		log.Fatalf("backend init failed: %v", err)
+		log.Fatalf("server init failed: %v", err)
 	}
-	if backend == nil {
-		log.Fatalf("unknown backend type: %q (must be 'sqlite' or 'chroma')", cfg.Backend.Type)
+	go runTrashJanitor(backend, cfg.Trash)
+
+	if *transport == "stdio" {
+		log.Printf("self-improvement-mcp serving MCP over stdio (backend: %s)", cfg.Backend.Type)
+		if err := srv.ServeStdio(os.Stdin, os.Stdout); err != nil {
+			log.Fatalf("stdio error: %v", err)
+		}
+		return
 	}
-	defer backend.Close()
 
-	srv := NewServer(backend)
 	mux := http.NewServeMux()
 	srv.Routes(mux)
 
@@ -64,7 +81,89 @@ func main() {
 	fmt.Printf("Health check:  http://localhost%s/health\n", addr)
 	fmt.Printf("Backend:       %s\n", cfg.Backend.Type)
 
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	// Shut down on SIGINT/SIGTERM so the deferred backend.Close runs, e.g.
+	// to write the memory backend's snapshot
+	httpSrv := &http.Server{Addr: addr, Handler: mux}
+	stopped := make(chan struct{})
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+		<-sig
+		log.Printf("shutting down")
+		// Event streams never finish on their own; give requests a moment
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpSrv.Shutdown(ctx)
+		close(stopped)
+	}()
+	if err := httpSrv.ListenAndServe(); err != http.ErrServerClosed {
 		log.Fatalf("server error: %v", err)
 	}
+	<-stopped
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %[1]s [flags]\n       %[1]s <command> [flags]\n\nCommands:\n", os.Args[0])
+	names := make([]string, 0, len(subcommands))
+	for name := range subcommands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %-12s %s\n", name, subcommands[name].summary)
+	}
+	fmt.Fprintf(out, "\nFlags:\n")
+	flag.PrintDefaults()
+}
+
+// configFilePath resolves the config file: flag > env > default locations.
+// It returns "" if there is none, meaning defaults.
+func configFilePath(flagPath string) string {
+	if flagPath != "" {
+		return flagPath
+	}
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		return path
+	}
+	for _, candidate := range []string{"config.toml", "/config/config.toml", "/etc/self-improvement-mcp/config.toml"} {
+		if _, err := os.Stat(candidate); err == nil {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// mustOpenBackend loads the config and opens its backend, exiting on failure.
+func mustOpenBackend(flagPath string) (*Config, Backend) {
+	path := configFilePath(flagPath)
+	if path != "" {
+		log.Printf("loaded config: %s", path)
+	} else {
+		log.Printf("using default config (no config file found)")
+	}
+	cfg, backend, err := openConfiguredBackend(path)
+	if err != nil {
+		log.Fatalf("%v", err)
+	}
+	return cfg, backend
+}
+
+// openConfiguredBackend loads a config file ("" for defaults) and opens the
+// backend it describes.
+func openConfiguredBackend(path string) (*Config, Backend, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("config error: %w", err)
+	}
+	log.Printf("backend: %s", cfg.Backend.Type)
+
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("backend init failed: %w", err)
+	}
+	if backend == nil {
+		return nil, nil, fmt.Errorf("unknown backend type: %q (must be 'sqlite', 'chroma', 'postgres' or 'memory')", cfg.Backend.Type)
+	}
+	return cfg, backend, nil
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"unicode"
+)
+
+// ── Namespaces ────────────────────────────────────────────────────────────────
+//
+// Every session works in a home namespace, fixed when it is opened. With
+// per_caller isolation each authenticated caller gets its own; otherwise
+// clients may pick one with the configured header. Shared namespaces can be
+// used by anyone through the namespace tool argument.
+
+const maxNamespaceLen = 128
+
+func validNamespace(ns string) bool {
+	if ns == "" || len(ns) > maxNamespaceLen {
+		return false
+	}
+	for _, r := range ns {
+		if unicode.IsSpace(r) || !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// isolated reports whether the caller is confined to its own namespace and
+// the shared ones.
+func (s *Server) isolated(p *Principal) bool {
+	return s.namespaces.PerCaller && p != nil
+}
+
+// bindNamespace picks the home namespace of a new session from the caller's
+// identity, the namespace header or the configured default.
+func (s *Server) bindNamespace(sess *Session, r *http.Request, p *Principal) error {
+	requested := ""
+	if s.namespaces.Header != "" && r != nil {
+		requested = r.Header.Get(s.namespaces.Header)
+	}
+
+	home := s.namespaces.Default
+	if s.isolated(p) {
+		home = p.Namespace
+	}
+	if requested != "" && requested != home {
+		if !validNamespace(requested) {
+			return fmt.Errorf("invalid namespace %q", requested)
+		}
+		if s.isolated(p) && !s.sharedNamespace(requested) {
+			return fmt.Errorf("namespace %q is not accessible", requested)
+		}
+		home = requested
+	}
+
+	sess.Namespace = home
+	sess.shared = map[string]bool{}
+	for _, ns := range s.namespaces.Shared {
+		sess.shared[ns] = true
+	}
+	return nil
+}
+
+func (s *Server) sharedNamespace(ns string) bool {
+	for _, shared := range s.namespaces.Shared {
+		if shared == ns {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveNamespace returns the namespace a tool call works in: the session's
+// own unless the caller named another one it may use.
+func (s *Server) resolveNamespace(sess *Session, requested string) (string, error) {
+	switch {
+	case requested == "" || requested == sess.Namespace:
+		return sess.Namespace, nil
+	case !validNamespace(requested):
+		return "", fmt.Errorf("invalid namespace %q", requested)
+	case sess.canUse(requested) || !s.isolated(sess.principal()):
+		return requested, nil
+	default:
+		return "", fmt.Errorf("namespace %q is not accessible", requested)
+	}
+}
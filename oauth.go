@@ -0,0 +1,487 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ── Protected resource metadata (RFC 9728) ───────────────────────────────────
+
+// protectedResourceMetadataPath returns where the metadata for the configured
+// resource URI is served: the well-known prefix followed by the resource path.
+func protectedResourceMetadataPath(resource string) string {
+	const wellKnown = "/.well-known/oauth-protected-resource"
+	u, err := url.Parse(resource)
+	if err != nil || u.Path == "" || u.Path == "/" {
+		return wellKnown
+	}
+	return wellKnown + strings.TrimSuffix(u.Path, "/")
+}
+
+// protectedResourceMetadataURL is the absolute metadata URL advertised in
+// WWW-Authenticate challenges.
+func protectedResourceMetadataURL(resource string) string {
+	u, err := url.Parse(resource)
+	if err != nil {
+		return ""
+	}
+	return u.Scheme + "://" + u.Host + protectedResourceMetadataPath(resource)
+}
+
+func (s *Server) handleProtectedResourceMetadata(w http.ResponseWriter, r *http.Request) {
+	cfg := s.oauth
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"resource":                 cfg.Resource,
+		"authorization_servers":    cfg.AuthorizationServers,
+		"scopes_supported":         []string{cfg.ReadScope, cfg.WriteScope},
+		"bearer_methods_supported": []string{"header"},
+		"resource_name":            "self-improvement-mcp",
+	})
+}
+
+// ── JWT access tokens ─────────────────────────────────────────────────────────
+
+// jwtAuth validates JWT access tokens issued by the configured authorization
+// server: signature against its JWKS, then issuer, audience and lifetime.
+type jwtAuth struct {
+	cfg  OAuthConfig
+	jwks *jwksCache
+}
+
+func newJWTAuth(cfg OAuthConfig) (*jwtAuth, error) {
+	if cfg.Issuer == "" {
+		return nil, fmt.Errorf("oauth: issuer is required")
+	}
+	if cfg.Resource == "" {
+		return nil, fmt.Errorf("oauth: resource is required")
+	}
+	if cfg.JWKSFile == "" && cfg.JWKSURL == "" {
+		return nil, fmt.Errorf("oauth: one of jwks_file or jwks_url is required")
+	}
+	a := &jwtAuth{cfg: cfg, jwks: newJWKSCache(cfg)}
+	if err := a.jwks.refresh(); err != nil {
+		return nil, fmt.Errorf("oauth: loading JWKS: %w", err)
+	}
+	return a, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// oauthNamespacePrefix starts the subject and namespace of every OAuth
+// caller; static tokens may not use namespaces that start with it.
+const oauthNamespacePrefix = "oauth:"
+
+type jwtClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"` // string or array
+	ExpiresAt *float64        `json:"exp"`
+	NotBefore *float64        `json:"nbf"`
+	Scope     string          `json:"scope"` // RFC 8693 / 9068: space-separated
+	Scp       []string        `json:"scp"`   // some issuers use an array instead
+	ClientID  string          `json:"client_id"`
+}
+
+func (a *jwtAuth) Authenticate(r *http.Request) (*Principal, error) {
+	token := bearerToken(r)
+	if token == "" {
+		return nil, errNoToken
+	}
+	claims, err := a.verify(token)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errInvalidToken, err)
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	scopes = append(scopes, claims.Scp...)
+	subject := claims.Subject
+	if subject == "" {
+		subject = claims.ClientID
+	}
+	if subject == "" {
+		return nil, fmt.Errorf("%w: no sub or client_id claim", errInvalidToken)
+	}
+	// The namespace carries the prefix too, so an IdP subject can never
+	// name a static token's namespace
+	ns := oauthNamespacePrefix + subject
+	if !validNamespace(ns) {
+		return nil, fmt.Errorf("%w: subject %q can't be used as a namespace", errInvalidToken, subject)
+	}
+	return &Principal{Subject: ns, Namespace: ns, Scopes: scopes, Scoped: true}, nil
+}
+
+func (a *jwtAuth) verify(token string) (*jwtClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed JWT")
+	}
+	var hdr jwtHeader
+	if err := decodeJWTPart(parts[0], &hdr); err != nil {
+		return nil, fmt.Errorf("header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("signature: %w", err)
+	}
+	key, err := a.jwks.key(hdr.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if key.alg != "" && key.alg != hdr.Alg {
+		return nil, fmt.Errorf("alg %q doesn't match key %q, which is for %s", hdr.Alg, hdr.Kid, key.alg)
+	}
+	if err := verifyJWTSignature(hdr.Alg, key.pub, []byte(parts[0]+"."+parts[1]), sig); err != nil {
+		return nil, err
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("claims: %w", err)
+	}
+	if claims.Issuer != a.cfg.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.Issuer)
+	}
+	audience := a.cfg.Audience
+	if audience == "" {
+		audience = a.cfg.Resource
+	}
+	if !audienceContains(claims.Audience, audience) {
+		return nil, fmt.Errorf("token not issued for audience %q", audience)
+	}
+	now := time.Now()
+	skew := a.cfg.ClockSkew.Duration
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("token has no exp claim")
+	}
+	if now.After(unixTime(*claims.ExpiresAt).Add(skew)) {
+		return nil, errors.New("token expired")
+	}
+	if claims.NotBefore != nil && now.Add(skew).Before(unixTime(*claims.NotBefore)) {
+		return nil, errors.New("token not yet valid")
+	}
+	return &claims, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func unixTime(f float64) time.Time {
+	return time.Unix(int64(f), 0)
+}
+
+func audienceContains(raw json.RawMessage, want string) bool {
+	var single string
+	if json.Unmarshal(raw, &single) == nil {
+		return single == want
+	}
+	var many []string
+	if json.Unmarshal(raw, &many) == nil {
+		for _, a := range many {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jwtCurves is the curve each ECDSA algorithm must be used with (RFC 7518
+// §3.4).
+var jwtCurves = map[string]string{"ES256": "P-256", "ES384": "P-384", "ES512": "P-521"}
+
+// minRSABits is the smallest RSA key accepted (RFC 7518 §3.3).
+const minRSABits = 2048
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed, sig []byte) error {
+	var h hash.Hash
+	var hashID crypto.Hash
+	switch alg {
+	case "RS256", "PS256", "ES256":
+		h, hashID = sha256.New(), crypto.SHA256
+	case "RS384", "PS384", "ES384":
+		h, hashID = sha512.New384(), crypto.SHA384
+	case "RS512", "PS512", "ES512":
+		h, hashID = sha512.New(), crypto.SHA512
+	case "EdDSA":
+		k, ok := key.(ed25519.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match alg %s", alg)
+		}
+		if !ed25519.Verify(k, signed, sig) {
+			return errors.New("bad signature")
+		}
+		return nil
+	default:
+		// Notably rejects "none" and HMAC algorithms
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		var err error
+		if strings.HasPrefix(alg, "PS") {
+			err = rsa.VerifyPSS(k, hashID, digest, sig, nil)
+		} else if strings.HasPrefix(alg, "RS") {
+			err = rsa.VerifyPKCS1v15(k, hashID, digest, sig)
+		} else {
+			return fmt.Errorf("key type does not match alg %s", alg)
+		}
+		if k.N.BitLen() < minRSABits {
+			return fmt.Errorf("RSA key has %d bits, fewer than %d", k.N.BitLen(), minRSABits)
+		}
+		if err != nil {
+			return errors.New("bad signature")
+		}
+	case *ecdsa.PublicKey:
+		if crv := jwtCurves[alg]; crv != k.Curve.Params().Name {
+			return fmt.Errorf("key curve %s does not match alg %s", k.Curve.Params().Name, alg)
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(sig) != 2*size {
+			return errors.New("bad signature length")
+		}
+		rInt := new(big.Int).SetBytes(sig[:size])
+		sInt := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, rInt, sInt) {
+			return errors.New("bad signature")
+		}
+	default:
+		return fmt.Errorf("key type does not match alg %s", alg)
+	}
+	return nil
+}
+
+// ── JWKS ──────────────────────────────────────────────────────────────────────
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// jwksCache holds the issuer's signing keys, reloading them periodically and
+// whenever a token names a key ID we haven't seen (key rotation).
+type jwksCache struct {
+	cfg        OAuthConfig
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]signingKey
+	fetchedAt   time.Time
+	lastAttempt time.Time
+}
+
+// signingKey is a key from the JWKS with the algorithm its JWK names, if
+// any; tokens it verifies must use that algorithm.
+type signingKey struct {
+	pub crypto.PublicKey
+	alg string
+}
+
+// Minimum gap between reloads triggered by unknown key IDs, so a flood of
+// forged tokens can't hammer the issuer.
+const jwksMinRefetch = 30 * time.Second
+
+func newJWKSCache(cfg OAuthConfig) *jwksCache {
+	return &jwksCache{cfg: cfg, httpClient: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (c *jwksCache) key(kid string) (signingKey, error) {
+	c.mu.Lock()
+	stale := c.cfg.JWKSRefresh.Duration > 0 && time.Since(c.fetchedAt) > c.cfg.JWKSRefresh.Duration
+	k, ok := c.lookup(kid)
+	canRetry := time.Since(c.lastAttempt) > jwksMinRefetch
+	c.mu.Unlock()
+
+	if (stale || !ok) && canRetry {
+		if err := c.refresh(); err != nil {
+			log.Printf("oauth: JWKS refresh failed: %v", err)
+		}
+		c.mu.Lock()
+		k, ok = c.lookup(kid)
+		c.mu.Unlock()
+	}
+	if !ok {
+		return signingKey{}, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return k, nil
+}
+
+// lookup must be called with c.mu held. A token without a kid is accepted
+// only when the set holds exactly one key.
+func (c *jwksCache) lookup(kid string) (signingKey, bool) {
+	if kid == "" && len(c.keys) == 1 {
+		for _, k := range c.keys {
+			return k, true
+		}
+	}
+	k, ok := c.keys[kid]
+	return k, ok
+}
+
+func (c *jwksCache) refresh() error {
+	c.mu.Lock()
+	c.lastAttempt = time.Now()
+	c.mu.Unlock()
+
+	var data []byte
+	var err error
+	if c.cfg.JWKSFile != "" {
+		data, err = os.ReadFile(c.cfg.JWKSFile)
+	} else {
+		data, err = c.fetch(c.cfg.JWKSURL)
+	}
+	if err != nil {
+		return err
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return fmt.Errorf("parse JWKS: %w", err)
+	}
+	keys := map[string]signingKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			log.Printf("oauth: skipping JWKS key %q: %v", k.Kid, err)
+			continue
+		}
+		keys[k.Kid] = signingKey{pub: pub, alg: k.Alg}
+	}
+	if len(keys) == 0 {
+		return errors.New("JWKS contains no usable signing keys")
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+	return nil
+}
+
+func (c *jwksCache) fetch(u string) ([]byte, error) {
+	resp, err := c.httpClient.Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("GET %s → %d", u, resp.StatusCode)
+	}
+	return data, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	b64 := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := b64(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := b64(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := b64(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x) > size || len(y) > size {
+			return nil, errors.New("bad EC coordinate size")
+		}
+		// Uncompressed SEC 1 point; parsing also checks it is on the curve
+		point := make([]byte, 1+2*size)
+		point[0] = 4
+		copy(point[1+size-len(x):1+size], x)
+		copy(point[1+2*size-len(y):], y)
+		return ecdsa.ParseUncompressedPublicKey(curve, point)
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := b64(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("bad Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// ── Scopes ────────────────────────────────────────────────────────────────────
+
+// requiredScope maps a tool onto the OAuth scope needed to call it:
+// read-only tools need the read scope, everything else the write scope.
+func (s *Server) requiredScope(t Tool) string {
+	if t.Annotations != nil && t.Annotations.ReadOnlyHint {
+		return s.oauth.ReadScope
+	}
+	return s.oauth.WriteScope
+}
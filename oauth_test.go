@@ -0,0 +1,509 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.example"
+	testResource = "https://mcp.example/mcp"
+)
+
+// testKey is a signing key of the stand-in authorization server.
+type testKey struct {
+	kid  string
+	alg  string
+	priv crypto.Signer
+	jwk  map[string]string
+}
+
+var (
+	testKeysOnce sync.Once
+	testKeys     map[string]*testKey // by kid
+)
+
+// signingKeys returns one key per supported family, generated once: RS256,
+// ES256 and EdDSA, plus keys the server must refuse to use.
+func signingKeys(t *testing.T) map[string]*testKey {
+	t.Helper()
+	testKeysOnce.Do(func() {
+		b64 := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+		rsaKey := func(kid string, bits int) *testKey {
+			k, err := rsa.GenerateKey(rand.Reader, bits)
+			if err != nil {
+				panic(err)
+			}
+			return &testKey{kid: kid, alg: "RS256", priv: k, jwk: map[string]string{
+				"kty": "RSA", "kid": kid, "n": b64(k.N.Bytes()), "e": b64(big.NewInt(int64(k.E)).Bytes()),
+			}}
+		}
+		ecKey := func(kid, alg, crv string, curve elliptic.Curve) *testKey {
+			k, err := ecdsa.GenerateKey(curve, rand.Reader)
+			if err != nil {
+				panic(err)
+			}
+			size := (curve.Params().BitSize + 7) / 8
+			return &testKey{kid: kid, alg: alg, priv: k, jwk: map[string]string{
+				"kty": "EC", "kid": kid, "crv": crv, "x": b64(k.X.FillBytes(make([]byte, size))), "y": b64(k.Y.FillBytes(make([]byte, size))),
+			}}
+		}
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			panic(err)
+		}
+		ed := &testKey{kid: "ed", alg: "EdDSA", priv: priv, jwk: map[string]string{
+			"kty": "OKP", "kid": "ed", "crv": "Ed25519", "x": b64(pub),
+		}}
+		pinned := ecKey("pinned", "ES256", "P-256", elliptic.P256())
+		pinned.jwk["alg"] = "ES256"
+		// Signs ES256 with a P-384 key, which RFC 7518 doesn't allow
+		wrongCurve := ecKey("p384", "ES256", "P-384", elliptic.P384())
+		testKeys = map[string]*testKey{}
+		for _, k := range []*testKey{
+			rsaKey("rsa", 2048), ecKey("ec", "ES256", "P-256", elliptic.P256()), ed,
+			rsaKey("rsa1024", 1024), wrongCurve, pinned,
+		} {
+			testKeys[k.kid] = k
+		}
+	})
+	return testKeys
+}
+
+// jwksJSON renders a JWKS holding the keys with these IDs.
+func jwksJSON(t *testing.T, kids ...string) []byte {
+	t.Helper()
+	var set struct {
+		Keys []map[string]string `json:"keys"`
+	}
+	for _, kid := range kids {
+		set.Keys = append(set.Keys, signingKeys(t)[kid].jwk)
+	}
+	data, err := json.Marshal(set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// signJWT signs claims with key under alg, which need not be the key's
+// own algorithm.
+func signJWT(t *testing.T, key *testKey, alg string, claims map[string]any) string {
+	t.Helper()
+	hdr, _ := json.Marshal(map[string]string{"alg": alg, "kid": key.kid, "typ": "at+jwt"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(hdr) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var sig []byte
+	var err error
+	switch k := key.priv.(type) {
+	case *rsa.PrivateKey:
+		if alg == "HS256" {
+			// The classic confusion attack: the public key as an HMAC secret
+			mac := hmac.New(sha256.New, k.PublicKey.N.Bytes())
+			mac.Write([]byte(signed))
+			sig = mac.Sum(nil)
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		}
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		if r, s, err = ecdsa.Sign(rand.Reader, k, digest[:]); err == nil {
+			size := (k.Curve.Params().BitSize + 7) / 8
+			sig = append(r.FillBytes(make([]byte, size)), s.FillBytes(make([]byte, size))...)
+		}
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, []byte(signed))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if alg == "none" {
+		sig = nil
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// validClaims returns claims every check passes, for the caller to spoil.
+func validClaims() map[string]any {
+	return map[string]any{
+		"iss":   testIssuer,
+		"sub":   "alice",
+		"aud":   testResource,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"scope": "learnings:read learnings:write",
+	}
+}
+
+// testOAuthConfig returns an OAuth config reading the JWKS with these key
+// IDs from a file.
+func testOAuthConfig(t *testing.T, kids ...string) OAuthConfig {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwksJSON(t, kids...), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig().OAuth
+	cfg.Issuer = testIssuer
+	cfg.Resource = testResource
+	cfg.JWKSFile = path
+	return cfg
+}
+
+func bearerRequest(token string) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return r
+}
+
+func TestJWTAuthAccepts(t *testing.T) {
+	keys := signingKeys(t)
+	a, err := newJWTAuth(testOAuthConfig(t, "rsa", "ec", "ed", "pinned"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kid := range []string{"rsa", "ec", "ed", "pinned"} {
+		t.Run(keys[kid].alg+"/"+kid, func(t *testing.T) {
+			p, err := a.Authenticate(bearerRequest(signJWT(t, keys[kid], keys[kid].alg, validClaims())))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Subject != "oauth:alice" || p.Namespace != "oauth:alice" || !p.Scoped {
+				t.Fatalf("principal %+v", p)
+			}
+			if !p.hasScope("learnings:read") || !p.hasScope("learnings:write") {
+				t.Fatalf("scopes %v", p.Scopes)
+			}
+		})
+	}
+
+	t.Run("client_id and audience list", func(t *testing.T) {
+		claims := validClaims()
+		delete(claims, "sub")
+		claims["client_id"] = "ci-bot"
+		claims["aud"] = []string{"https://other.example", testResource}
+		claims["scope"] = ""
+		claims["scp"] = []string{"learnings:read"}
+		p, err := a.Authenticate(bearerRequest(signJWT(t, keys["ec"], "ES256", claims)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Subject != "oauth:ci-bot" || !p.hasScope("learnings:read") || p.hasScope("learnings:write") {
+			t.Fatalf("principal %+v", p)
+		}
+	})
+}
+
+func TestJWTAuthRejects(t *testing.T) {
+	keys := signingKeys(t)
+	a, err := newJWTAuth(testOAuthConfig(t, "rsa", "ec", "ed", "rsa1024", "p384", "pinned"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	with := func(change func(c map[string]any)) map[string]any {
+		c := validClaims()
+		change(c)
+		return c
+	}
+	for _, tc := range []struct {
+		name   string
+		key    string
+		alg    string
+		claims map[string]any
+		want   string // in the error
+	}{
+		{"wrong iss", "rsa", "RS256", with(func(c map[string]any) { c["iss"] = "https://evil.example" }), "unexpected issuer"},
+		{"wrong aud", "rsa", "RS256", with(func(c map[string]any) { c["aud"] = "https://other.example/mcp" }), "audience"},
+		{"wrong aud list", "ed", "EdDSA", with(func(c map[string]any) { c["aud"] = []string{"a", "b"} }), "audience"},
+		{"missing exp", "ec", "ES256", with(func(c map[string]any) { delete(c, "exp") }), "no exp"},
+		{"expired", "ec", "ES256", with(func(c map[string]any) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), "expired"},
+		{"not yet valid", "ed", "EdDSA", with(func(c map[string]any) { c["nbf"] = time.Now().Add(time.Hour).Unix() }), "not yet valid"},
+		{"alg none", "rsa", "none", validClaims(), "unsupported alg"},
+		{"HS256", "rsa", "HS256", validClaims(), "unsupported alg"},
+		{"alg of another key type", "ec", "RS256", validClaims(), "does not match alg"},
+		{"no sub or client_id", "rsa", "RS256", with(func(c map[string]any) { delete(c, "sub") }), "no sub"},
+		{"subject not a namespace", "rsa", "RS256", with(func(c map[string]any) { c["sub"] = "alice smith" }), "namespace"},
+		{"short RSA key", "rsa1024", "RS256", validClaims(), "2048"},
+		{"ES256 on P-384", "p384", "ES256", validClaims(), "curve P-384"},
+		{"alg the JWK doesn't name", "pinned", "ES384", validClaims(), "doesn't match key"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := a.Authenticate(bearerRequest(signJWT(t, keys[tc.key], tc.alg, tc.claims)))
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Fatalf("got error %v, want one about %q", err, tc.want)
+			}
+		})
+	}
+
+	t.Run("tampered claims", func(t *testing.T) {
+		token := signJWT(t, keys["rsa"], "RS256", validClaims())
+		parts := strings.Split(token, ".")
+		forged, _ := json.Marshal(with(func(c map[string]any) { c["sub"] = "mallory" }))
+		parts[1] = base64.RawURLEncoding.EncodeToString(forged)
+		if _, err := a.Authenticate(bearerRequest(strings.Join(parts, "."))); err == nil {
+			t.Fatal("token accepted")
+		}
+	})
+}
+
+// TestJWKSRotation serves the JWKS over HTTP: a token naming a key ID not yet
+// seen triggers a reload, but unknown IDs can't make the server refetch more
+// than once per jwksMinRefetch.
+func TestJWKSRotation(t *testing.T) {
+	keys := signingKeys(t)
+	var mu sync.Mutex
+	served := jwksJSON(t, "rsa")
+	fetches := 0
+	jwks := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fetches++
+		w.Write(served)
+	}))
+	defer jwks.Close()
+
+	cfg := testOAuthConfig(t, "rsa")
+	cfg.JWKSFile = ""
+	cfg.JWKSURL = jwks.URL
+	a, err := newJWTAuth(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetchCount := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return fetches
+	}
+	rotated := signJWT(t, keys["ec"], "ES256", validClaims())
+
+	// The issuer rotates in the EC key, but the set was fetched just now
+	mu.Lock()
+	served = jwksJSON(t, "rsa", "ec")
+	mu.Unlock()
+	if _, err := a.Authenticate(bearerRequest(rotated)); err == nil {
+		t.Fatal("token for an unknown key accepted")
+	}
+	if n := fetchCount(); n != 1 {
+		t.Fatalf("%d fetches within the refetch interval, want 1", n)
+	}
+
+	// Once the interval has passed the unknown kid triggers a reload
+	a.jwks.mu.Lock()
+	a.jwks.lastAttempt = time.Now().Add(-2 * jwksMinRefetch)
+	a.jwks.mu.Unlock()
+	if _, err := a.Authenticate(bearerRequest(rotated)); err != nil {
+		t.Fatalf("token for the rotated key: %v", err)
+	}
+	if n := fetchCount(); n != 2 {
+		t.Fatalf("%d fetches after rotation, want 2", n)
+	}
+
+	// A key ID the issuer never published can't force another fetch
+	bogus := *keys["ed"]
+	bogus.kid = "bogus"
+	for range 3 {
+		if _, err := a.Authenticate(bearerRequest(signJWT(t, &bogus, "EdDSA", validClaims()))); err == nil {
+			t.Fatal("token for an unknown key accepted")
+		}
+	}
+	if n := fetchCount(); n != 2 {
+		t.Fatalf("%d fetches after unknown kids, want 2", n)
+	}
+}
+
+func TestAudienceContains(t *testing.T) {
+	for raw, want := range map[string]bool{
+		`"https://mcp.example/mcp"`:          true,
+		`["x", "https://mcp.example/mcp"]`:   true,
+		`"https://mcp.example/mcp/"`:         false,
+		`["x", "y"]`:                         false,
+		`[]`:                                 false,
+		`42`:                                 false,
+		`{"aud": "https://mcp.example/mcp"}`: false,
+		`["https://mcp.example/mcp", 42]`:    false,
+		`null`:                               false,
+	} {
+		if got := audienceContains(json.RawMessage(raw), testResource); got != want {
+			t.Errorf("audienceContains(%s) = %v, want %v", raw, got, want)
+		}
+	}
+}
+
+// newOAuthServer returns a server over a memory backend accepting tokens
+// signed by the RSA test key.
+func newOAuthServer(t *testing.T) *Server {
+	t.Helper()
+	cfg := DefaultConfig()
+	cfg.OAuth = testOAuthConfig(t, "rsa")
+	s, err := NewServer(testMemoryBackend(t), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestScopeFor(t *testing.T) {
+	s := newOAuthServer(t)
+	for _, tc := range []struct {
+		method, params, want string
+	}{
+		{"tools/call", `{"name":"lookup_context"}`, "learnings:read"},
+		{"tools/call", `{"name":"get_stats"}`, "learnings:read"},
+		{"tools/call", `{"name":"store_learning"}`, "learnings:write"},
+		{"tools/call", `{"name":"delete_learning"}`, "learnings:write"},
+		{"tools/call", `{"name":"no_such_tool"}`, ""},
+		{"resources/read", `{}`, "learnings:read"},
+		{"prompts/get", `{}`, "learnings:read"},
+		{"tools/list", `{}`, ""},
+		{"initialize", `{}`, ""},
+	} {
+		req := &Request{Method: tc.method, Params: json.RawMessage(tc.params)}
+		if got := s.scopeFor(req); got != tc.want {
+			t.Errorf("scopeFor(%s %s) = %q, want %q", tc.method, tc.params, got, tc.want)
+		}
+	}
+	for _, tool := range GetTools() {
+		want := "learnings:write"
+		if tool.Annotations != nil && tool.Annotations.ReadOnlyHint {
+			want = "learnings:read"
+		}
+		if got := s.requiredScope(tool); got != want {
+			t.Errorf("requiredScope(%s) = %q, want %q", tool.Name, got, want)
+		}
+	}
+
+	s.oauth.Issuer = ""
+	if got := s.scopeFor(&Request{Method: "tools/call", Params: json.RawMessage(`{"name":"store_learning"}`)}); got != "" {
+		t.Errorf("scopeFor without OAuth = %q", got)
+	}
+}
+
+// TestOAuthScopes drives the HTTP endpoint with a read-only token: tools/list
+// shows only read-only tools, and calling a write tool is refused with a
+// step-up challenge.
+func TestOAuthScopes(t *testing.T) {
+	s := newOAuthServer(t)
+	claims := validClaims()
+	claims["scope"] = "learnings:read"
+	token := signJWT(t, signingKeys(t)["rsa"], "RS256", claims)
+
+	post := func(session, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+token)
+		if session != "" {
+			r.Header.Set("Mcp-Session-Id", session)
+		}
+		w := httptest.NewRecorder()
+		s.handleMCP(w, r)
+		return w
+	}
+
+	w := post("", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	session := w.Header().Get("Mcp-Session-Id")
+	if w.Code != http.StatusOK || session == "" {
+		t.Fatalf("initialize: %d %s", w.Code, w.Body)
+	}
+
+	w = post(session, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+	var list struct {
+		Result struct {
+			Tools []Tool `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Result.Tools) == 0 {
+		t.Fatalf("tools/list with the read scope is empty: %s", w.Body)
+	}
+	for _, tool := range list.Result.Tools {
+		if tool.Annotations == nil || !tool.Annotations.ReadOnlyHint {
+			t.Errorf("tools/list with only the read scope shows %s", tool.Name)
+		}
+	}
+
+	w = post(session, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"store_learning","arguments":{"content":"x"}}}`)
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("write tool with the read scope: %d %s", w.Code, w.Body)
+	}
+	challenge := w.Header().Get("WWW-Authenticate")
+	if !strings.Contains(challenge, `error="insufficient_scope"`) || !strings.Contains(challenge, `scope="learnings:write"`) ||
+		!strings.Contains(challenge, `resource_metadata="https://mcp.example/.well-known/oauth-protected-resource/mcp"`) {
+		t.Fatalf("challenge %q", challenge)
+	}
+
+	w = post(session, `{"jsonrpc":"2.0","id":4,"method":"tools/call","params":{"name":"get_stats","arguments":{}}}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), `"isError":true`) {
+		t.Fatalf("read tool with the read scope: %d %s", w.Code, w.Body)
+	}
+}
+
+// TestOAuthScopeChange refreshes a session's token with the write scope
+// added: the session, and only it, must be told its tool list changed.
+func TestOAuthScopeChange(t *testing.T) {
+	s := newOAuthServer(t)
+	key := signingKeys(t)["rsa"]
+	read, write := validClaims(), validClaims()
+	read["scope"] = "learnings:read"
+	write["scope"] = "learnings:read learnings:write"
+
+	post := func(claims map[string]any, session, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		r.Header.Set("Authorization", "Bearer "+signJWT(t, key, "RS256", claims))
+		if session != "" {
+			r.Header.Set("Mcp-Session-Id", session)
+		}
+		w := httptest.NewRecorder()
+		s.handleMCP(w, r)
+		return w
+	}
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+	w := post(read, "", initialize)
+	session := w.Header().Get("Mcp-Session-Id")
+	if w.Code != http.StatusOK || session == "" {
+		t.Fatalf("initialize: %d %s", w.Code, w.Body)
+	}
+	if !strings.Contains(w.Body.String(), `"tools":{"listChanged":true}`) {
+		t.Fatalf("initialize doesn't advertise tools.listChanged: %s", w.Body)
+	}
+	other := post(read, "", initialize).Header().Get("Mcp-Session-Id")
+
+	events, _, _, cancel := s.events.Subscribe("")
+	defer cancel()
+	list := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
+	post(read, session, list)
+	post(write, session, list)
+	post(write, session, list)
+
+	var got []Event
+	for len(events) > 0 {
+		got = append(got, <-events)
+	}
+	if len(got) != 1 || !strings.Contains(string(got[0].Data), "notifications/tools/list_changed") {
+		t.Fatalf("events %+v, want one tools/list_changed", got)
+	}
+	if sess := s.sessions.Get(session); !sess.wants(got[0]) {
+		t.Error("the session doesn't get its notification")
+	}
+	if sess := s.sessions.Get(other); sess.wants(got[0]) {
+		t.Error("another session gets the notification")
+	}
+}
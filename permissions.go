@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ── Per-key permissions ───────────────────────────────────────────────────────
+
+// allowsTool reports whether the caller's key may call a tool. Requests with
+// auth disabled may call any; callers without a tool list any but the admin
+// tools.
+func (p *Principal) allowsTool(name string) bool {
+	if p == nil {
+		return true
+	}
+	if p.Tools == nil {
+		return !isAdminTool(name)
+	}
+	for _, t := range p.Tools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsCategory reports whether the caller's key may see and write
+// learnings in a category.
+func (p *Principal) allowsCategory(category string) bool {
+	if p == nil || p.Categories == nil {
+		return true
+	}
+	for _, c := range p.Categories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// readOnlyTools lists the tools annotated read-only, for read_only keys.
+func readOnlyTools() []string {
+	var names []string
+	for _, t := range GetTools() {
+		if t.Annotations != nil && t.Annotations.ReadOnlyHint {
+			names = append(names, t.Name)
+		}
+	}
+	return names
+}
+
+// backendFor returns the backend as the session's caller may see it: limited
+// to the key's categories, if it has a category list.
+func (s *Server) backendFor(sess *Session) Backend {
+	p := sess.principal()
+	if p == nil || p.Categories == nil {
+		return s.backend
+	}
+	return &categoryBackend{Backend: s.backend, categories: p.Categories}
+}
+
+// categoryBackend hides every learning outside an allowed set of categories
+// and refuses to store into the others. Learnings it hides are reported as
+// not found, so callers can't probe for them by ID.
+type categoryBackend struct {
+	Backend
+	categories []string
+}
+
+func (b *categoryBackend) allows(category string) bool {
+	return (&Principal{Categories: b.categories}).allowsCategory(category)
+}
+
+func (b *categoryBackend) Add(namespace, category, content, tags string, confidence float64, source Source) (*Learning, error) {
+	if !b.allows(category) {
+		return nil, fmt.Errorf("permission denied: this key may not use category %q", category)
+	}
+	return b.Backend.Add(namespace, category, content, tags, confidence, source)
+}
+
+// Search runs the query once per allowed category and interleaves the
+// results so each category's best matches come first.
+func (b *categoryBackend) Search(namespace, query, category string, limit int) ([]*Learning, error) {
+	if category != "" {
+		if !b.allows(category) {
+			return nil, nil
+		}
+		return b.Backend.Search(namespace, query, category, limit)
+	}
+	var perCategory [][]*Learning
+	for _, c := range b.categories {
+		ls, err := b.Backend.Search(namespace, query, c, limit)
+		if err != nil {
+			return nil, err
+		}
+		perCategory = append(perCategory, ls)
+	}
+	var out []*Learning
+	for rank := 0; ; rank++ {
+		added := false
+		for _, ls := range perCategory {
+			if rank < len(ls) {
+				out = append(out, ls[rank])
+				added = true
+			}
+		}
+		if !added || (limit > 0 && len(out) >= limit) {
+			break
+		}
+	}
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (b *categoryBackend) List(namespace, category, source string, limit int) ([]*Learning, error) {
+	if category != "" {
+		if !b.allows(category) {
+			return nil, nil
+		}
+		return b.Backend.List(namespace, category, source, limit)
+	}
+	var out []*Learning
+	for _, c := range b.categories {
+		ls, err := b.Backend.List(namespace, c, source, limit)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ls...)
+	}
+	sortByUpdated(out)
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+func (b *categoryBackend) Get(namespace, id string) (*Learning, error) {
+	l, err := b.Backend.Get(namespace, id)
+	if err != nil {
+		return nil, err
+	}
+	if !b.allows(l.Category) {
+		return nil, fmt.Errorf("not found: %s", id)
+	}
+	return l, nil
+}
+
+func (b *categoryBackend) Update(namespace, id, content, tags string, confidence float64, source Source) error {
+	if _, err := b.Get(namespace, id); err != nil {
+		return err
+	}
+	return b.Backend.Update(namespace, id, content, tags, confidence, source)
+}
+
+func (b *categoryBackend) Delete(namespace, id string) error {
+	if _, err := b.Get(namespace, id); err != nil {
+		return err
+	}
+	return b.Backend.Delete(namespace, id)
+}
+
+func (b *categoryBackend) Stats(namespace string) (map[string]int, error) {
+	stats, err := b.Backend.Stats(namespace)
+	if err != nil {
+		return nil, err
+	}
+	for category := range stats {
+		if !b.allows(category) {
+			delete(stats, category)
+		}
+	}
+	return stats, nil
+}
+
+func (b *categoryBackend) Namespaces() ([]string, error) {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	return p.Namespaces()
+}
+
+func (b *categoryBackend) Each(namespace string, fn func(*Learning) error) error {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return err
+	}
+	return p.Each(namespace, func(l *Learning) error {
+		if !b.allows(l.Category) {
+			return nil
+		}
+		return fn(l)
+	})
+}
+
+// Put refuses categories the key may not use. A learning whose ID belongs to
+// a hidden learning is stored under a new ID rather than replacing it.
+func (b *categoryBackend) Put(l *Learning) (*Learning, error) {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if !b.allows(l.Category) {
+		return nil, fmt.Errorf("permission denied: this key may not use category %q", l.Category)
+	}
+	if l.ID != "" {
+		if existing, err := b.Backend.Get(l.Namespace, l.ID); err == nil && !b.allows(existing.Category) {
+			l = copyLearning(l)
+			l.ID = ""
+		}
+	}
+	return p.Put(l)
+}
+
+// Revisions looks a learning Get doesn't find up through Each, as Restore
+// does, since export carries the history of learnings in the trash too.
+func (b *categoryBackend) Revisions(namespace, id string) ([]*Revision, error) {
+	h, err := historianOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := b.Get(namespace, id); err != nil {
+		p, perr := porterOf(b.Backend)
+		if perr != nil {
+			return nil, err
+		}
+		if err := b.findAllowed(p, namespace, id); err != nil {
+			return nil, err
+		}
+	}
+	return h.Revisions(namespace, id)
+}
+
+func (b *categoryBackend) Trash(namespace, category string, limit int) ([]*Learning, error) {
+	t, err := trasherOf(b.Backend)
+	if err != nil {
+		return nil, err
+	}
+	if category != "" {
+		if !b.allows(category) {
+			return nil, nil
+		}
+		return t.Trash(namespace, category, limit)
+	}
+	var out []*Learning
+	for _, c := range b.categories {
+		ls, err := t.Trash(namespace, c, limit)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, ls...)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].DeletedAt.After(*out[j].DeletedAt) })
+	if limit > 0 && len(out) > limit {
+		out = out[:limit]
+	}
+	return out, nil
+}
+
+// Restore looks the learning up through Each, since Get doesn't find
+// learnings in the trash.
+func (b *categoryBackend) Restore(namespace, id string) error {
+	t, err := trasherOf(b.Backend)
+	if err != nil {
+		return err
+	}
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return err
+	}
+	if err := b.findAllowed(p, namespace, id); err != nil {
+		return err
+	}
+	return t.Restore(namespace, id)
+}
+
+// PutRevisions, like Restore, finds the learning through Each: import
+// carries the history of learnings in the trash too.
+func (b *categoryBackend) PutRevisions(namespace, id string, revs []*Revision) error {
+	p, err := porterOf(b.Backend)
+	if err != nil {
+		return err
+	}
+	if err := b.findAllowed(p, namespace, id); err != nil {
+		return err
+	}
+	return p.PutRevisions(namespace, id, revs)
+}
+
+// findAllowed fails unless the namespace holds a learning with this ID, in
+// the trash or not, in a category the key may use.
+func (b *categoryBackend) findAllowed(p Porter, namespace, id string) error {
+	allowed := false
+	if err := p.Each(namespace, func(l *Learning) error {
+		if l.ID == id {
+			allowed = b.allows(l.Category)
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+	if !allowed {
+		return fmt.Errorf("not found: %s", id)
+	}
+	return nil
+}
+
+// Purge is the janitor's, which never runs with a key's restrictions.
+func (b *categoryBackend) Purge(namespace string, cutoff time.Time) (int, error) {
+	return 0, fmt.Errorf("permission denied: this key may not purge the trash")
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"text/template"
+)
+
+// ── MCP prompt types ─────────────────────────────────────────────────────────
+
+type Prompt struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Arguments   []PromptArgument `json:"arguments,omitempty"`
+}
+
+type PromptArgument struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+}
+
+type PromptMessage struct {
+	Role    string       `json:"role"`
+	Content ContentBlock `json:"content"`
+}
+
+// promptDef pairs the advertised prompt with the function that renders it.
+type promptDef struct {
+	Prompt
+	render func(s *Server, sess *Session, args map[string]string) (string, error)
+}
+
+// ── Built-in prompts ─────────────────────────────────────────────────────────
+
+func builtinPrompts() []promptDef {
+	return []promptDef{
+		{
+			Prompt: Prompt{
+				Name:        "start_session",
+				Description: "Bootstrap a session with stored learnings relevant to a topic.",
+				Arguments: []PromptArgument{
+					{Name: "topic", Description: "What this session is about (e.g. 'kubernetes debugging', 'writing')", Required: true},
+				},
+			},
+			render: renderStartSession,
+		},
+		{
+			Prompt: Prompt{
+				Name:        "end_session_reflection",
+				Description: "Reflect on the session and persist anything worth remembering.",
+				Arguments: []PromptArgument{
+					{Name: "summary", Description: "Optional: a short summary of what happened this session"},
+				},
+			},
+			render: renderEndSessionReflection,
+		},
+	}
+}
+
+func renderStartSession(s *Server, sess *Session, args map[string]string) (string, error) {
+	topic := args["topic"]
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("We are starting a new session about: %s\n\n", topic))
+	sb.WriteString("Below is what you have previously learned that is relevant. ")
+	sb.WriteString("Use it to calibrate your tone, approach, and content. ")
+	sb.WriteString("Call 'lookup_context' again if the topic shifts.\n\n")
+	sb.WriteString(s.lookupForPrompt(sess, topic))
+	return sb.String(), nil
+}
+
+func renderEndSessionReflection(s *Server, sess *Session, args map[string]string) (string, error) {
+	var sb strings.Builder
+	sb.WriteString("This session is ending. Reflect on it and persist what a future version of yourself should know.\n\n")
+	if summary := strings.TrimSpace(args["summary"]); summary != "" {
+		sb.WriteString(fmt.Sprintf("Session summary: %s\n\n", summary))
+	}
+	sb.WriteString(`Work through these steps:
+1. List what you learned: user preferences, useful personal or technical context, and mistakes you made and how to avoid them.
+2. For each item, call 'lookup_context' with a few keywords to check whether something similar is already stored.
+3. If a matching learning exists but is incomplete or wrong, call 'update_learning' with its ID and the refined content.
+4. Otherwise call 'store_learning' with the most specific category and an actionable, self-contained description.
+5. If a stored learning turned out to be wrong or outdated, call 'delete_learning' on it.
+6. If several stored learnings say much the same thing, call 'merge_learnings' with their IDs and one consolidated content.
+
+Be specific and write as if briefing a future version of yourself. Skip anything trivial or one-off.`)
+	return sb.String(), nil
+}
+
+// lookupForPrompt searches the session's namespace and formats the results
+// for embedding in a prompt.
+func (s *Server) lookupForPrompt(sess *Session, query string) string {
+	backend := s.backendFor(sess)
+	learnings, err := backend.Search(sess.Namespace, query, "", 10)
+	if err != nil {
+		return fmt.Sprintf("(lookup failed: %v)\n", err)
+	}
+	if len(learnings) == 0 {
+		return "No relevant learnings found. This may be a new topic or a fresh start.\n"
+	}
+	for _, l := range learnings {
+		backend.IncrementUseCount(sess.Namespace, l.ID)
+	}
+	return formatFoundLearnings(learnings)
+}
+
+// ── Config-defined prompts ───────────────────────────────────────────────────
+
+// configPrompt turns a [[prompts]] entry into a prompt rendered with text/template.
+// Arguments are available as {{.name}}; {{lookup "query"}} embeds search results.
+func configPrompt(pc PromptConfig) (promptDef, error) {
+	tmpl, err := template.New(pc.Name).Funcs(template.FuncMap{
+		// replaced per-render with a closure bound to the session's namespace
+		"lookup": func(string) string { return "" },
+	}).Option("missingkey=zero").Parse(pc.Template)
+	if err != nil {
+		return promptDef{}, fmt.Errorf("prompt %q: %w", pc.Name, err)
+	}
+
+	p := Prompt{Name: pc.Name, Description: pc.Description}
+	for _, a := range pc.Arguments {
+		p.Arguments = append(p.Arguments, PromptArgument{Name: a.Name, Description: a.Description, Required: a.Required})
+	}
+
+	return promptDef{
+		Prompt: p,
+		render: func(s *Server, sess *Session, args map[string]string) (string, error) {
+			t, err := tmpl.Clone()
+			if err != nil {
+				return "", err
+			}
+			t.Funcs(template.FuncMap{"lookup": func(query string) string {
+				return s.lookupForPrompt(sess, query)
+			}})
+			var sb strings.Builder
+			if err := t.Execute(&sb, args); err != nil {
+				return "", err
+			}
+			return sb.String(), nil
+		},
+	}, nil
+}
+
+// loadPrompts returns the built-in prompts followed by those defined in config.
+func loadPrompts(cfg *Config) ([]promptDef, error) {
+	prompts := builtinPrompts()
+	seen := map[string]bool{}
+	for _, p := range prompts {
+		seen[p.Name] = true
+	}
+	for _, pc := range cfg.Prompts {
+		if pc.Name == "" {
+			return nil, fmt.Errorf("prompt with empty name")
+		}
+		if seen[pc.Name] {
+			return nil, fmt.Errorf("duplicate prompt name: %q", pc.Name)
+		}
+		def, err := configPrompt(pc)
+		if err != nil {
+			return nil, err
+		}
+		seen[pc.Name] = true
+		prompts = append(prompts, def)
+	}
+	return prompts, nil
+}
+
+// ── Handlers ─────────────────────────────────────────────────────────────────
+
+func (s *Server) handlePromptsList() (any, *RPCError) {
+	prompts := make([]Prompt, 0, len(s.prompts))
+	for _, p := range s.prompts {
+		prompts = append(prompts, p.Prompt)
+	}
+	return map[string]any{"prompts": prompts}, nil
+}
+
+func (s *Server) handlePromptsGet(sess *Session, params json.RawMessage) (any, *RPCError) {
+	var p struct {
+		Name      string            `json:"name"`
+		Arguments map[string]string `json:"arguments"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil {
+		return nil, &RPCError{Code: -32602, Message: "invalid params"}
+	}
+
+	var def *promptDef
+	for i := range s.prompts {
+		if s.prompts[i].Name == p.Name {
+			def = &s.prompts[i]
+			break
+		}
+	}
+	if def == nil {
+		return nil, &RPCError{Code: -32602, Message: fmt.Sprintf("unknown prompt: %s", p.Name)}
+	}
+	if p.Arguments == nil {
+		p.Arguments = map[string]string{}
+	}
+	for _, a := range def.Arguments {
+		if a.Required && strings.TrimSpace(p.Arguments[a.Name]) == "" {
+			return nil, &RPCError{Code: -32602, Message: fmt.Sprintf("missing required argument: %s", a.Name)}
+		}
+	}
+
+	log.Printf("  prompt: %s", p.Name)
+	text, err := def.render(s, sess, p.Arguments)
+	if err != nil {
+		return nil, &RPCError{Code: -32603, Message: "prompt render failed: " + err.Error()}
+	}
+	return map[string]any{
+		"description": def.Description,
+		"messages":    []PromptMessage{{Role: "user", Content: ContentBlock{Type: "text", Text: text}}},
+	}, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+// ── MCP protocol revisions ───────────────────────────────────────────────────
+
+const (
+	protocol20241105 = "2024-11-05"
+	protocol20250326 = "2025-03-26"
+	protocol20250618 = "2025-06-18"
+
+	latestProtocolVersion = protocol20250618
+
+	// Streamable HTTP clients that omit the MCP-Protocol-Version header are
+	// assumed to speak this revision, per the 2025-06-18 transport spec.
+	defaultHTTPProtocolVersion = protocol20250326
+)
+
+// supportedProtocolVersions lists every revision we can speak, newest first.
+var supportedProtocolVersions = []string{
+	protocol20250618,
+	protocol20250326,
+	protocol20241105,
+}
+
+func isSupportedProtocolVersion(v string) bool {
+	for _, s := range supportedProtocolVersions {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
+
+// negotiateProtocolVersion echoes the client's requested revision if we
+// support it, otherwise offers our latest and lets the client decide
+// whether to disconnect.
+func negotiateProtocolVersion(requested string) string {
+	if isSupportedProtocolVersion(requested) {
+		return requested
+	}
+	return latestProtocolVersion
+}
+
+// Revision strings are ISO dates, so lexical order is chronological order.
+func protocolAtLeast(version, min string) bool {
+	return version >= min
+}
+
+// ── Per-revision features ────────────────────────────────────────────────────
+
+// supportsToolAnnotations: tool behaviour hints arrived in 2025-03-26.
+func (sess *Session) supportsToolAnnotations() bool {
+	return protocolAtLeast(sess.ProtocolVersion, protocol20250326)
+}
+
+// supportsStructuredOutput: tool titles, outputSchema and structuredContent
+// arrived in 2025-06-18.
+func (sess *Session) supportsStructuredOutput() bool {
+	return protocolAtLeast(sess.ProtocolVersion, protocol20250618)
+}
+
+// supportsBatch: JSON-RPC batching was removed in 2025-06-18.
+func (sess *Session) supportsBatch() bool {
+	return !protocolAtLeast(sess.ProtocolVersion, protocol20250618)
+}
+
+// toolsForSession adapts the tool list to what the negotiated revision understands.
+func toolsForSession(sess *Session) []Tool {
+	tools := GetTools()
+	for i := range tools {
+		if !sess.supportsToolAnnotations() {
+			tools[i].Annotations = nil
+		}
+		if !sess.supportsStructuredOutput() {
+			tools[i].Title = ""
+			tools[i].OutputSchema = nil
+		}
+	}
+	return tools
+}
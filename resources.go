@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ── MCP resource types ───────────────────────────────────────────────────────
+
+type Resource struct {
+	URI         string `json:"uri"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceTemplate struct {
+	URITemplate string `json:"uriTemplate"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	MimeType    string `json:"mimeType,omitempty"`
+}
+
+type ResourceContents struct {
+	URI      string `json:"uri"`
+	MimeType string `json:"mimeType,omitempty"`
+	Text     string `json:"text"`
+}
+
+const (
+	learningURIPrefix = "learning://"
+	categoryURIPrefix = "learning://category/"
+
+	resourcePageSize = 50   // entries per resources/list page
+	resourceMaxItems = 5000 // upper bound on learnings enumerated as resources
+)
+
+func learningURI(id string) string       { return learningURIPrefix + id }
+func categoryURI(category string) string { return categoryURIPrefix + category }
+
+// ── Handlers ─────────────────────────────────────────────────────────────────
+
+// handleResourcesList returns category collections followed by every
+// individual learning, paginated with an opaque cursor.
+func (s *Server) handleResourcesList(sess *Session, params json.RawMessage) (any, *RPCError) {
+	var p struct {
+		Cursor string `json:"cursor"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &RPCError{Code: -32602, Message: "invalid params"}
+		}
+	}
+	offset, err := decodeCursor(p.Cursor)
+	if err != nil {
+		return nil, &RPCError{Code: -32602, Message: "invalid cursor"}
+	}
+
+	var all []Resource
+	for _, cat := range validCategories {
+		if !sess.principal().allowsCategory(cat) {
+			continue
+		}
+		all = append(all, Resource{
+			URI:         categoryURI(cat),
+			Name:        "category: " + cat,
+			Description: fmt.Sprintf("All learnings in the '%s' category", cat),
+			MimeType:    "text/markdown",
+		})
+	}
+
+	learnings, err := s.backendFor(sess).List(sess.Namespace, "", "", resourceMaxItems)
+	if err != nil {
+		return nil, &RPCError{Code: -32603, Message: "list failed: " + err.Error()}
+	}
+	for _, l := range learnings {
+		all = append(all, Resource{
+			URI:         learningURI(l.ID),
+			Name:        summarize(l.Content, 60),
+			Description: fmt.Sprintf("%s learning (confidence %.1f)", l.Category, l.Confidence),
+			MimeType:    "text/markdown",
+		})
+	}
+
+	if offset > len(all) {
+		offset = len(all)
+	}
+	end := offset + resourcePageSize
+	if end > len(all) {
+		end = len(all)
+	}
+
+	result := map[string]any{"resources": all[offset:end]}
+	if end < len(all) {
+		result["nextCursor"] = encodeCursor(end)
+	}
+	return result, nil
+}
+
+func (s *Server) handleResourcesRead(sess *Session, params json.RawMessage) (any, *RPCError) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return nil, &RPCError{Code: -32602, Message: "invalid params: uri is required"}
+	}
+
+	var text string
+	switch {
+	case strings.HasPrefix(p.URI, categoryURIPrefix):
+		category := strings.TrimPrefix(p.URI, categoryURIPrefix)
+		if !isValidCategory(category) || !sess.principal().allowsCategory(category) {
+			return nil, resourceNotFound(p.URI)
+		}
+		learnings, err := s.backendFor(sess).List(sess.Namespace, category, "", resourceMaxItems)
+		if err != nil {
+			return nil, &RPCError{Code: -32603, Message: "list failed: " + err.Error()}
+		}
+		text = formatCategoryMarkdown(category, learnings)
+
+	case strings.HasPrefix(p.URI, learningURIPrefix):
+		id := strings.TrimPrefix(p.URI, learningURIPrefix)
+		l, err := s.backendFor(sess).Get(sess.Namespace, id)
+		if err != nil || l == nil {
+			return nil, resourceNotFound(p.URI)
+		}
+		text = formatLearningMarkdown(l)
+
+	default:
+		return nil, resourceNotFound(p.URI)
+	}
+
+	return map[string]any{
+		"contents": []ResourceContents{{URI: p.URI, MimeType: "text/markdown", Text: text}},
+	}, nil
+}
+
+func (s *Server) handleResourceTemplatesList() (any, *RPCError) {
+	return map[string]any{
+		"resourceTemplates": []ResourceTemplate{
+			{
+				URITemplate: "learning://{id}",
+				Name:        "learning",
+				Description: "A single stored learning by ID",
+				MimeType:    "text/markdown",
+			},
+			{
+				URITemplate: "learning://category/{category}",
+				Name:        "learning category",
+				Description: "All learnings in a category: " + strings.Join(validCategories, ", "),
+				MimeType:    "text/markdown",
+			},
+		},
+	}, nil
+}
+
+// handleResourcesSubscribe registers interest in notifications/resources/updated for a URI.
+func (s *Server) handleResourcesSubscribe(sess *Session, params json.RawMessage, subscribe bool) (any, *RPCError) {
+	var p struct {
+		URI string `json:"uri"`
+	}
+	if err := json.Unmarshal(params, &p); err != nil || p.URI == "" {
+		return nil, &RPCError{Code: -32602, Message: "invalid params: uri is required"}
+	}
+	if !strings.HasPrefix(p.URI, learningURIPrefix) {
+		return nil, resourceNotFound(p.URI)
+	}
+	if subscribe {
+		sess.subscribe(p.URI)
+	} else {
+		sess.unsubscribe(p.URI)
+	}
+	return map[string]any{}, nil
+}
+
+// ── Helpers ───────────────────────────────────────────────────────────────────
+
+func resourceNotFound(uri string) *RPCError {
+	return &RPCError{Code: -32002, Message: "resource not found: " + uri}
+}
+
+func isValidCategory(category string) bool {
+	for _, c := range validCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	n, err := strconv.Atoi(string(raw))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("bad cursor")
+	}
+	return n, nil
+}
+
+// summarize returns the first line of s, truncated to max runes.
+func summarize(s string, max int) string {
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		s = s[:i]
+	}
+	r := []rune(strings.TrimSpace(s))
+	if len(r) > max {
+		return string(r[:max-1]) + "…"
+	}
+	return string(r)
+}
+
+func formatLearningMarkdown(l *Learning) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Learning %s\n\n", l.ID))
+	sb.WriteString(fmt.Sprintf("- category: %s\n", l.Category))
+	sb.WriteString(fmt.Sprintf("- confidence: %.1f\n", l.Confidence))
+	if l.Tags != "" {
+		sb.WriteString(fmt.Sprintf("- tags: %s\n", l.Tags))
+	}
+	sb.WriteString(fmt.Sprintf("- used: %d times\n", l.UseCount))
+	sb.WriteString(fmt.Sprintf("- updated: %s\n\n", l.UpdatedAt.Format("2006-01-02")))
+	sb.WriteString(l.Content + "\n")
+	return sb.String()
+}
+
+func formatCategoryMarkdown(category string, learnings []*Learning) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("# Learnings: %s (%d)\n\n", category, len(learnings)))
+	for _, l := range learnings {
+		sb.WriteString(fmt.Sprintf("## [ID:%s | confidence:%.1f]\n", l.ID, l.Confidence))
+		sb.WriteString(l.Content + "\n")
+		if l.Tags != "" {
+			sb.WriteString(fmt.Sprintf("tags: %s\n", l.Tags))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
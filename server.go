@@ -6,6 +6,8 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"slices"
+	"time"
 )
 
 // ── JSON-RPC types ────────────────────────────────────────────────────────────
@@ -32,57 +34,133 @@ type RPCError struct {
 // ── Server ────────────────────────────────────────────────────────────────────
 
 type Server struct {
-	backend Backend
-	version string
+	backend   Backend
+	version   string
+	prompts   []promptDef
+	sessions  *SessionRegistry
+	events    *EventHub
+	keepalive time.Duration // SSE ping interval
+	auth      Authenticator // nil = /mcp is open
+	authRealm string
+	oauth     OAuthConfig
+
+	namespaces NamespaceConfig
+	tools      toolEnv
 }
 
-func NewServer(backend Backend) *Server {
-	return &Server{backend: backend, version: "1.0.0"}
+func NewServer(backend Backend, cfg *Config) (*Server, error) {
+	prompts, err := loadPrompts(cfg)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := NewAuthenticator(cfg.Auth, cfg.OAuth)
+	if err != nil {
+		return nil, err
+	}
+	if auth == nil {
+		log.Printf("auth disabled: /mcp accepts unauthenticated requests")
+	}
+
+	if !validDedupMode(cfg.Dedup.Mode) {
+		return nil, fmt.Errorf("unknown [dedup] mode %q (must be off, reject, merge or suggest)", cfg.Dedup.Mode)
+	}
+	if cfg.Dedup.Threshold <= 0 || cfg.Dedup.Threshold > 1 {
+		return nil, fmt.Errorf("[dedup] threshold must be above 0 and at most 1")
+	}
+	if cfg.Trash.Retention.Duration < 0 || cfg.Trash.PurgeInterval.Duration < 0 {
+		return nil, fmt.Errorf("[trash] retention and purge_interval can't be negative")
+	}
+
+	events := NewEventHub(cfg.Server.SSEReplayBuffer)
+	return &Server{
+		backend:   &notifyingBackend{Backend: backend, events: events},
+		version:   "1.0.0",
+		prompts:   prompts,
+		sessions:  NewSessionRegistry(cfg.Server.SessionIdleTimeout.Duration),
+		events:    events,
+		keepalive: cfg.Server.SSEKeepalive.Duration,
+		auth:      auth,
+		authRealm: cfg.Auth.Realm,
+		oauth:     cfg.OAuth,
+
+		namespaces: cfg.Namespaces,
+		tools:      toolEnv{dedup: cfg.Dedup, trash: cfg.Trash},
+	}, nil
 }
 
 func (s *Server) Routes(mux *http.ServeMux) {
-	// Streamable HTTP: single endpoint accepts POST for all JSON-RPC messages
-	// and GET for server-sent events (optional, for streaming responses)
+	// Streamable HTTP: single endpoint accepts POST for all JSON-RPC messages,
+	// GET for server-sent events and DELETE to end a session
 	mux.HandleFunc("/mcp", s.handleMCP)
 	mux.HandleFunc("/health", s.handleHealth)
+	if s.oauth.enabled() {
+		path := protectedResourceMetadataPath(s.oauth.Resource)
+		mux.HandleFunc(path, s.handleProtectedResourceMetadata)
+		if root := "/.well-known/oauth-protected-resource"; path != root {
+			mux.HandleFunc(root, s.handleProtectedResourceMetadata)
+		}
+	}
+	go s.sessions.RunJanitor()
 }
 
 func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"status":  "ok",
-		"version": s.version,
+	json.NewEncoder(w).Encode(map[string]any{
+		"status":   "ok",
+		"version":  s.version,
+		"sessions": s.sessions.Len(),
 	})
 }
 
 // handleMCP is the single streamable HTTP endpoint.
-// POST  → receives a JSON-RPC request, returns a JSON-RPC response.
-// GET   → returns an SSE stream (for clients that want server-initiated messages).
+// POST   → receives a JSON-RPC request, returns a JSON-RPC response.
+// GET    → returns an SSE stream (for clients that want server-initiated messages).
+// DELETE → terminates the session named in Mcp-Session-Id.
 func (s *Server) handleMCP(w http.ResponseWriter, r *http.Request) {
 	// CORS — open-webui may be on a different origin
 	w.Header().Set("Access-Control-Allow-Origin", "*")
-	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Mcp-Session-Id")
-	w.Header().Set("Access-Control-Expose-Headers", "Mcp-Session-Id")
+	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Accept, Authorization, Mcp-Session-Id, Mcp-Protocol-Version, Last-Event-ID")
+	w.Header().Set("Access-Control-Expose-Headers", "Mcp-Session-Id, WWW-Authenticate")
 
-	switch r.Method {
-	case http.MethodOptions:
+	// Preflight requests carry no credentials
+	if r.Method == http.MethodOptions {
 		w.WriteHeader(http.StatusOK)
+		return
+	}
 
+	principal, ok := s.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
 	case http.MethodPost:
-		s.handlePost(w, r)
+		s.handlePost(w, r, principal)
 
 	case http.MethodGet:
 		// GET /mcp opens an SSE stream for server-initiated notifications.
 		// open-webui uses this for streaming tool responses.
-		s.handleSSEStream(w, r)
+		sess := s.requireSession(w, r, principal)
+		if sess == nil {
+			return
+		}
+		s.handleSSEStream(w, r, sess)
+
+	case http.MethodDelete:
+		sess := s.requireSession(w, r, principal)
+		if sess == nil {
+			return
+		}
+		s.sessions.Delete(sess.ID)
+		w.WriteHeader(http.StatusNoContent)
 
 	default:
 		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 	}
 }
 
-func (s *Server) handlePost(w http.ResponseWriter, r *http.Request) {
+func (s *Server) handlePost(w http.ResponseWriter, r *http.Request, principal *Principal) {
 	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
 	if err != nil {
 		http.Error(w, "read error", http.StatusBadRequest)
@@ -90,10 +168,20 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request) {
 	}
 	defer r.Body.Close()
 
+	// Clients send the negotiated revision on every request after initialize
+	if v := r.Header.Get("Mcp-Protocol-Version"); v != "" && !isSupportedProtocolVersion(v) {
+		http.Error(w, "unsupported MCP-Protocol-Version: "+v, http.StatusBadRequest)
+		return
+	}
+
 	// Support both single request and batch (array)
 	trimmed := trimSpace(body)
 	if len(trimmed) > 0 && trimmed[0] == '[' {
-		s.handleBatch(w, body)
+		sess := s.requireSession(w, r, principal)
+		if sess == nil {
+			return
+		}
+		s.handleBatch(w, sess, body)
 		return
 	}
 
@@ -103,16 +191,33 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	result, rpcErr := s.dispatch(&req)
-	resp := Response{JSONRPC: "2.0", ID: req.ID}
-	if rpcErr != nil {
-		resp.Error = rpcErr
-	} else {
-		resp.Result = result
+	// initialize mints a new session; everything else must present one
+	var sess *Session
+	if req.Method == "initialize" {
+		sess = newSession(defaultHTTPProtocolVersion)
+		sess.setPrincipal(principal)
+		if err := s.bindNamespace(sess, r, principal); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	} else if sess = s.requireSession(w, r, principal); sess == nil {
+		return
+	}
+
+	if scope := s.scopeFor(&req); !principal.hasScope(scope) {
+		s.insufficientScope(w, scope)
+		return
+	}
+
+	resp := s.handleMessage(sess, &req)
+
+	if req.Method == "initialize" && resp != nil && resp.Error == nil {
+		s.sessions.Add(sess)
+		w.Header().Set("Mcp-Session-Id", sess.ID)
 	}
 
 	// Notifications have no ID and expect no response body
-	if req.ID == nil && rpcErr == nil {
+	if resp == nil {
 		w.WriteHeader(http.StatusAccepted)
 		return
 	}
@@ -121,75 +226,224 @@ func (s *Server) handlePost(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (s *Server) handleBatch(w http.ResponseWriter, body []byte) {
+// requireSession resolves the Mcp-Session-Id header to a live session owned
+// by the caller. On failure it writes the error response and returns nil:
+// 400 when the header is missing, 404 when the session is unknown, expired
+// or belongs to someone else, so the client knows to re-initialize.
+func (s *Server) requireSession(w http.ResponseWriter, r *http.Request, principal *Principal) *Session {
+	id := r.Header.Get("Mcp-Session-Id")
+	if id == "" {
+		http.Error(w, "missing Mcp-Session-Id header (call initialize first)", http.StatusBadRequest)
+		return nil
+	}
+	sess := s.sessions.Get(id)
+	if sess == nil || !sameCaller(sess, principal) {
+		http.Error(w, "session not found or expired", http.StatusNotFound)
+		return nil
+	}
+	s.updatePrincipal(sess, principal)
+	return sess
+}
+
+// updatePrincipal records the caller's latest credentials. A refreshed
+// OAuth token may carry other scopes, and so change which tools the session
+// may call; the session is then told to list them again.
+func (s *Server) updatePrincipal(sess *Session, principal *Principal) {
+	if !s.oauth.enabled() {
+		sess.setPrincipal(principal)
+		return
+	}
+	before := toolNames(s.visibleTools(sess))
+	sess.setPrincipal(principal)
+	if !slices.Equal(before, toolNames(s.visibleTools(sess))) {
+		s.events.PublishTo(sess.ID, "notifications/tools/list_changed", nil)
+	}
+}
+
+func toolNames(tools []Tool) []string {
+	names := make([]string, len(tools))
+	for i, t := range tools {
+		names[i] = t.Name
+	}
+	return names
+}
+
+func (s *Server) handleBatch(w http.ResponseWriter, sess *Session, body []byte) {
+	if !sess.supportsBatch() {
+		writeError(w, nil, -32600, batchUnsupportedMessage(sess))
+		return
+	}
+
 	var reqs []Request
 	if err := json.Unmarshal(body, &reqs); err != nil {
 		writeError(w, nil, -32700, "parse error")
 		return
 	}
 
-	var responses []Response
-	for _, req := range reqs {
-		result, rpcErr := s.dispatch(&req)
-		resp := Response{JSONRPC: "2.0", ID: req.ID}
-		if rpcErr != nil {
-			resp.Error = rpcErr
-		} else {
-			resp.Result = result
-		}
-		if req.ID != nil {
-			responses = append(responses, resp)
-		}
-	}
+	responses := s.handleBatchMessages(sess, reqs)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(responses)
 }
 
-// handleSSEStream opens a persistent SSE connection.
-// For this server we don't push server-initiated messages,
-// but we keep the connection alive so clients that require it don't error out.
-func (s *Server) handleSSEStream(w http.ResponseWriter, r *http.Request) {
+// handleSSEStream opens a persistent SSE connection carrying server-initiated
+// notifications (learning changes made by any client), with periodic
+// keepalive pings. Clients reconnecting with Last-Event-ID are replayed
+// whatever they missed from the hub's buffer.
+func (s *Server) handleSSEStream(w http.ResponseWriter, r *http.Request, sess *Session) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
 
+	events, backlog, gap, cancel := s.events.Subscribe(r.Header.Get("Last-Event-ID"))
+	defer cancel()
+
 	// Send an initial ping so the client knows we're alive
 	fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
-	if f, ok := w.(http.Flusher); ok {
-		f.Flush()
+	if gap {
+		// Some events are gone for good — tell the client to refetch
+		data, _ := json.Marshal(Notification{JSONRPC: "2.0", Method: "notifications/resources/list_changed"})
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	}
+	for _, ev := range backlog {
+		if sess.wants(ev) {
+			writeSSEEvent(w, ev)
+		}
 	}
+	flusher.Flush()
 
-	// Hold open until client disconnects
-	<-r.Context().Done()
+	var tick <-chan time.Time
+	if s.keepalive > 0 {
+		ticker := time.NewTicker(s.keepalive)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sess.done:
+			// Deleted or expired: later requests get 404, so end the stream too
+			return
+		case <-tick:
+			// An open stream counts as activity for idle expiry
+			sess.touch()
+			fmt.Fprintf(w, "event: ping\ndata: {}\n\n")
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				// Dropped for falling behind; the client reconnects with Last-Event-ID
+				return
+			}
+			if sess.wants(ev) {
+				writeSSEEvent(w, ev)
+				flusher.Flush()
+			}
+		}
+	}
+}
+
+func writeSSEEvent(w io.Writer, ev Event) {
+	fmt.Fprintf(w, "id: %s\nevent: message\ndata: %s\n\n", ev.ID, ev.Data)
 }
 
 // ── JSON-RPC dispatch ─────────────────────────────────────────────────────────
 
-func (s *Server) dispatch(req *Request) (any, *RPCError) {
+// handleMessage dispatches a single JSON-RPC message and builds its response.
+// It returns nil for successful notifications, which expect no reply.
+// Shared by every transport so HTTP and stdio behave identically.
+func (s *Server) handleMessage(sess *Session, req *Request) *Response {
+	result, rpcErr := s.dispatch(sess, req)
+	if req.ID == nil && rpcErr == nil {
+		return nil
+	}
+	resp := &Response{JSONRPC: "2.0", ID: req.ID}
+	if rpcErr != nil {
+		resp.Error = rpcErr
+	} else {
+		resp.Result = result
+	}
+	return resp
+}
+
+// handleBatchMessages dispatches a JSON-RPC batch, dropping replies to notifications.
+func (s *Server) handleBatchMessages(sess *Session, reqs []Request) []Response {
+	var responses []Response
+	for _, req := range reqs {
+		resp := s.handleMessage(sess, &req)
+		if resp != nil && req.ID != nil {
+			responses = append(responses, *resp)
+		}
+	}
+	return responses
+}
+
+func (s *Server) dispatch(sess *Session, req *Request) (any, *RPCError) {
 	log.Printf("→ %s (id=%v)", req.Method, req.ID)
 
+	if scope := s.scopeFor(req); !sess.principal().hasScope(scope) {
+		return nil, &RPCError{Code: -32001, Message: "insufficient scope: requires " + scope}
+	}
+
 	switch req.Method {
 	case "initialize":
-		return s.handleInitialize(req.Params)
+		return s.handleInitialize(sess, req.Params)
 	case "notifications/initialized":
 		return nil, nil
 	case "ping":
 		return map[string]string{}, nil
 	case "tools/list":
-		return map[string]any{"tools": GetTools()}, nil
+		return map[string]any{"tools": s.visibleTools(sess)}, nil
 	case "tools/call":
-		return s.handleToolCall(req.Params)
+		return s.handleToolCall(sess, req.Params)
+	case "resources/list":
+		return s.handleResourcesList(sess, req.Params)
+	case "resources/read":
+		return s.handleResourcesRead(sess, req.Params)
+	case "resources/templates/list":
+		return s.handleResourceTemplatesList()
+	case "resources/subscribe":
+		return s.handleResourcesSubscribe(sess, req.Params, true)
+	case "resources/unsubscribe":
+		return s.handleResourcesSubscribe(sess, req.Params, false)
+	case "prompts/list":
+		return s.handlePromptsList()
+	case "prompts/get":
+		return s.handlePromptsGet(sess, req.Params)
 	default:
 		return nil, &RPCError{Code: -32601, Message: fmt.Sprintf("method not found: %s", req.Method)}
 	}
 }
 
-func (s *Server) handleInitialize(params json.RawMessage) (any, *RPCError) {
+func (s *Server) handleInitialize(sess *Session, params json.RawMessage) (any, *RPCError) {
+	var p struct {
+		ProtocolVersion string          `json:"protocolVersion"`
+		ClientInfo      ClientInfo      `json:"clientInfo"`
+		Capabilities    json.RawMessage `json:"capabilities"`
+	}
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &p); err != nil {
+			return nil, &RPCError{Code: -32602, Message: "invalid params"}
+		}
+	}
+	sess.ProtocolVersion = negotiateProtocolVersion(p.ProtocolVersion)
+	sess.ClientInfo = p.ClientInfo
+	sess.ClientCapabilities = p.Capabilities
+	log.Printf("  client: %s protocol: requested=%q negotiated=%s",
+		sess.clientLabel(), p.ProtocolVersion, sess.ProtocolVersion)
+
 	return map[string]any{
-		"protocolVersion": "2024-11-05",
+		"protocolVersion": sess.ProtocolVersion,
 		"capabilities": map[string]any{
-			"tools": map[string]any{},
+			"tools":     map[string]any{"listChanged": true},
+			"resources": map[string]any{"subscribe": true, "listChanged": true},
+			"prompts":   map[string]any{},
 		},
 		"serverInfo": map[string]any{
 			"name":    "self-improvement-mcp",
@@ -202,7 +456,25 @@ After conversations where you learn something useful, call 'store_learning' to p
 	}, nil
 }
 
-func (s *Server) handleToolCall(params json.RawMessage) (any, *RPCError) {
+// visibleTools lists the tools the session's caller may invoke.
+func (s *Server) visibleTools(sess *Session) []Tool {
+	p := sess.principal()
+	var tools []Tool
+	for _, t := range toolsForSession(sess) {
+		if !p.allowsTool(t.Name) {
+			continue
+		}
+		if !s.oauth.enabled() || p.hasScope(s.requiredScope(t)) {
+			tools = append(tools, t)
+		}
+	}
+	if tools == nil {
+		tools = []Tool{}
+	}
+	return tools
+}
+
+func (s *Server) handleToolCall(sess *Session, params json.RawMessage) (any, *RPCError) {
 	var p struct {
 		Name      string          `json:"name"`
 		Arguments json.RawMessage `json:"arguments"`
@@ -210,14 +482,37 @@ func (s *Server) handleToolCall(params json.RawMessage) (any, *RPCError) {
 	if err := json.Unmarshal(params, &p); err != nil {
 		return nil, &RPCError{Code: -32602, Message: "invalid params"}
 	}
+	var target struct {
+		Namespace string `json:"namespace"`
+	}
+	json.Unmarshal(p.Arguments, &target)
+	ns, err := s.resolveNamespace(sess, target.Namespace)
+	if err != nil {
+		return errorResult(err.Error()), nil
+	}
+
+	if !sess.principal().allowsTool(p.Name) {
+		log.Printf("  tool: %s denied for %s", p.Name, sess.principal().Subject)
+		return errorResult(fmt.Sprintf("permission denied: this key may not call %s", p.Name)), nil
+	}
 
-	log.Printf("  tool: %s", p.Name)
-	result := HandleTool(s.backend, p.Name, p.Arguments)
+	n := sess.recordToolCall()
+	log.Printf("  tool: %s (session %s, call #%d, namespace %s)", p.Name, sess.clientLabel(), n, ns)
+	env := s.tools
+	env.source = sess.source()
+	result := HandleTool(env, s.backendFor(sess), ns, p.Name, p.Arguments)
+	if !sess.supportsStructuredOutput() {
+		result.StructuredContent = nil
+	}
 	return result, nil
 }
 
 // ── Helpers ───────────────────────────────────────────────────────────────────
 
+func batchUnsupportedMessage(sess *Session) string {
+	return fmt.Sprintf("JSON-RPC batching is not supported in protocol version %s", sess.ProtocolVersion)
+}
+
 func writeError(w http.ResponseWriter, id any, code int, msg string) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(Response{
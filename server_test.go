@@ -0,0 +1,518 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestServer serves /mcp from a server over an empty memory backend,
+// with cfg adjusted by configure if it isn't nil.
+func newTestServer(t *testing.T, configure func(cfg *Config)) (*Server, *httptest.Server) {
+	t.Helper()
+	cfg := DefaultConfig()
+	if configure != nil {
+		configure(cfg)
+	}
+	s, err := NewServer(testMemoryBackend(t), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(s.handleMCP))
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// newMCPRequest builds an HTTP request to /mcp with the session ID, if any.
+func newMCPRequest(t *testing.T, ts *httptest.Server, method, session, body string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequest(method, ts.URL, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if session != "" {
+		req.Header.Set("Mcp-Session-Id", session)
+	}
+	return req
+}
+
+func doRequest(t *testing.T, ts *httptest.Server, req *http.Request) *http.Response {
+	t.Helper()
+	resp, err := ts.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+// mcpRequest sends an HTTP request to /mcp with the session ID, if any.
+func mcpRequest(t *testing.T, ts *httptest.Server, method, session, body string) *http.Response {
+	t.Helper()
+	return doRequest(t, ts, newMCPRequest(t, ts, method, session, body))
+}
+
+// initializeSession opens a session speaking the given protocol revision
+// and returns its ID.
+func initializeSession(t *testing.T, ts *httptest.Server, version string) string {
+	t.Helper()
+	resp := mcpRequest(t, ts, http.MethodPost, "",
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"`+version+`","clientInfo":{"name":"test"}}}`)
+	defer resp.Body.Close()
+	session := resp.Header.Get("Mcp-Session-Id")
+	if resp.StatusCode != http.StatusOK || session == "" {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("initialize: %d %s", resp.StatusCode, body)
+	}
+	return session
+}
+
+// openStream opens the session's event stream, resuming after lastEventID
+// unless it is "", and reads its first ping. The stream is cut off after
+// ten seconds so a missing event can't hang the test.
+func openStream(t *testing.T, ts *httptest.Server, session, lastEventID string) *bufio.Reader {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Second)
+	t.Cleanup(cancel)
+	req := newMCPRequest(t, ts, http.MethodGet, session, "").WithContext(ctx)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp := doRequest(t, ts, req)
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET /mcp: %d", resp.StatusCode)
+	}
+	r := bufio.NewReader(resp.Body)
+	if ev, err := readSSE(r); err != nil || ev.event != "ping" {
+		t.Fatalf("stream starts with %+v (%v)", ev, err)
+	}
+	return r
+}
+
+type sseEvent struct {
+	id, event, data string
+}
+
+// readSSE reads the next event from a stream.
+func readSSE(r *bufio.Reader) (sseEvent, error) {
+	var ev sseEvent
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return ev, err
+		}
+		line = strings.TrimSuffix(line, "\n")
+		if line == "" {
+			return ev, nil
+		}
+		field, value, _ := strings.Cut(line, ": ")
+		switch field {
+		case "id":
+			ev.id = value
+		case "event":
+			ev.event = value
+		case "data":
+			ev.data = value
+		}
+	}
+}
+
+// nextChange reads the stream up to the next notifications/learnings/changed
+// and returns its event ID and the learning ID it names.
+func nextChange(t *testing.T, r *bufio.Reader) (eventID, learningID string) {
+	t.Helper()
+	for {
+		ev, err := readSSE(r)
+		if err != nil {
+			t.Fatalf("reading the stream: %v", err)
+		}
+		var n struct {
+			Method string            `json:"method"`
+			Params map[string]string `json:"params"`
+		}
+		if ev.event == "message" && json.Unmarshal([]byte(ev.data), &n) == nil && n.Method == "notifications/learnings/changed" {
+			return ev.id, n.Params["id"]
+		}
+	}
+}
+
+// streamEnds fails the test unless the stream is closed within a few
+// seconds.
+func streamEnds(t *testing.T, r *bufio.Reader) {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(io.Discard, r)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("stream ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("stream still open")
+	}
+}
+
+// TestSessionEndClosesStream ends a session with an open event stream, by
+// DELETE and by expiry: the stream must be closed, not left open until the
+// client gives up.
+func TestSessionEndClosesStream(t *testing.T) {
+	t.Run("delete", func(t *testing.T) {
+		_, ts := newTestServer(t, nil)
+		session := initializeSession(t, ts, "2025-06-18")
+		stream := openStream(t, ts, session, "")
+		resp := mcpRequest(t, ts, http.MethodDelete, session, "")
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNoContent {
+			t.Fatalf("DELETE: %d", resp.StatusCode)
+		}
+		streamEnds(t, stream)
+	})
+	t.Run("expiry", func(t *testing.T) {
+		s, ts := newTestServer(t, func(cfg *Config) {
+			cfg.Server.SessionIdleTimeout.Duration = 50 * time.Millisecond
+			cfg.Server.SSEKeepalive.Duration = 0
+		})
+		session := initializeSession(t, ts, "2025-06-18")
+		stream := openStream(t, ts, session, "")
+		time.Sleep(100 * time.Millisecond)
+		s.sessions.expireIdle()
+		streamEnds(t, stream)
+	})
+}
+
+// rpc posts a JSON-RPC request in the session and decodes the result into
+// v, failing on an error response.
+func rpc(t *testing.T, ts *httptest.Server, session, body string, v any) {
+	t.Helper()
+	resp := mcpRequest(t, ts, http.MethodPost, session, body)
+	defer resp.Body.Close()
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *RPCError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		t.Fatalf("%d: %v", resp.StatusCode, err)
+	}
+	if reply.Error != nil {
+		t.Fatalf("%s: error %d %s", body, reply.Error.Code, reply.Error.Message)
+	}
+	if err := json.Unmarshal(reply.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// storeLearning calls store_learning in the session.
+func storeLearning(t *testing.T, ts *httptest.Server, session, content string) {
+	t.Helper()
+	var result map[string]any
+	rpc(t, ts, session, `{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"store_learning","arguments":{"category":"technical","content":"`+content+`"}}}`, &result)
+	if result["isError"] == true {
+		t.Fatalf("store_learning: %v", result)
+	}
+}
+
+func TestSessionLifecycle(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+
+	resp := mcpRequest(t, ts, http.MethodPost, "", `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`)
+	var init struct {
+		Result struct {
+			ProtocolVersion string `json:"protocolVersion"`
+		} `json:"result"`
+	}
+	json.NewDecoder(resp.Body).Decode(&init)
+	resp.Body.Close()
+	session := resp.Header.Get("Mcp-Session-Id")
+	if resp.StatusCode != http.StatusOK || session == "" || init.Result.ProtocolVersion != "2025-06-18" {
+		t.Fatalf("initialize: %d, session %q, protocol %q", resp.StatusCode, session, init.Result.ProtocolVersion)
+	}
+	if other := initializeSession(t, ts, "2025-06-18"); other == session {
+		t.Fatal("two sessions got the same ID")
+	}
+
+	list := `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`
+	for _, tc := range []struct {
+		name, method, session string
+		want                  int
+	}{
+		{"POST without a session", http.MethodPost, "", http.StatusBadRequest},
+		{"GET without a session", http.MethodGet, "", http.StatusBadRequest},
+		{"DELETE without a session", http.MethodDelete, "", http.StatusBadRequest},
+		{"unknown session", http.MethodPost, "0123456789abcdef", http.StatusNotFound},
+		{"live session", http.MethodPost, session, http.StatusOK},
+		{"DELETE", http.MethodDelete, session, http.StatusNoContent},
+		{"deleted session", http.MethodPost, session, http.StatusNotFound},
+		{"DELETE again", http.MethodDelete, session, http.StatusNotFound},
+	} {
+		resp := mcpRequest(t, ts, tc.method, tc.session, list)
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("%s: %d, want %d", tc.name, resp.StatusCode, tc.want)
+		}
+	}
+}
+
+func TestProtocolVersionHeader(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	session := initializeSession(t, ts, "2025-06-18")
+	for version, want := range map[string]int{
+		"2025-06-18": http.StatusOK,
+		"2024-11-05": http.StatusOK,
+		"2099-01-01": http.StatusBadRequest,
+		"latest":     http.StatusBadRequest,
+	} {
+		req := newMCPRequest(t, ts, http.MethodPost, session, `{"jsonrpc":"2.0","id":2,"method":"ping"}`)
+		req.Header.Set("Mcp-Protocol-Version", version)
+		resp := doRequest(t, ts, req)
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("Mcp-Protocol-Version %s: %d, want %d", version, resp.StatusCode, want)
+		}
+	}
+}
+
+// TestBatches sends a batch in sessions of each revision: only those before
+// 2025-06-18 may batch.
+func TestBatches(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	batch := `[{"jsonrpc":"2.0","id":1,"method":"ping"},{"jsonrpc":"2.0","id":2,"method":"tools/list"}]`
+	for version, allowed := range map[string]bool{
+		"2024-11-05": true,
+		"2025-03-26": true,
+		"2025-06-18": false,
+	} {
+		session := initializeSession(t, ts, version)
+		resp := mcpRequest(t, ts, http.MethodPost, session, batch)
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		var replies []Response
+		if allowed {
+			if err := json.Unmarshal(body, &replies); err != nil || len(replies) != 2 {
+				t.Errorf("%s: batch answered with %s", version, body)
+			}
+			continue
+		}
+		var reply Response
+		if err := json.Unmarshal(body, &reply); err != nil || reply.Error == nil || reply.Error.Code != -32600 {
+			t.Errorf("%s: batch answered with %s, want error -32600", version, body)
+		}
+	}
+}
+
+// TestRevisionFeatures lists tools and calls one in a session of each
+// revision: titles, output schemas and structuredContent only from
+// 2025-06-18, annotations only from 2025-03-26.
+func TestRevisionFeatures(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	for _, tc := range []struct {
+		version                 string
+		annotations, structured bool
+	}{
+		{"2024-11-05", false, false},
+		{"2025-03-26", true, false},
+		{"2025-06-18", true, true},
+	} {
+		session := initializeSession(t, ts, tc.version)
+		var list struct {
+			Tools []map[string]json.RawMessage `json:"tools"`
+		}
+		rpc(t, ts, session, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`, &list)
+		if len(list.Tools) == 0 {
+			t.Fatalf("%s: no tools", tc.version)
+		}
+		var annotated, titled, schemas int
+		for _, tool := range list.Tools {
+			if tool["annotations"] != nil {
+				annotated++
+			}
+			if tool["title"] != nil {
+				titled++
+			}
+			if tool["outputSchema"] != nil {
+				schemas++
+			}
+		}
+		if (annotated > 0) != tc.annotations || (titled > 0) != tc.structured || (schemas > 0) != tc.structured {
+			t.Errorf("%s: %d tools with annotations, %d with titles, %d with output schemas", tc.version, annotated, titled, schemas)
+		}
+
+		var result map[string]json.RawMessage
+		rpc(t, ts, session, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"get_stats","arguments":{}}}`, &result)
+		if (result["structuredContent"] != nil) != tc.structured {
+			t.Errorf("%s: get_stats result %s", tc.version, result)
+		}
+	}
+}
+
+// TestBearerAuth checks the challenge without a valid key, and that a key
+// limited to some tools sees and calls only those.
+func TestBearerAuth(t *testing.T) {
+	_, ts := newTestServer(t, func(cfg *Config) {
+		cfg.Auth.Realm = "test"
+		cfg.Auth.Tokens = []TokenConfig{
+			{Name: "full", Token: "full-secret"},
+			{Name: "reader", Token: "reader-secret", Tools: []string{"lookup_context", "get_stats"}},
+		}
+	})
+	initialize := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18"}}`
+	post := func(token, session, body string) *http.Response {
+		req := newMCPRequest(t, ts, http.MethodPost, session, body)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return doRequest(t, ts, req)
+	}
+
+	for token, want := range map[string]string{
+		"":      `Bearer realm="test"`,
+		"wrong": `Bearer realm="test", error="invalid_token"`,
+	} {
+		resp := post(token, "", initialize)
+		resp.Body.Close()
+		if challenge := resp.Header.Get("WWW-Authenticate"); resp.StatusCode != http.StatusUnauthorized || !strings.HasPrefix(challenge, want) {
+			t.Errorf("token %q: %d, challenge %q, want 401 with %q", token, resp.StatusCode, challenge, want)
+		}
+	}
+
+	session := func(token string) string {
+		resp := post(token, "", initialize)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("initialize with %s: %d", token, resp.StatusCode)
+		}
+		return resp.Header.Get("Mcp-Session-Id")
+	}
+	tools := func(token, session string) []string {
+		resp := post(token, session, `{"jsonrpc":"2.0","id":2,"method":"tools/list"}`)
+		defer resp.Body.Close()
+		var reply struct {
+			Result struct {
+				Tools []Tool `json:"tools"`
+			} `json:"result"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+			t.Fatal(err)
+		}
+		return toolNames(reply.Result.Tools)
+	}
+	call := func(token, session, tool string) string {
+		resp := post(token, session, `{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"`+tool+`","arguments":{"category":"technical","content":"x"}}}`)
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	full, reader := session("full-secret"), session("reader-secret")
+	if got := tools("full-secret", full); len(got) < 3 || !slices.Contains(got, "store_learning") {
+		t.Errorf("full key lists %v", got)
+	}
+	if got := tools("reader-secret", reader); !slices.Equal(got, []string{"lookup_context", "get_stats"}) {
+		t.Errorf("reader key lists %v, want lookup_context and get_stats", got)
+	}
+	if body := call("reader-secret", reader, "store_learning"); !strings.Contains(body, `"isError":true`) || !strings.Contains(body, "permission denied") {
+		t.Errorf("reader key calling store_learning: %s", body)
+	}
+	if body := call("reader-secret", reader, "get_stats"); strings.Contains(body, `"isError":true`) {
+		t.Errorf("reader key calling get_stats: %s", body)
+	}
+
+	// A session belongs to the key that opened it
+	resp := post("full-secret", reader, `{"jsonrpc":"2.0","id":4,"method":"tools/list"}`)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("another key's session: %d, want 404", resp.StatusCode)
+	}
+}
+
+// TestStreamResume reconnects to the event stream with the ID of the last
+// event seen: only what happened since must be replayed.
+func TestStreamResume(t *testing.T) {
+	_, ts := newTestServer(t, nil)
+	session := initializeSession(t, ts, "2025-06-18")
+
+	stream := openStream(t, ts, session, "")
+	storeLearning(t, ts, session, "first learning")
+	seen, first := nextChange(t, stream)
+
+	storeLearning(t, ts, session, "second learning")
+	resumed := openStream(t, ts, session, seen)
+	if _, id := nextChange(t, resumed); id == first || id == "" {
+		t.Fatalf("resuming after %s replayed the change to %q", seen, id)
+	}
+}
+
+// lockedBuffer collects output written from several goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// TestServeStdio runs a session over stdio: replies come back one per line
+// and match their requests.
+func TestServeStdio(t *testing.T) {
+	s, _ := newTestServer(t, nil)
+	in := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-06-18","clientInfo":{"name":"stdio-test"}}}`,
+		`{"jsonrpc":"2.0","method":"notifications/initialized"}`,
+		`{"jsonrpc":"2.0","id":2,"method":"tools/call","params":{"name":"store_learning","arguments":{"category":"technical","content":"stdio works"}}}`,
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"lookup_context","arguments":{"query":"stdio"}}}`,
+	}, "\n") + "\n"
+	var out lockedBuffer
+	if err := s.ServeStdio(strings.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	replies := map[string]json.RawMessage{}
+	for line := range strings.Lines(out.String()) {
+		var msg struct {
+			ID     json.RawMessage `json:"id"`
+			Method string          `json:"method"`
+			Result json.RawMessage `json:"result"`
+			Error  *RPCError       `json:"error"`
+		}
+		if err := json.Unmarshal([]byte(line), &msg); err != nil {
+			t.Fatalf("output line %q: %v", line, err)
+		}
+		if msg.Method != "" {
+			continue // a change notification
+		}
+		if msg.Error != nil {
+			t.Fatalf("reply %s: error %s", msg.ID, msg.Error.Message)
+		}
+		replies[string(msg.ID)] = msg.Result
+	}
+	if len(replies) != 3 {
+		t.Fatalf("%d replies, want 3:\n%s", len(replies), out.String())
+	}
+	if !strings.Contains(string(replies["1"]), `"protocolVersion":"2025-06-18"`) {
+		t.Errorf("initialize: %s", replies["1"])
+	}
+	if !strings.Contains(string(replies["3"]), "stdio works") {
+		t.Errorf("lookup_context doesn't find the stored learning: %s", replies["3"])
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// ClientInfo is the implementation info a client sends in initialize.
+type ClientInfo struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// Session holds per-client state negotiated during initialize.
+// Fields set by initialize are read-only once the session is registered;
+// activity counters are guarded by mu.
+type Session struct {
+	ID                 string
+	ProtocolVersion    string
+	ClientInfo         ClientInfo
+	ClientCapabilities json.RawMessage
+	Namespace          string          // home namespace for tools, resources and prompts
+	shared             map[string]bool // other namespaces the session may use explicitly
+	CreatedAt          time.Time
+	done               chan struct{} // closed when the session is deleted or expires
+
+	mu            sync.Mutex
+	caller        *Principal // latest credentials of the caller that owns the session; nil with auth disabled
+	lastSeen      time.Time
+	toolCalls     int
+	subscriptions map[string]bool // resource URIs from resources/subscribe
+}
+
+// newSession returns a session that assumes the given protocol revision
+// until initialize negotiates one.
+func newSession(protocolVersion string) *Session {
+	now := time.Now()
+	return &Session{
+		ID:              newSessionID(),
+		ProtocolVersion: protocolVersion,
+		Namespace:       defaultNamespace,
+		CreatedAt:       now,
+		done:            make(chan struct{}),
+		lastSeen:        now,
+	}
+}
+
+// newSessionID returns a cryptographically random, visible-ASCII session ID.
+func newSessionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("session id: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
+
+func (sess *Session) touch() {
+	sess.mu.Lock()
+	sess.lastSeen = time.Now()
+	sess.mu.Unlock()
+}
+
+func (sess *Session) idleSince() time.Time {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.lastSeen
+}
+
+// recordToolCall counts a tool invocation against this session.
+func (sess *Session) recordToolCall() int {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	sess.toolCalls++
+	return sess.toolCalls
+}
+
+func (sess *Session) principal() *Principal {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.caller
+}
+
+// setPrincipal records the caller's current credentials; the subject stays
+// the same but scopes may change as OAuth tokens are refreshed.
+func (sess *Session) setPrincipal(p *Principal) {
+	sess.mu.Lock()
+	sess.caller = p
+	sess.mu.Unlock()
+}
+
+func (sess *Session) subscribe(uri string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	if sess.subscriptions == nil {
+		sess.subscriptions = map[string]bool{}
+	}
+	sess.subscriptions[uri] = true
+}
+
+func (sess *Session) unsubscribe(uri string) {
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	delete(sess.subscriptions, uri)
+}
+
+// canUse reports whether the session may work in a namespace.
+func (sess *Session) canUse(ns string) bool {
+	return ns == sess.Namespace || sess.shared[ns]
+}
+
+// wants reports whether an event should be delivered to this session:
+// resource-specific events only go to sessions subscribed to that resource
+// in their home namespace, and other events only to sessions that may use
+// the namespace they concern.
+func (sess *Session) wants(ev Event) bool {
+	if ev.Session != "" && ev.Session != sess.ID {
+		return false
+	}
+	if ev.Namespace != "" && !sess.canUse(ev.Namespace) {
+		return false
+	}
+	if ev.URI == "" {
+		return true
+	}
+	if ev.Namespace != sess.Namespace {
+		return false
+	}
+	sess.mu.Lock()
+	defer sess.mu.Unlock()
+	return sess.subscriptions[ev.URI]
+}
+
+// source is what the learnings this session writes are recorded as coming from.
+func (sess *Session) source() Source {
+	src := Source{Client: sess.ClientInfo.Name, ClientVersion: sess.ClientInfo.Version, Session: sess.ID}
+	if p := sess.principal(); p != nil {
+		src.Author = p.Subject
+	}
+	return src
+}
+
+// clientLabel identifies the session in logs, e.g. "claude-code/1.2.3 [a1b2c3d4]".
+func (sess *Session) clientLabel() string {
+	short := sess.ID
+	if len(short) > 8 {
+		short = short[:8]
+	}
+	name := sess.ClientInfo.Name
+	if name == "" {
+		name = "unknown-client"
+	}
+	if sess.ClientInfo.Version != "" {
+		name += "/" + sess.ClientInfo.Version
+	}
+	return name + " [" + short + "]"
+}
+
+// ── Registry ──────────────────────────────────────────────────────────────────
+
+// SessionRegistry tracks live streamable HTTP sessions and expires idle ones.
+type SessionRegistry struct {
+	mu          sync.Mutex
+	sessions    map[string]*Session
+	idleTimeout time.Duration
+}
+
+func NewSessionRegistry(idleTimeout time.Duration) *SessionRegistry {
+	return &SessionRegistry{sessions: map[string]*Session{}, idleTimeout: idleTimeout}
+}
+
+func (r *SessionRegistry) Add(sess *Session) {
+	r.mu.Lock()
+	r.sessions[sess.ID] = sess
+	r.mu.Unlock()
+	who := "anonymous"
+	if p := sess.principal(); p != nil {
+		who = p.Subject
+	}
+	log.Printf("session opened: %s (protocol %s, caller %s, namespace %s)", sess.clientLabel(), sess.ProtocolVersion, who, sess.Namespace)
+}
+
+// Get returns the live session with this ID and marks it active, or nil.
+func (r *SessionRegistry) Get(id string) *Session {
+	r.mu.Lock()
+	sess := r.sessions[id]
+	r.mu.Unlock()
+	if sess == nil {
+		return nil
+	}
+	if r.idleTimeout > 0 && time.Since(sess.idleSince()) > r.idleTimeout {
+		r.Delete(id)
+		return nil
+	}
+	sess.touch()
+	return sess
+}
+
+// Delete terminates a session, ending its event stream. It reports whether
+// the session existed.
+func (r *SessionRegistry) Delete(id string) bool {
+	r.mu.Lock()
+	sess, ok := r.sessions[id]
+	delete(r.sessions, id)
+	r.mu.Unlock()
+	if ok {
+		close(sess.done)
+		log.Printf("session closed: %s", sess.clientLabel())
+	}
+	return ok
+}
+
+func (r *SessionRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.sessions)
+}
+
+// expireIdle drops every session idle for longer than the timeout, ending
+// their event streams.
+func (r *SessionRegistry) expireIdle() {
+	if r.idleTimeout <= 0 {
+		return
+	}
+	r.mu.Lock()
+	var expired []*Session
+	for id, sess := range r.sessions {
+		if time.Since(sess.idleSince()) > r.idleTimeout {
+			expired = append(expired, sess)
+			delete(r.sessions, id)
+		}
+	}
+	r.mu.Unlock()
+	for _, sess := range expired {
+		close(sess.done)
+		log.Printf("session expired: %s", sess.clientLabel())
+	}
+}
+
+// RunJanitor periodically expires idle sessions. It runs for the life of the process.
+func (r *SessionRegistry) RunJanitor() {
+	if r.idleTimeout <= 0 {
+		return
+	}
+	interval := r.idleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	for range time.Tick(interval) {
+		r.expireIdle()
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"sync"
+)
+
+// ServeStdio runs the MCP stdio transport: the client launches us as a
+// subprocess and exchanges newline-delimited JSON-RPC messages over
+// stdin/stdout. Nothing but protocol messages may be written to out, so all
+// logging must go to stderr.
+func (s *Server) ServeStdio(in io.Reader, out io.Writer) error {
+	reader := bufio.NewReader(in)
+	w := &stdioWriter{enc: json.NewEncoder(out)}
+
+	// One client per process: the whole stream is a single session
+	sess := newSession(protocol20241105)
+	if err := s.bindNamespace(sess, nil, nil); err != nil {
+		return err
+	}
+
+	// Interleave change notifications with replies on stdout
+	done := make(chan struct{})
+	defer close(done)
+	go s.forwardStdioEvents(sess, w, done)
+
+	for {
+		line, err := reader.ReadBytes('\n')
+		if len(trimSpace(line)) > 0 {
+			if reply := s.handleStdioLine(sess, line); reply != nil {
+				if encErr := w.write(reply); encErr != nil {
+					return encErr
+				}
+			}
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				log.Printf("stdio: client closed stdin")
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// forwardStdioEvents writes the session's change notifications until done
+// is closed. The hub drops subscribers that fall behind; there is no client
+// to reconnect here, so it resubscribes itself, replaying what it missed
+// from the hub's buffer, or telling the client to refetch if that's gone.
+func (s *Server) forwardStdioEvents(sess *Session, w *stdioWriter, done <-chan struct{}) {
+	lastEventID := ""
+	for {
+		events, backlog, gap, cancel := s.events.Subscribe(lastEventID)
+		if gap {
+			log.Printf("stdio: notifications since %s are gone; asking the client to refetch", lastEventID)
+			w.write(Notification{JSONRPC: "2.0", Method: "notifications/resources/list_changed"})
+		}
+		for _, ev := range backlog {
+			if sess.wants(ev) {
+				w.write(ev.Data)
+			}
+			lastEventID = ev.ID
+		}
+	forward:
+		for {
+			select {
+			case <-done:
+				cancel()
+				return
+			case ev, ok := <-events:
+				if !ok {
+					break forward
+				}
+				if sess.wants(ev) {
+					w.write(ev.Data)
+				}
+				lastEventID = ev.ID
+			}
+		}
+		log.Printf("stdio: fell behind on notifications; resuming after %s", lastEventID)
+	}
+}
+
+// stdioWriter serialises writes to stdout so replies and notifications
+// never interleave mid-message.
+type stdioWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder // Encode terminates each message with '\n'
+}
+
+func (w *stdioWriter) write(v any) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.enc.Encode(v)
+}
+
+// handleStdioLine processes one line from stdin and returns the value to
+// write back, or nil if no reply is due.
+func (s *Server) handleStdioLine(sess *Session, line []byte) any {
+	trimmed := trimSpace(line)
+
+	// Support both single request and batch (array)
+	if trimmed[0] == '[' {
+		if !sess.supportsBatch() {
+			return Response{JSONRPC: "2.0", Error: &RPCError{Code: -32600, Message: batchUnsupportedMessage(sess)}}
+		}
+		var reqs []Request
+		if err := json.Unmarshal(trimmed, &reqs); err != nil {
+			return Response{JSONRPC: "2.0", Error: &RPCError{Code: -32700, Message: "parse error"}}
+		}
+		if responses := s.handleBatchMessages(sess, reqs); len(responses) > 0 {
+			return responses
+		}
+		return nil
+	}
+
+	var req Request
+	if err := json.Unmarshal(trimmed, &req); err != nil {
+		return Response{JSONRPC: "2.0", Error: &RPCError{Code: -32700, Message: "parse error"}}
+	}
+	if resp := s.handleMessage(sess, &req); resp != nil {
+		return resp
+	}
+	return nil
+}
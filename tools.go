@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -9,9 +10,22 @@ import (
 // ── MCP protocol types ───────────────────────────────────────────────────────
 
 type Tool struct {
-	Name        string      `json:"name"`
-	Description string      `json:"description"`
-	InputSchema InputSchema `json:"inputSchema"`
+	Name         string           `json:"name"`
+	Title        string           `json:"title,omitempty"` // 2025-06-18+
+	Description  string           `json:"description"`
+	InputSchema  InputSchema      `json:"inputSchema"`
+	OutputSchema *InputSchema     `json:"outputSchema,omitempty"` // 2025-06-18+; same object-schema shape as inputs
+	Annotations  *ToolAnnotations `json:"annotations,omitempty"`  // 2025-03-26+
+}
+
+// ToolAnnotations are behaviour hints clients use to decide e.g. whether to
+// ask for confirmation. All hints are sent explicitly since the spec defaults
+// (destructive, open-world) are the opposite of what most of our tools do.
+type ToolAnnotations struct {
+	ReadOnlyHint    bool `json:"readOnlyHint"`
+	DestructiveHint bool `json:"destructiveHint"`
+	IdempotentHint  bool `json:"idempotentHint"`
+	OpenWorldHint   bool `json:"openWorldHint"`
 }
 
 type InputSchema struct {
@@ -22,14 +36,22 @@ type InputSchema struct {
 
 type Property struct {
 	Type        string   `json:"type"`
-	Description string   `json:"description"`
+	Description string   `json:"description,omitempty"`
 	Enum        []string `json:"enum,omitempty"`
 	Default     any      `json:"default,omitempty"`
+	Format      string   `json:"format,omitempty"`
+
+	// Nested schemas, used by output schemas
+	Items                *Property           `json:"items,omitempty"`
+	Properties           map[string]Property `json:"properties,omitempty"`
+	Required             []string            `json:"required,omitempty"`
+	AdditionalProperties *Property           `json:"additionalProperties,omitempty"`
 }
 
 type ToolResult struct {
-	Content []ContentBlock `json:"content"`
-	IsError bool           `json:"isError,omitempty"`
+	Content           []ContentBlock `json:"content"`
+	StructuredContent any            `json:"structuredContent,omitempty"` // 2025-06-18+; matches the tool's outputSchema
+	IsError           bool           `json:"isError,omitempty"`
 }
 
 type ContentBlock struct {
@@ -41,10 +63,105 @@ func textResult(text string) ToolResult {
 	return ToolResult{Content: []ContentBlock{{Type: "text", Text: text}}}
 }
 
+// structuredResult pairs the human-readable text with typed JSON for automation.
+func structuredResult(text string, data any) ToolResult {
+	return ToolResult{Content: []ContentBlock{{Type: "text", Text: text}}, StructuredContent: data}
+}
+
 func errorResult(text string) ToolResult {
 	return ToolResult{Content: []ContentBlock{{Type: "text", Text: text}}, IsError: true}
 }
 
+// ── Output schemas ───────────────────────────────────────────────────────────
+
+var learningSchema = Property{
+	Type: "object",
+	Properties: map[string]Property{
+		"id":         {Type: "string"},
+		"namespace":  {Type: "string"},
+		"category":   {Type: "string", Enum: validCategories},
+		"content":    {Type: "string"},
+		"tags":       {Type: "string", Description: "Comma-separated tags"},
+		"confidence": {Type: "number"},
+		"use_count":  {Type: "integer"},
+		"created_at": {Type: "string", Format: "date-time"},
+		"updated_at": {Type: "string", Format: "date-time"},
+		"superseded_by": {
+			Type:        "string",
+			Description: "ID of the learning this one was merged into",
+		},
+		"deleted_at": {
+			Type:        "string",
+			Format:      "date-time",
+			Description: "When the learning was moved to the trash",
+		},
+		"source": {
+			Type:        "object",
+			Description: "Who stored or last updated the learning",
+			Properties: map[string]Property{
+				"client":         {Type: "string", Description: "MCP client name"},
+				"client_version": {Type: "string"},
+				"session":        {Type: "string", Description: "MCP session ID"},
+				"conversation":   {Type: "string", Description: "Conversation URL or ID"},
+				"author":         {Type: "string", Description: "Authenticated caller"},
+			},
+		},
+		"match": {
+			Type:        "object",
+			Description: "Why a search returned this learning: its rank in each ranking and the fused reciprocal rank score",
+			Properties: map[string]Property{
+				"score":        {Type: "number"},
+				"keyword_rank": {Type: "integer"},
+				"vector_rank":  {Type: "integer"},
+				"similarity":   {Type: "number"},
+			},
+			Required: []string{"score"},
+		},
+	},
+	Required: []string{"id", "namespace", "category", "content", "tags", "confidence", "use_count", "created_at", "updated_at"},
+}
+
+var revisionSchema = Property{
+	Type: "object",
+	Properties: map[string]Property{
+		"revision":   {Type: "integer"},
+		"content":    {Type: "string"},
+		"tags":       {Type: "string"},
+		"confidence": {Type: "number"},
+		"updated_at": {Type: "string", Format: "date-time"},
+		"current":    {Type: "boolean"},
+	},
+	Required: []string{"revision", "content", "tags", "confidence", "updated_at"},
+}
+
+var learningListSchema = &InputSchema{
+	Type: "object",
+	Properties: map[string]Property{
+		"learnings": {Type: "array", Items: &learningSchema},
+		"count":     {Type: "integer"},
+	},
+	Required: []string{"learnings", "count"},
+}
+
+func idResultSchema(flag string) *InputSchema {
+	return &InputSchema{
+		Type: "object",
+		Properties: map[string]Property{
+			"id": {Type: "string"},
+			flag: {Type: "boolean"},
+		},
+		Required: []string{"id", flag},
+	}
+}
+
+// learningList is the structured content of tools that return several learnings.
+func learningList(learnings []*Learning) map[string]any {
+	if learnings == nil {
+		learnings = []*Learning{}
+	}
+	return map[string]any{"learnings": learnings, "count": len(learnings)}
+}
+
 var validCategories = []string{
 	"preferences",      // communication style, format preferences
 	"personal_context", // relevant personal facts that help responses
@@ -54,12 +171,39 @@ var validCategories = []string{
 	"general",          // catch-all
 }
 
+// namespaceProperty is accepted by every tool; see resolveNamespace.
+var namespaceProperty = Property{
+	Type:        "string",
+	Description: "Optional: work in this namespace (e.g. a shared team namespace) instead of your own",
+}
+
+// conversationProperty lets tools that write learnings record where they
+// were learned.
+var conversationProperty = Property{
+	Type:        "string",
+	Description: "Optional: URL or ID of this conversation, recorded with the learning so it can be traced back",
+}
+
+// adminTools act on a whole namespace at once. They are only offered to
+// keys that name them in their tools list, or to everyone when auth is off.
+var adminTools = []string{"export_learnings", "import_learnings"}
+
+func isAdminTool(name string) bool {
+	for _, t := range adminTools {
+		if t == name {
+			return true
+		}
+	}
+	return false
+}
+
 // ── Tool definitions ─────────────────────────────────────────────────────────
 
 func GetTools() []Tool {
-	return []Tool{
+	tools := []Tool{
 		{
-			Name: "lookup_context",
+			Name:  "lookup_context",
+			Title: "Look up context",
 			Description: `CALL THIS FIRST at the start of any conversation.
 Retrieves relevant learnings and context that should inform how to best interact with this user.
 Returns stored preferences, past mistakes to avoid, and relevant personal context.
@@ -84,9 +228,12 @@ Use the results to calibrate your tone, approach, and content before responding.
 				},
 				Required: []string{"query"},
 			},
+			OutputSchema: learningListSchema,
+			Annotations:  &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
 		},
 		{
-			Name: "store_learning",
+			Name:  "store_learning",
+			Title: "Store learning",
 			Description: `Store a new learning, observation, or improvement note.
 Use this to record: user preferences discovered during conversation, mistakes made and how to avoid them,
 useful context about the user, communication patterns that work well or poorly.
@@ -112,13 +259,44 @@ Be specific and actionable. Write as if briefing a future version of yourself.`,
 						Description: "Confidence in this learning, 0.0-1.0 (default 0.8)",
 						Default:     0.8,
 					},
+					"force": {
+						Type:        "boolean",
+						Description: "Store it even though similar learnings were suggested as duplicates",
+						Default:     false,
+					},
+					"conversation": conversationProperty,
 				},
 				Required: []string{"category", "content"},
 			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"action": {
+						Type:        "string",
+						Description: "stored; or, for a near-duplicate, rejected, merged into the existing learning, or duplicates listed for review",
+						Enum:        []string{"stored", "rejected", "merged", "duplicates"},
+					},
+					"learning": learningSchema,
+					"duplicates": {
+						Type: "array",
+						Items: &Property{
+							Type: "object",
+							Properties: map[string]Property{
+								"learning":   learningSchema,
+								"similarity": {Type: "number"},
+							},
+							Required: []string{"learning", "similarity"},
+						},
+					},
+				},
+				Required: []string{"action"},
+			},
+			Annotations: &ToolAnnotations{},
 		},
 		{
 			Name:        "list_learnings",
-			Description: "List stored learnings, optionally filtered by category.",
+			Title:       "List learnings",
+			Description: "List stored learnings, optionally filtered by category or by where they came from.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
@@ -127,6 +305,10 @@ Be specific and actionable. Write as if briefing a future version of yourself.`,
 						Description: "Optional: filter by category",
 						Enum:        append([]string{""}, validCategories...),
 					},
+					"source": {
+						Type:        "string",
+						Description: "Optional: only learnings last written by this client name, session ID, conversation or author",
+					},
 					"limit": {
 						Type:        "integer",
 						Description: "Max results (default 50)",
@@ -134,9 +316,12 @@ Be specific and actionable. Write as if briefing a future version of yourself.`,
 					},
 				},
 			},
+			OutputSchema: learningListSchema,
+			Annotations:  &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
 		},
 		{
 			Name:        "update_learning",
+			Title:       "Update learning",
 			Description: "Update an existing learning by ID. Use to refine or correct a stored learning.",
 			InputSchema: InputSchema{
 				Type: "object",
@@ -157,13 +342,145 @@ Be specific and actionable. Write as if briefing a future version of yourself.`,
 						Type:        "number",
 						Description: "Updated confidence score 0.0-1.0",
 					},
+					"conversation": conversationProperty,
 				},
 				Required: []string{"id", "content"},
 			},
+			OutputSchema: idResultSchema("updated"),
+			Annotations:  &ToolAnnotations{DestructiveHint: true, IdempotentHint: true},
+		},
+		{
+			Name:        "list_revisions",
+			Title:       "List revisions",
+			Description: "List every version of a learning, oldest first. Each update_learning keeps the version it replaced.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"id": {
+						Type:        "string",
+						Description: "ID of the learning",
+					},
+				},
+				Required: []string{"id"},
+			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"id":        {Type: "string"},
+					"revisions": {Type: "array", Items: &revisionSchema},
+				},
+				Required: []string{"id", "revisions"},
+			},
+			Annotations: &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
+		},
+		{
+			Name:        "diff_revisions",
+			Title:       "Diff revisions",
+			Description: "Show what changed in a learning between two revisions, as a line diff.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"id": {
+						Type:        "string",
+						Description: "ID of the learning",
+					},
+					"from": {
+						Type:        "integer",
+						Description: "Earlier revision number (see list_revisions)",
+					},
+					"to": {
+						Type:        "integer",
+						Description: "Later revision number (default: the current version)",
+					},
+				},
+				Required: []string{"id", "from"},
+			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"id":   {Type: "string"},
+					"from": {Type: "integer"},
+					"to":   {Type: "integer"},
+					"diff": {Type: "string"},
+				},
+				Required: []string{"id", "from", "to", "diff"},
+			},
+			Annotations: &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
+		},
+		{
+			Name:        "revert_learning",
+			Title:       "Revert learning",
+			Description: "Restore an earlier revision of a learning. The version it replaces is kept as a revision, so a revert can be undone too.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"id": {
+						Type:        "string",
+						Description: "ID of the learning",
+					},
+					"revision": {
+						Type:        "integer",
+						Description: "Revision number to restore (see list_revisions)",
+					},
+				},
+				Required: []string{"id", "revision"},
+			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"id":       {Type: "string"},
+					"reverted": {Type: "boolean"},
+					"revision": {Type: "integer", Description: "The revision restored"},
+				},
+				Required: []string{"id", "reverted", "revision"},
+			},
+			Annotations: &ToolAnnotations{DestructiveHint: true, IdempotentHint: true},
+		},
+		{
+			Name:  "merge_learnings",
+			Title: "Merge learnings",
+			Description: `Consolidate several learnings that say much the same thing into one.
+The merged learning keeps the earliest creation date, the summed use count, the highest confidence and all tags.
+The originals are kept but marked as superseded, so they no longer appear in lookups or lists.`,
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"ids": {
+						Type:        "array",
+						Description: "IDs of the learnings to merge (at least two)",
+						Items:       &Property{Type: "string"},
+					},
+					"content": {
+						Type:        "string",
+						Description: "The consolidated learning. Be specific and actionable.",
+					},
+					"category": {
+						Type:        "string",
+						Description: "Category of the merged learning (default: that of the first ID)",
+						Enum:        validCategories,
+					},
+					"tags": {
+						Type:        "string",
+						Description: "Extra comma-separated tags, added to those of the merged learnings",
+					},
+				},
+				Required: []string{"ids", "content"},
+			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"learning":   learningSchema,
+					"superseded": {Type: "array", Description: "IDs of the merged learnings", Items: &Property{Type: "string"}},
+					"unmarked":   {Type: "array", Description: "After a failed merge that couldn't be undone: IDs of learnings not marked superseded", Items: &Property{Type: "string"}},
+				},
+				Required: []string{"learning", "superseded"},
+			},
+			Annotations: &ToolAnnotations{},
 		},
 		{
 			Name:        "delete_learning",
-			Description: "Delete a learning by ID. Use when a learning is outdated, wrong, or no longer relevant.",
+			Title:       "Delete learning",
+			Description: "Delete a learning by ID. Use when a learning is outdated, wrong, or no longer relevant. Deleted learnings go to the trash, from which restore_learning can bring them back until they are purged.",
 			InputSchema: InputSchema{
 				Type: "object",
 				Properties: map[string]Property{
@@ -174,34 +491,189 @@ Be specific and actionable. Write as if briefing a future version of yourself.`,
 				},
 				Required: []string{"id"},
 			},
+			OutputSchema: idResultSchema("deleted"),
+			Annotations:  &ToolAnnotations{DestructiveHint: true, IdempotentHint: true},
+		},
+		{
+			Name:        "list_trash",
+			Title:       "List trash",
+			Description: "List deleted learnings that can still be restored, most recently deleted first.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"category": {
+						Type:        "string",
+						Description: "Optional: filter by category",
+						Enum:        append([]string{""}, validCategories...),
+					},
+					"limit": {
+						Type:        "integer",
+						Description: "Max results (default 50)",
+						Default:     50,
+					},
+				},
+			},
+			OutputSchema: learningListSchema,
+			Annotations:  &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
+		},
+		{
+			Name:        "restore_learning",
+			Title:       "Restore learning",
+			Description: "Take a deleted learning out of the trash, as it was when deleted. Use when a learning was deleted by mistake.",
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"id": {
+						Type:        "string",
+						Description: "ID of the deleted learning (see list_trash)",
+					},
+				},
+				Required: []string{"id"},
+			},
+			OutputSchema: idResultSchema("restored"),
+			Annotations:  &ToolAnnotations{IdempotentHint: true},
 		},
 		{
 			Name:        "get_stats",
+			Title:       "Learning stats",
 			Description: "Get a summary of stored learnings by category.",
 			InputSchema: InputSchema{
 				Type:       "object",
 				Properties: map[string]Property{},
 			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"categories": {Type: "object", Description: "Learning count per category", AdditionalProperties: &Property{Type: "integer"}},
+					"total":      {Type: "integer"},
+				},
+				Required: []string{"categories", "total"},
+			},
+			Annotations: &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
+		},
+		{
+			Name:  "export_learnings",
+			Title: "Export learnings (admin)",
+			Description: `Export every learning in the namespace as JSONL (one full record per line, for backups)
+or Markdown (grouped by category, for reading and editing by hand). The export is returned as text.`,
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"format": {
+						Type:        "string",
+						Description: "Export format (default jsonl)",
+						Enum:        []string{formatJSONL, formatMarkdown},
+						Default:     formatJSONL,
+					},
+					"category": {
+						Type:        "string",
+						Description: "Optional: only export this category",
+						Enum:        append([]string{""}, validCategories...),
+					},
+				},
+			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"format": {Type: "string"},
+					"count":  {Type: "integer"},
+					"data":   {Type: "string", Description: "The exported learnings"},
+				},
+				Required: []string{"format", "count", "data"},
+			},
+			Annotations: &ToolAnnotations{ReadOnlyHint: true, IdempotentHint: true},
+		},
+		{
+			Name:  "import_learnings",
+			Title: "Import learnings (admin)",
+			Description: `Import learnings from JSONL or Markdown as written by export_learnings, into this namespace.
+IDs, timestamps and use counts are kept. A learning already stored, with the same ID and creation time, is handled by the conflict policy; one whose ID is taken by a different learning gets a new ID.`,
+			InputSchema: InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"data": {
+						Type:        "string",
+						Description: "The JSONL or Markdown to import",
+					},
+					"format": {
+						Type:        "string",
+						Description: "Format of data (default: detected)",
+						Enum:        []string{"", formatJSONL, formatMarkdown},
+					},
+					"policy": {
+						Type:        "string",
+						Description: "For a learning already stored: keep the stored learning, overwrite it, or keep whichever was updated last (default skip)",
+						Enum:        []string{importSkip, importOverwrite, importKeepNewer},
+						Default:     importSkip,
+					},
+					"dry_run": {
+						Type:        "boolean",
+						Description: "Report what would be imported without storing anything",
+					},
+				},
+				Required: []string{"data"},
+			},
+			OutputSchema: &InputSchema{
+				Type: "object",
+				Properties: map[string]Property{
+					"created":     {Type: "integer"},
+					"overwritten": {Type: "integer"},
+					"skipped":     {Type: "integer"},
+					"renumbered":  {Type: "integer"},
+					"dry_run":     {Type: "boolean"},
+				},
+				Required: []string{"created", "overwritten", "skipped", "renumbered", "dry_run"},
+			},
+			Annotations: &ToolAnnotations{DestructiveHint: true},
 		},
 	}
+	for i := range tools {
+		tools[i].InputSchema.Properties["namespace"] = namespaceProperty
+	}
+	return tools
 }
 
 // ── Dispatch ─────────────────────────────────────────────────────────────────
 
-func HandleTool(backend Backend, name string, args json.RawMessage) ToolResult {
+// toolEnv is the server configuration tool handlers act on, and the caller
+// they act for.
+type toolEnv struct {
+	dedup  DedupConfig
+	trash  TrashConfig
+	source Source // recorded on every learning the caller writes
+}
+
+// HandleTool runs a tool against one namespace of the backend.
+func HandleTool(env toolEnv, backend Backend, namespace, name string, args json.RawMessage) ToolResult {
 	switch name {
 	case "lookup_context":
-		return handleLookup(backend, args)
+		return handleLookup(backend, namespace, args)
 	case "store_learning":
-		return handleStore(backend, args)
+		return handleStore(env, backend, namespace, args)
 	case "list_learnings":
-		return handleList(backend, args)
+		return handleList(backend, namespace, args)
 	case "update_learning":
-		return handleUpdate(backend, args)
+		return handleUpdate(env, backend, namespace, args)
+	case "list_revisions":
+		return handleListRevisions(backend, namespace, args)
+	case "diff_revisions":
+		return handleDiffRevisions(backend, namespace, args)
+	case "revert_learning":
+		return handleRevert(env, backend, namespace, args)
+	case "merge_learnings":
+		return handleMerge(env, backend, namespace, args)
 	case "delete_learning":
-		return handleDelete(backend, args)
+		return handleDelete(env, backend, namespace, args)
+	case "list_trash":
+		return handleListTrash(env, backend, namespace, args)
+	case "restore_learning":
+		return handleRestore(backend, namespace, args)
 	case "get_stats":
-		return handleStats(backend)
+		return handleStats(backend, namespace)
+	case "export_learnings":
+		return handleExport(backend, namespace, args)
+	case "import_learnings":
+		return handleImport(backend, namespace, args)
 	default:
 		return errorResult(fmt.Sprintf("unknown tool: %s", name))
 	}
@@ -209,7 +681,7 @@ func HandleTool(backend Backend, name string, args json.RawMessage) ToolResult {
 
 // ── Handlers ─────────────────────────────────────────────────────────────────
 
-func handleLookup(backend Backend, args json.RawMessage) ToolResult {
+func handleLookup(backend Backend, namespace string, args json.RawMessage) ToolResult {
 	var p struct {
 		Query    string `json:"query"`
 		Category string `json:"category"`
@@ -222,14 +694,22 @@ func handleLookup(backend Backend, args json.RawMessage) ToolResult {
 		p.Limit = 10
 	}
 
-	learnings, err := backend.Search(p.Query, p.Category, p.Limit)
+	learnings, err := backend.Search(namespace, p.Query, p.Category, p.Limit)
 	if err != nil {
 		return errorResult("search failed: " + err.Error())
 	}
 	if len(learnings) == 0 {
-		return textResult("No relevant learnings found. This may be a new topic or a fresh start.")
+		return structuredResult("No relevant learnings found. This may be a new topic or a fresh start.", learningList(nil))
+	}
+
+	for _, l := range learnings {
+		backend.IncrementUseCount(namespace, l.ID)
 	}
+	return structuredResult(formatFoundLearnings(learnings), learningList(learnings))
+}
 
+// formatFoundLearnings renders search results the way lookup_context presents them.
+func formatFoundLearnings(learnings []*Learning) string {
 	var sb strings.Builder
 	sb.WriteString(fmt.Sprintf("Found %d relevant learnings:\n\n", len(learnings)))
 	for _, l := range learnings {
@@ -238,39 +718,99 @@ func handleLookup(backend Backend, args json.RawMessage) ToolResult {
 		if l.Tags != "" {
 			sb.WriteString(fmt.Sprintf("tags: %s\n", l.Tags))
 		}
+		if l.Match != nil {
+			sb.WriteString(fmt.Sprintf("matched: %s\n", l.Match))
+		}
 		sb.WriteString("\n")
-		backend.IncrementUseCount(l.ID)
 	}
-	return textResult(sb.String())
+	return sb.String()
+}
+
+// validateLearning checks the category and confidence a caller gave for a
+// learning, after defaults are applied. An empty category is allowed.
+func validateLearning(category string, confidence float64) error {
+	if category != "" && !isValidCategory(category) {
+		return fmt.Errorf("unknown category %q (must be one of %s)", category, strings.Join(validCategories, ", "))
+	}
+	if confidence < 0 || confidence > 1 {
+		return fmt.Errorf("confidence %g is outside 0.0-1.0", confidence)
+	}
+	return nil
 }
 
-func handleStore(backend Backend, args json.RawMessage) ToolResult {
+func handleStore(env toolEnv, backend Backend, namespace string, args json.RawMessage) ToolResult {
 	var p struct {
-		Category   string  `json:"category"`
-		Content    string  `json:"content"`
-		Tags       string  `json:"tags"`
-		Confidence float64 `json:"confidence"`
+		Category     string  `json:"category"`
+		Content      string  `json:"content"`
+		Tags         string  `json:"tags"`
+		Confidence   float64 `json:"confidence"`
+		Force        bool    `json:"force"`
+		Conversation string  `json:"conversation"`
 	}
 	if err := json.Unmarshal(args, &p); err != nil {
 		return errorResult("invalid arguments: " + err.Error())
 	}
+	env.source.Conversation = p.Conversation
 	if p.Confidence == 0 {
 		p.Confidence = 0.8
 	}
 	if p.Category == "" {
 		p.Category = "general"
 	}
+	if err := validateLearning(p.Category, p.Confidence); err != nil {
+		return errorResult(err.Error())
+	}
 
-	l, err := backend.Add(p.Category, p.Content, p.Tags, p.Confidence)
+	if mode := env.dedup.Mode; mode != dedupOff && !(mode == dedupSuggest && p.Force) {
+		dups, err := findDuplicates(backend, namespace, p.Category, p.Content, env.dedup)
+		if err != nil {
+			return errorResult("duplicate check failed: " + err.Error())
+		}
+		if len(dups) > 0 {
+			return handleDuplicate(env, backend, namespace, p.Tags, dups)
+		}
+	}
+
+	l, err := backend.Add(namespace, p.Category, p.Content, p.Tags, p.Confidence, env.source)
 	if err != nil {
 		return errorResult("failed to store: " + err.Error())
 	}
-	return textResult(fmt.Sprintf("Learning stored successfully with ID:%s in category '%s'.", l.ID, l.Category))
+	return structuredResult(fmt.Sprintf("Learning stored successfully with ID:%s in category '%s'.", l.ID, l.Category),
+		map[string]any{"action": "stored", "learning": l})
+}
+
+// handleDuplicate answers a store_learning call whose content nearly
+// repeats stored learnings, according to the configured dedup mode.
+func handleDuplicate(env toolEnv, backend Backend, namespace, tags string, dups []duplicate) ToolResult {
+	best := dups[0]
+	switch env.dedup.Mode {
+	case dedupReject:
+		return structuredResult(fmt.Sprintf(
+			"Not stored: this repeats learning ID:%s (similarity %.2f). Use update_learning on ID:%s to refine it instead.\n%s",
+			best.Learning.ID, best.Similarity, best.Learning.ID, formatDuplicates(dups)),
+			map[string]any{"action": "rejected", "learning": best.Learning, "duplicates": dups})
+	case dedupMerge:
+		merged, err := mergeDuplicate(backend, namespace, best.Learning, tags, env.dedup.ConfidenceStep, env.source)
+		if err != nil {
+			return errorResult("merge failed: " + err.Error())
+		}
+		return structuredResult(fmt.Sprintf(
+			"Not stored separately: this repeats learning ID:%s (similarity %.2f), whose confidence is now %.2f.",
+			merged.ID, best.Similarity, merged.Confidence),
+			map[string]any{"action": "merged", "learning": merged, "duplicates": dups})
+	default:
+		return structuredResult(fmt.Sprintf(
+			"Not stored: similar learnings already exist. Call update_learning on one of them if it covers this, "+
+				"or call store_learning again with force: true if this is genuinely new.\n%s",
+			formatDuplicates(dups)),
+			map[string]any{"action": "duplicates", "duplicates": dups})
+	}
 }
 
-func handleList(backend Backend, args json.RawMessage) ToolResult {
+func handleList(backend Backend, namespace string, args json.RawMessage) ToolResult {
 	var p struct {
 		Category string `json:"category"`
+		Source   string `json:"source"`
 		Limit    int    `json:"limit"`
 	}
 	json.Unmarshal(args, &p)
@@ -278,12 +818,12 @@ func handleList(backend Backend, args json.RawMessage) ToolResult {
 		p.Limit = 50
 	}
 
-	learnings, err := backend.List(p.Category, p.Limit)
+	learnings, err := backend.List(namespace, p.Category, p.Source, p.Limit)
 	if err != nil {
 		return errorResult("list failed: " + err.Error())
 	}
 	if len(learnings) == 0 {
-		return textResult("No learnings stored yet.")
+		return structuredResult("No learnings stored yet.", learningList(nil))
 	}
 
 	var sb strings.Builder
@@ -294,45 +834,193 @@ func handleList(backend Backend, args json.RawMessage) ToolResult {
 		if l.Tags != "" {
 			sb.WriteString(fmt.Sprintf("tags: %s\n", l.Tags))
 		}
+		if from := l.Source.String(); from != "" {
+			sb.WriteString(fmt.Sprintf("from: %s\n", from))
+		}
 		sb.WriteString(fmt.Sprintf("updated: %s\n\n", l.UpdatedAt.Format("2006-01-02")))
 	}
-	return textResult(sb.String())
+	return structuredResult(sb.String(), learningList(learnings))
 }
 
-func handleUpdate(backend Backend, args json.RawMessage) ToolResult {
+func handleUpdate(env toolEnv, backend Backend, namespace string, args json.RawMessage) ToolResult {
 	var p struct {
-		ID         string  `json:"id"`
-		Content    string  `json:"content"`
-		Tags       string  `json:"tags"`
-		Confidence float64 `json:"confidence"`
+		ID           string  `json:"id"`
+		Content      string  `json:"content"`
+		Tags         string  `json:"tags"`
+		Confidence   float64 `json:"confidence"`
+		Conversation string  `json:"conversation"`
 	}
 	if err := json.Unmarshal(args, &p); err != nil {
 		return errorResult("invalid arguments: " + err.Error())
 	}
+	env.source.Conversation = p.Conversation
 	if p.Confidence == 0 {
 		p.Confidence = 0.8
 	}
-	if err := backend.Update(p.ID, p.Content, p.Tags, p.Confidence); err != nil {
+	if err := validateLearning("", p.Confidence); err != nil {
+		return errorResult(err.Error())
+	}
+	if _, err := backend.Get(namespace, p.ID); err != nil {
+		return errorResult(fmt.Sprintf("learning ID:%s not found", p.ID))
+	}
+	if err := backend.Update(namespace, p.ID, p.Content, p.Tags, p.Confidence, env.source); err != nil {
 		return errorResult("update failed: " + err.Error())
 	}
-	return textResult(fmt.Sprintf("Learning ID:%s updated successfully.", p.ID))
+	return structuredResult(fmt.Sprintf("Learning ID:%s updated successfully.", p.ID),
+		map[string]any{"id": p.ID, "updated": true})
+}
+
+func handleListRevisions(backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return errorResult("invalid arguments: " + err.Error())
+	}
+	history, err := learningHistory(backend, namespace, p.ID)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	return structuredResult(formatHistory(p.ID, history), map[string]any{"id": p.ID, "revisions": history})
+}
+
+func handleDiffRevisions(backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		ID   string `json:"id"`
+		From int    `json:"from"`
+		To   int    `json:"to"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return errorResult("invalid arguments: " + err.Error())
+	}
+	history, err := learningHistory(backend, namespace, p.ID)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	if p.To == 0 {
+		p.To = len(history)
+	}
+	from, err := findRevision(history, p.From)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	to, err := findRevision(history, p.To)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	diff := diffRevisions(from, to)
+	return structuredResult(diff, map[string]any{"id": p.ID, "from": p.From, "to": p.To, "diff": diff})
+}
+
+func handleRevert(env toolEnv, backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		ID       string `json:"id"`
+		Revision int    `json:"revision"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return errorResult("invalid arguments: " + err.Error())
+	}
+	if _, err := revertLearning(backend, namespace, p.ID, p.Revision, env.source); err != nil {
+		return errorResult("revert failed: " + err.Error())
+	}
+	return structuredResult(fmt.Sprintf("Learning ID:%s reverted to revision %d.", p.ID, p.Revision),
+		map[string]any{"id": p.ID, "reverted": true, "revision": p.Revision})
+}
+
+func handleMerge(env toolEnv, backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		IDs      []string `json:"ids"`
+		Content  string   `json:"content"`
+		Category string   `json:"category"`
+		Tags     string   `json:"tags"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return errorResult("invalid arguments: " + err.Error())
+	}
+	merged, sources, err := mergeLearnings(backend, namespace, p.IDs, p.Content, p.Category, p.Tags, env.source)
+	var partial *mergeError
+	if errors.As(err, &partial) {
+		result := structuredResult("merge failed: "+err.Error(),
+			map[string]any{"learning": partial.merged, "superseded": partial.marked, "unmarked": partial.unmarked})
+		result.IsError = true
+		return result
+	}
+	if err != nil {
+		return errorResult("merge failed: " + err.Error())
+	}
+	ids := make([]string, len(sources))
+	for i, s := range sources {
+		ids[i] = s.ID
+	}
+	return structuredResult(fmt.Sprintf("Merged learnings ID:%s into ID:%s in category '%s' (confidence %.1f, used %d times).",
+		strings.Join(ids, ", ID:"), merged.ID, merged.Category, merged.Confidence, merged.UseCount),
+		map[string]any{"learning": merged, "superseded": ids})
 }
 
-func handleDelete(backend Backend, args json.RawMessage) ToolResult {
+func handleDelete(env toolEnv, backend Backend, namespace string, args json.RawMessage) ToolResult {
 	var p struct {
 		ID string `json:"id"`
 	}
 	if err := json.Unmarshal(args, &p); err != nil {
 		return errorResult("invalid arguments: " + err.Error())
 	}
-	if err := backend.Delete(p.ID); err != nil {
+	if _, err := backend.Get(namespace, p.ID); err != nil {
+		return errorResult(fmt.Sprintf("learning ID:%s not found", p.ID))
+	}
+	if err := backend.Delete(namespace, p.ID); err != nil {
 		return errorResult("delete failed: " + err.Error())
 	}
-	return textResult(fmt.Sprintf("Learning ID:%s deleted.", p.ID))
+	text := fmt.Sprintf("Learning ID:%s moved to the trash; restore_learning can bring it back", p.ID)
+	if retention := env.trash.Retention.Duration; retention > 0 {
+		text += " within " + formatRetention(retention)
+	}
+	text += "."
+	return structuredResult(text, map[string]any{"id": p.ID, "deleted": true})
+}
+
+func handleListTrash(env toolEnv, backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		Category string `json:"category"`
+		Limit    int    `json:"limit"`
+	}
+	json.Unmarshal(args, &p)
+	if p.Limit <= 0 {
+		p.Limit = 50
+	}
+	t, err := trasherOf(backend)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	learnings, err := t.Trash(namespace, p.Category, p.Limit)
+	if err != nil {
+		return errorResult("list failed: " + err.Error())
+	}
+	if len(learnings) == 0 {
+		return structuredResult("The trash is empty.", learningList(nil))
+	}
+	return structuredResult(formatTrash(learnings, env.trash.Retention.Duration), learningList(learnings))
 }
 
-func handleStats(backend Backend) ToolResult {
-	stats, err := backend.Stats()
+func handleRestore(backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return errorResult("invalid arguments: " + err.Error())
+	}
+	t, err := trasherOf(backend)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	if err := t.Restore(namespace, p.ID); err != nil {
+		return errorResult(fmt.Sprintf("learning ID:%s is not in the trash", p.ID))
+	}
+	return structuredResult(fmt.Sprintf("Learning ID:%s restored.", p.ID),
+		map[string]any{"id": p.ID, "restored": true})
+}
+
+func handleStats(backend Backend, namespace string) ToolResult {
+	stats, err := backend.Stats(namespace)
 	if err != nil {
 		return errorResult("stats failed: " + err.Error())
 	}
@@ -345,5 +1033,82 @@ func handleStats(backend Backend) ToolResult {
 		total += count
 	}
 	sb.WriteString(fmt.Sprintf("\nTotal: %d learnings\n", total))
-	return textResult(sb.String())
+	return structuredResult(sb.String(), map[string]any{"categories": stats, "total": total})
+}
+
+func handleExport(backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		Format   string `json:"format"`
+		Category string `json:"category"`
+	}
+	json.Unmarshal(args, &p)
+	if p.Format == "" {
+		p.Format = formatJSONL
+	}
+	porter, err := porterOf(backend)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	learnings, err := collectLearnings(porter, namespace)
+	if err != nil {
+		return errorResult("export failed: " + err.Error())
+	}
+	if p.Category != "" {
+		learnings = filterCategory(learnings, p.Category)
+	}
+
+	var sb strings.Builder
+	switch p.Format {
+	case formatJSONL:
+		if err = attachRevisions(backend, learnings); err == nil {
+			err = writeJSONL(&sb, learnings)
+		}
+	case formatMarkdown:
+		err = writeMarkdown(&sb, namespace, learnings)
+	default:
+		return errorResult(fmt.Sprintf("unknown format %q (must be jsonl or markdown)", p.Format))
+	}
+	if err != nil {
+		return errorResult("export failed: " + err.Error())
+	}
+	return structuredResult(sb.String(), map[string]any{"format": p.Format, "count": len(learnings), "data": sb.String()})
+}
+
+func handleImport(backend Backend, namespace string, args json.RawMessage) ToolResult {
+	var p struct {
+		Data   string `json:"data"`
+		Format string `json:"format"`
+		Policy string `json:"policy"`
+		DryRun bool   `json:"dry_run"`
+	}
+	if err := json.Unmarshal(args, &p); err != nil {
+		return errorResult("invalid arguments: " + err.Error())
+	}
+	if p.Policy == "" {
+		p.Policy = importSkip
+	}
+	porter, err := porterOf(backend)
+	if err != nil {
+		return errorResult(err.Error())
+	}
+	learnings, err := parseLearnings(strings.NewReader(p.Data), p.Format, "", namespace)
+	if err != nil {
+		return errorResult("invalid import: " + err.Error())
+	}
+	// Everything lands in the caller's namespace, whatever it was exported from
+	for _, l := range learnings {
+		l.Namespace = namespace
+	}
+	counts, err := importLearnings(porter, learnings, p.Policy, p.DryRun)
+	if err != nil {
+		return errorResult(fmt.Sprintf("import failed after %s: %v", counts, err))
+	}
+	text := fmt.Sprintf("Imported %d learnings: %s.", len(learnings), counts)
+	if p.DryRun {
+		text = fmt.Sprintf("Dry run, nothing stored. Would import %d learnings: %s.", len(learnings), counts)
+	}
+	return structuredResult(text, map[string]any{
+		"created": counts.Created, "overwritten": counts.Overwritten, "skipped": counts.Skipped,
+		"renumbered": counts.Renumbered, "dry_run": p.DryRun,
+	})
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ── Trash ─────────────────────────────────────────────────────────────────────
+
+// purgeExpired removes learnings deleted more than retention ago from every
+// namespace, and returns how many it removed.
+func purgeExpired(b Backend, retention time.Duration) (int, error) {
+	t, err := trasherOf(b)
+	if err != nil {
+		return 0, err
+	}
+	p, err := porterOf(b)
+	if err != nil {
+		return 0, err
+	}
+	namespaces, err := p.Namespaces()
+	if err != nil {
+		return 0, err
+	}
+	cutoff := time.Now().Add(-retention)
+	total := 0
+	for _, ns := range namespaces {
+		n, err := t.Purge(ns, cutoff)
+		if err != nil {
+			return total, fmt.Errorf("namespace %s: %w", ns, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// runTrashJanitor purges expired learnings now and every purge interval.
+// It runs for the life of the process.
+func runTrashJanitor(b Backend, cfg TrashConfig) {
+	if _, ok := b.(Trasher); !ok || cfg.Retention.Duration <= 0 || cfg.PurgeInterval.Duration <= 0 {
+		return
+	}
+	purge := func() {
+		n, err := purgeExpired(b, cfg.Retention.Duration)
+		if err != nil {
+			log.Printf("trash: purge failed: %v", err)
+		} else if n > 0 {
+			log.Printf("trash: purged %d learnings deleted more than %s ago", n, formatRetention(cfg.Retention.Duration))
+		}
+	}
+	purge()
+	for range time.Tick(cfg.PurgeInterval.Duration) {
+		purge()
+	}
+}
+
+// formatRetention renders a retention period in days where it is whole days.
+func formatRetention(d time.Duration) string {
+	const day = 24 * time.Hour
+	switch {
+	case d == day:
+		return "1 day"
+	case d > 0 && d%day == 0:
+		return fmt.Sprintf("%d days", d/day)
+	}
+	return d.String()
+}
+
+// formatTrash lists deleted learnings for the model, with when each is due
+// to be purged.
+func formatTrash(learnings []*Learning, retention time.Duration) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Deleted learnings (%d):\n\n", len(learnings)))
+	for _, l := range learnings {
+		sb.WriteString(fmt.Sprintf("[ID:%s | %s | confidence:%.1f | deleted:%s", l.ID, l.Category, l.Confidence,
+			l.DeletedAt.Format("2006-01-02 15:04")))
+		if retention > 0 {
+			sb.WriteString(" | purged after " + l.DeletedAt.Add(retention).Format("2006-01-02"))
+		}
+		sb.WriteString("]\n" + l.Content + "\n")
+		if l.Tags != "" {
+			sb.WriteString(fmt.Sprintf("tags: %s\n", l.Tags))
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// ── In-process vector search ──────────────────────────────────────────────────
+
+// encodeEmbedding packs an embedding as little-endian float32s for storage.
+func encodeEmbedding(v []float64) []byte {
+	buf := make([]byte, 4*len(v))
+	for i, f := range v {
+		binary.LittleEndian.PutUint32(buf[4*i:], math.Float32bits(float32(f)))
+	}
+	return buf
+}
+
+func decodeEmbedding(buf []byte) []float64 {
+	v := make([]float64, len(buf)/4)
+	for i := range v {
+		v[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(buf[4*i:])))
+	}
+	return v
+}
+
+// cosineSimilarity returns the cosine of the angle between a and b, or 0 if
+// they differ in length (e.g. embedded by different models) or either is zero.
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += a[i] * b[i]
+		na += a[i] * a[i]
+		nb += b[i] * b[i]
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(na) * math.Sqrt(nb))
+}
+
+// scoredLearning is a search candidate with its similarity to the query.
+type scoredLearning struct {
+	learning *Learning
+	score    float64
+}
+
+// topBySimilarity keeps the limit candidates most similar to the query,
+// best first, recording each one's similarity in its Match. Candidates with
+// a mismatched dimension never match.
+func topBySimilarity(candidates []scoredLearning, limit int) []*Learning {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].score > candidates[j].score
+	})
+	var out []*Learning
+	for _, c := range candidates {
+		if c.score <= 0 || len(out) == limit {
+			break
+		}
+		c.learning.Match = &Match{Similarity: c.score}
+		out = append(out, c.learning)
+	}
+	return out
+}